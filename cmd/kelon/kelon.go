@@ -19,6 +19,7 @@ var (
 	// Commands
 	run      = app.Command("run", "Run kelon in production mode.")
 	validate = app.Command("validate", "Run kelon in validate mode: validate policies by printing resulting datastore queries")
+	test     = app.Command("test", "Run kelon in test mode: run the test cases of --test-dir against the policies and exit non-zero on failure")
 
 	// Config paths
 	configurationPath = app.Flag("config", "Path to the configuration yaml.").Short('k').Default("./kelon.yml").Envar("KELON_CONF").ExistingFile()
@@ -31,6 +32,13 @@ var (
 	port           = app.Flag("port", "Port on which the proxy endpoint is served.").Short('p').Default("8181").Envar("PORT").Uint32()
 	astSkipUnknown = app.Flag("ast-skip-unknown", "Skip unknown parts in the AST and only log as warning.").Default("false").Envar("AST_SKIP_UNKNOWN").Bool()
 
+	// Decision cache
+	decisionCacheSize = app.Flag("decision-cache-size", "Maximum number of decisions which are cached per package. Caching is disabled if set to 0.").Default("0").Envar("DECISION_CACHE_SIZE").Int()
+	decisionCacheTTL  = app.Flag("decision-cache-ttl", "Duration after which cached decisions expire. Changes of datastore data are only taken into account after this duration. Cached decisions never expire if set to 0.").Default("10s").Envar("DECISION_CACHE_TTL").Duration()
+
+	// Policy check
+	strictPolicyCheck = app.Flag("strict-policy-check", "Refuse to start (or to load changed policies) if policies reference entities which are not contained in the entity_schemas or use builtins without call-operand mapping on datastores.").Default("false").Envar("STRICT_POLICY_CHECK").Bool()
+
 	// Logging
 	logLevel               = app.Flag("log-level", "Log-Level for Kelon. Must be one of [DEBUG, INFO, WARN, ERROR]").Default("INFO").Envar("LOG_LEVEL").Enum("DEBUG", "INFO", "WARN", "ERROR", "debug", "info", "warn", "error")
 	logFormat              = app.Flag("log-format", "Log-Format for Kelon. Must be one of [TEXT, JSON]").Default("TEXT").Envar("LOG_FORMAT").Enum("TEXT", "JSON")
@@ -53,6 +61,9 @@ var (
 	// Configs for validate mode
 	inputBody           = app.Flag("input-body", "Input Body to use in dry run mode").Envar("DRY_INPUT_BODY").String()
 	queryOutputFilename = app.Flag("query-output", "File to write the Query to (JSON). If not set, write to stdout using logging format").Envar("QUERY_OUTPUT_FILE").String()
+
+	// Configs for test mode
+	testDir = app.Flag("test-dir", "Dir containing .yaml or .json files with test cases which are run in test mode.").Envar("TEST_DIR").ExistingDir()
 )
 
 func main() {
@@ -80,6 +91,9 @@ func main() {
 		PathPrefix:               pathPrefix,
 		Port:                     port,
 		AstSkipUnknown:           astSkipUnknown,
+		DecisionCacheSize:        decisionCacheSize,
+		DecisionCacheTTL:         decisionCacheTTL,
+		StrictPolicyCheck:        strictPolicyCheck,
 		AccessDecisionLogLevel:   accessDecisionLogLevel,
 		EnvoyPort:                envoyPort,
 		EnvoyDryRun:              envoyDryRun,
@@ -94,6 +108,7 @@ func main() {
 		Validate:                 false,
 		InputBody:                inputBody,
 		QueryOutputFilename:      queryOutputFilename,
+		TestDir:                  testDir,
 	}
 
 	kelon := core.Kelon{}
@@ -108,6 +123,12 @@ func main() {
 		kelon.Configure(&config)
 		kelon.StartValidate()
 
+	case test.FullCommand():
+		kelon.Configure(&config)
+		if !kelon.StartTest() {
+			os.Exit(1)
+		}
+
 	default:
 		logging.LogForComponent("main").Fatal("Started Kelon with a unknown command!")
 	}
@@ -2,7 +2,10 @@ package configs
 
 import (
 	"fmt"
+	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -10,6 +13,40 @@ import (
 //nolint:gochecknoglobals,gocritic
 var boolTrue = true
 
+//nolint:gochecknoglobals,gocritic
+var ruleNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Names of the rules which are evaluated if an APIMapping has no rules configured.
+const (
+	RuleVerify = "verify"
+	RuleAllow  = "allow"
+)
+
+// Obligations which are evaluated after all rules of an APIMapping are fulfilled.
+// Their values are returned to the caller (i.e. to pass a resolved user downstream).
+const (
+	ObligationHeaders  = "headers"
+	ObligationResponse = "response"
+)
+
+// Names of the rules which provide the obligations if no rule of an APIMapping is flagged with them.
+const (
+	RuleHeaders  = ObligationHeaders
+	RuleResponse = ObligationResponse
+)
+
+// Behaviors of a decision which exceeded its Deadline.
+const (
+	// OnTimeoutDeny denies the request (fail-closed)
+	OnTimeoutDeny = "deny"
+	// OnTimeoutUnavailable answers the request with 503 Service Unavailable
+	OnTimeoutUnavailable = "unavailable"
+)
+
+// MaxDeadlineTimeout is the longest Timeout of a Deadline.
+// Servers answering decisions have to allow at least this duration to write a response.
+const MaxDeadlineTimeout = 10 * time.Second
+
 // DatastoreAPIMapping holds the API-mappings for one of the datastores defined in configs.DatastoreConfig.
 //
 // Each mapping has a type of 'mapping global' Prefix which should be appended to each Path of its Mappings.
@@ -25,11 +62,73 @@ type DatastoreAPIMapping struct {
 // APIMapping within a configs.DatastoreAPIMapping which holds all information that is needed to map an incoming
 // request to a rego package.
 // The Path can be a regular expression.
+//
+// The Rules of the package are evaluated in the given order. If no rules are configured, the rules 'verify' (401) and 'allow' (403)
+// are evaluated depending on the flags Authentication and Authorization of the surrounding configs.DatastoreAPIMapping.
 type APIMapping struct {
-	Path    string
-	Package string
-	Methods []string
-	Queries []string
+	Path     string
+	Package  string
+	Methods  []string
+	Queries  []string
+	Rules    []*PolicyRule `yaml:",omitempty"`
+	Deadline *Deadline     `yaml:",omitempty"`
+}
+
+// Deadline limits the duration of a decision.
+//
+// The Timeout is shared by all policy evaluations and datastore queries of the decision, whereby each policy evaluation
+// may take at most the PolicyTimeout (if set), so that the remaining time is left for the datastore queries.
+// A decision which exceeds its deadline is handled as configured by OnTimeout (default OnTimeoutDeny).
+type Deadline struct {
+	Timeout       time.Duration
+	PolicyTimeout time.Duration `yaml:"policy-timeout,omitempty"`
+	OnTimeout     string        `yaml:"on-timeout,omitempty"`
+}
+
+// PolicyRule is a rule of a rego package which has to be true for a request to be allowed.
+// If the rule is not true, the request is denied with the configured Status (default 403).
+//
+// Filter requests return the datastore queries of the rule which is flagged as Filter (default: the rule 'allow')
+// instead of executing them. All other rules are evaluated as usual.
+//
+// A rule flagged with an Obligation (ObligationHeaders or ObligationResponse) is no condition of the request, but provides
+// the value of the obligation instead of the rule named like the obligation (see ObligationRule()).
+type PolicyRule struct {
+	Name       string
+	Status     int    `yaml:",omitempty"`
+	Filter     bool   `yaml:",omitempty"`
+	Obligation string `yaml:",omitempty"`
+}
+
+// FilterRule returns the rule whose datastore queries are returned by filter requests, which is the rule flagged as Filter
+// or the rule 'allow' if none is flagged. Nil is returned if there is no such rule.
+func FilterRule(rules []*PolicyRule) *PolicyRule {
+	var allow *PolicyRule
+	for _, rule := range rules {
+		if rule.Filter {
+			return rule
+		}
+		if rule.Name == RuleAllow && rule.Obligation == "" {
+			allow = rule
+		}
+	}
+	return allow
+}
+
+// ObligationRule returns the name of the rule which provides the obligation, which is the rule flagged with the obligation
+// or the rule named like the obligation (i.e. RuleHeaders) if none is flagged. If the rule named like the obligation is
+// configured as condition, no rule provides the obligation and an empty string is returned.
+func ObligationRule(rules []*PolicyRule, obligation string) string {
+	name := obligation
+	for _, rule := range rules {
+		if rule.Obligation == obligation {
+			return rule.Name
+		}
+		if rule.Name == obligation {
+			name = ""
+		}
+	}
+	return name
 }
 
 func (m *DatastoreAPIMapping) Validate(schema DatastoreSchemas) error {
@@ -65,6 +164,12 @@ func (m *DatastoreAPIMapping) Validate(schema DatastoreSchemas) error {
 		}
 	}
 
+	for _, mapping := range m.Mappings {
+		if err := mapping.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid mapping for path %q", m.Prefix+mapping.Path)
+		}
+	}
+
 	return nil
 }
 
@@ -76,6 +181,98 @@ func (m *DatastoreAPIMapping) Defaults() {
 	if m.Authentication == nil {
 		m.Authentication = &boolTrue
 	}
+
+	for _, mapping := range m.Mappings {
+		mapping.Defaults()
+	}
+}
+
+// EffectiveRules returns the rules which have to be evaluated for the passed mapping.
+// If the mapping only configures obligations, the rules derived from the flags Authentication and Authorization are evaluated as conditions.
+func (m *DatastoreAPIMapping) EffectiveRules(mapping *APIMapping) []*PolicyRule {
+	for _, rule := range mapping.Rules {
+		if rule.Obligation == "" {
+			return mapping.Rules
+		}
+	}
+
+	var rules []*PolicyRule
+	if m.Authentication == nil || *m.Authentication {
+		rules = append(rules, &PolicyRule{Name: RuleVerify, Status: http.StatusUnauthorized})
+	}
+	if m.Authorization == nil || *m.Authorization {
+		rules = append(rules, &PolicyRule{Name: RuleAllow, Status: http.StatusForbidden})
+	}
+	return append(rules, mapping.Rules...)
+}
+
+func (m *APIMapping) Validate() error {
+	names := make(map[string]bool, len(m.Rules))
+	obligations := make(map[string]bool)
+	filters := 0
+	for _, rule := range m.Rules {
+		if !ruleNameRegex.MatchString(rule.Name) {
+			return errors.Errorf("rule name %q is no valid rego identifier", rule.Name)
+		}
+		if names[rule.Name] {
+			return errors.Errorf("rule %q is configured more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Status < 400 || rule.Status > 599 {
+			return errors.Errorf("status %d of rule %q is no HTTP error status", rule.Status, rule.Name)
+		}
+
+		if rule.Filter {
+			filters++
+		}
+
+		if rule.Obligation == "" {
+			continue
+		}
+		if rule.Obligation != ObligationHeaders && rule.Obligation != ObligationResponse {
+			return errors.Errorf("obligation %q of rule %q is neither %q nor %q", rule.Obligation, rule.Name, ObligationHeaders, ObligationResponse)
+		}
+		if obligations[rule.Obligation] {
+			return errors.Errorf("only one rule can be flagged with obligation %q", rule.Obligation)
+		}
+		obligations[rule.Obligation] = true
+		if rule.Filter {
+			return errors.Errorf("rule %q can not be flagged as filter and obligation", rule.Name)
+		}
+	}
+	if filters > 1 {
+		return errors.Errorf("only one rule can be flagged as filter")
+	}
+
+	if m.Deadline != nil {
+		return m.Deadline.Validate()
+	}
+	return nil
+}
+
+func (m *APIMapping) Defaults() {
+	for _, rule := range m.Rules {
+		if rule.Status == 0 {
+			rule.Status = http.StatusForbidden
+		}
+	}
+	if m.Deadline != nil && m.Deadline.OnTimeout == "" {
+		m.Deadline.OnTimeout = OnTimeoutDeny
+	}
+}
+
+func (d *Deadline) Validate() error {
+	if d.Timeout <= 0 || d.Timeout > MaxDeadlineTimeout {
+		return errors.Errorf("timeout %s of deadline has to be positive and at most %s", d.Timeout, MaxDeadlineTimeout)
+	}
+	if d.PolicyTimeout < 0 || d.PolicyTimeout > d.Timeout {
+		return errors.Errorf("policy-timeout %s of deadline has to be between 0 and its timeout %s", d.PolicyTimeout, d.Timeout)
+	}
+	if d.OnTimeout != "" && d.OnTimeout != OnTimeoutDeny && d.OnTimeout != OnTimeoutUnavailable {
+		return errors.Errorf("on-timeout %q of deadline is neither %q nor %q", d.OnTimeout, OnTimeoutDeny, OnTimeoutUnavailable)
+	}
+	return nil
 }
 
 func findEntityAmbiguity(entity Entity, pathHistory []string) error {
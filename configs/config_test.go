@@ -2,6 +2,7 @@ package configs_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/unbasical/kelon/configs"
@@ -22,6 +23,15 @@ var wantedExternalConfig = configs.ExternalConfig{
 				},
 			},
 		},
+		ForwardAuth: configs.ForwardAuth{
+			ResponseHeaders: []*configs.HeaderMapping{
+				{
+					Name:  "user",
+					Alias: "X-User-Id",
+				},
+			},
+			DecisionIDHeader: "X-Kelon-Decision-Id",
+		},
 	},
 	APIMappings: []*configs.DatastoreAPIMapping{
 		{
@@ -41,12 +51,23 @@ var wantedExternalConfig = configs.ExternalConfig{
 					Package: "articles",
 					Methods: []string{"POST"},
 					Queries: nil,
+					Rules: []*configs.PolicyRule{
+						{Name: "verify", Status: 401},
+						{Name: "allow", Status: 403},
+						{Name: "rate_ok", Status: 429},
+						{Name: "user_headers", Status: 403, Obligation: configs.ObligationHeaders},
+					},
 				},
 				{
 					Path:    "/articles",
 					Package: "articles",
 					Methods: []string{"GET"},
 					Queries: []string{"author"},
+					Deadline: &configs.Deadline{
+						Timeout:       500 * time.Millisecond,
+						PolicyTimeout: 100 * time.Millisecond,
+						OnTimeout:     configs.OnTimeoutDeny,
+					},
 				},
 			},
 		},
@@ -147,3 +168,75 @@ func TestLoadAmbiguousEntitiesCausedByAPIMapping(t *testing.T) {
 
 	assert.EqualError(t, err, "loaded invalid configuration: The entity \"pg.appstore.user_followers\" collides with entity \"mysql.appstore.followers\"!")
 }
+
+func TestLoadInvalidRuleStatus(t *testing.T) {
+	_, err := configs.FileConfigLoader{
+		FilePath: "./testdata/api_invalid_rule_status.yml",
+	}.Load()
+
+	assert.EqualError(t, err, "loaded invalid configuration: invalid mapping for path \"/api/.*\": status 200 of rule \"allow\" is no HTTP error status")
+}
+
+func TestEffectiveRules(t *testing.T) {
+	mapping := &configs.DatastoreAPIMapping{Authentication: &boolFalse, Authorization: &boolTrue}
+	assert.Equal(t, []*configs.PolicyRule{{Name: configs.RuleAllow, Status: 403}}, mapping.EffectiveRules(&configs.APIMapping{}))
+
+	rules := []*configs.PolicyRule{{Name: "tenant_active", Status: 403}}
+	assert.Equal(t, rules, mapping.EffectiveRules(&configs.APIMapping{Rules: rules}))
+
+	// Obligations are no conditions
+	obligations := []*configs.PolicyRule{{Name: "user_headers", Status: 403, Obligation: configs.ObligationHeaders}}
+	assert.Equal(t, []*configs.PolicyRule{{Name: configs.RuleAllow, Status: 403}, obligations[0]}, mapping.EffectiveRules(&configs.APIMapping{Rules: obligations}))
+}
+
+func TestLoadInvalidDeadline(t *testing.T) {
+	_, err := configs.FileConfigLoader{
+		FilePath: "./testdata/api_invalid_deadline.yml",
+	}.Load()
+
+	assert.EqualError(t, err, "loaded invalid configuration: invalid mapping for path \"/api/.*\": policy-timeout 1s of deadline has to be between 0 and its timeout 100ms")
+}
+
+func TestLoadExceedingDeadline(t *testing.T) {
+	_, err := configs.FileConfigLoader{
+		FilePath: "./testdata/api_exceeding_deadline.yml",
+	}.Load()
+
+	assert.EqualError(t, err, "loaded invalid configuration: invalid mapping for path \"/api/.*\": timeout 1m0s of deadline has to be positive and at most 10s")
+}
+
+func TestFilterRule(t *testing.T) {
+	verify := &configs.PolicyRule{Name: configs.RuleVerify}
+	allow := &configs.PolicyRule{Name: configs.RuleAllow}
+	scope := &configs.PolicyRule{Name: "scope"}
+	assert.Same(t, allow, configs.FilterRule([]*configs.PolicyRule{verify, allow, scope}))
+	assert.Nil(t, configs.FilterRule([]*configs.PolicyRule{verify, scope}))
+
+	scope.Filter = true
+	assert.Same(t, scope, configs.FilterRule([]*configs.PolicyRule{verify, allow, scope}))
+
+	mapping := &configs.APIMapping{Rules: []*configs.PolicyRule{{Name: "allow", Status: 403, Filter: true}, {Name: "scope", Status: 403, Filter: true}}}
+	assert.EqualError(t, mapping.Validate(), "only one rule can be flagged as filter")
+}
+
+func TestObligationRule(t *testing.T) {
+	allow := &configs.PolicyRule{Name: configs.RuleAllow}
+	assert.Equal(t, configs.RuleHeaders, configs.ObligationRule([]*configs.PolicyRule{allow}, configs.ObligationHeaders))
+	assert.Equal(t, configs.RuleResponse, configs.ObligationRule([]*configs.PolicyRule{allow}, configs.ObligationResponse))
+
+	// Flagged rules replace the rules named like the obligations
+	userHeaders := &configs.PolicyRule{Name: "user_headers", Obligation: configs.ObligationHeaders}
+	assert.Equal(t, "user_headers", configs.ObligationRule([]*configs.PolicyRule{allow, userHeaders}, configs.ObligationHeaders))
+	assert.Equal(t, configs.RuleResponse, configs.ObligationRule([]*configs.PolicyRule{allow, userHeaders}, configs.ObligationResponse))
+
+	// Conditions are never evaluated as obligations
+	response := &configs.PolicyRule{Name: configs.RuleResponse}
+	assert.Empty(t, configs.ObligationRule([]*configs.PolicyRule{allow, response}, configs.ObligationResponse))
+
+	mapping := &configs.APIMapping{Rules: []*configs.PolicyRule{{Name: "allow", Status: 403}, {Name: "user", Status: 403, Obligation: "user"}}}
+	assert.EqualError(t, mapping.Validate(), "obligation \"user\" of rule \"user\" is neither \"headers\" nor \"response\"")
+
+	mapping.Rules[1].Obligation = configs.ObligationResponse
+	mapping.Rules = append(mapping.Rules, &configs.PolicyRule{Name: "tenant", Status: 403, Obligation: configs.ObligationResponse})
+	assert.EqualError(t, mapping.Validate(), "only one rule can be flagged with obligation \"response\"")
+}
@@ -1,10 +1,15 @@
 package configs
 
-import "github.com/pkg/errors"
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
 
 // Global holds the global configuration for the application.
 type Global struct {
-	Input Input `yaml:"input"`
+	Input       Input       `yaml:"input"`
+	ForwardAuth ForwardAuth `yaml:"forward-auth"`
 }
 
 // Input holds input related configuration, such as global header to input mappings.
@@ -12,6 +17,15 @@ type Input struct {
 	HeaderMapping []*HeaderMapping `yaml:"header-mapping"`
 }
 
+// ForwardAuth holds the configuration of the forward-auth endpoint, which is used by reverse proxies like NGINX or Traefik.
+// The header obligations of allowed decisions are returned as response headers, so that the proxy can pass them upstream.
+// ResponseHeaders rename the obligation (Name) to the response header (Alias).
+// If DecisionIDHeader is set, the id of each decision is returned with this response header.
+type ForwardAuth struct {
+	ResponseHeaders  []*HeaderMapping `yaml:"response-headers"`
+	DecisionIDHeader string           `yaml:"decision-id-header"`
+}
+
 // HeaderMapping is a simple struct to hold a key-value pair for headers that should be included in the request.
 // If Name is not set, the header will be included as is, otherwise the header will be included as the specified name.
 type HeaderMapping struct {
@@ -20,7 +34,10 @@ type HeaderMapping struct {
 }
 
 func (g *Global) Validate() error {
-	return g.Input.Validate()
+	if err := g.Input.Validate(); err != nil {
+		return err
+	}
+	return g.ForwardAuth.Validate()
 }
 
 func (i *Input) Validate() error {
@@ -45,3 +62,26 @@ func (i *Input) Validate() error {
 
 	return nil
 }
+
+func (f *ForwardAuth) Validate() error {
+	// Validate response header mappings
+	headerCache := make(map[string]struct{})
+	for _, header := range f.ResponseHeaders {
+		if header.Name == "" {
+			return errors.Errorf("Empty header in forward-auth response-headers")
+		}
+
+		// If no target name is set, use the header as is
+		if header.Alias == "" {
+			header.Alias = header.Name
+		}
+
+		// check for duplicates
+		if _, ok := headerCache[http.CanonicalHeaderKey(header.Alias)]; ok {
+			return errors.Errorf("Duplicate header alias %q in forward-auth response-headers", header.Alias)
+		}
+		headerCache[http.CanonicalHeaderKey(header.Alias)] = struct{}{}
+	}
+
+	return nil
+}
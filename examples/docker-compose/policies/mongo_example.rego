@@ -22,7 +22,7 @@ allow {
 	input.path = ["api", "mongo", "apps", app_id]
 
 	# This query fires against collection -> apps
-	data.mongo.apps[app].id == app_id
+	data.mongo.apps[app].id == to_number(app_id)
 
 	# Nest elements
 	data.mongo.rights[right].right == "OWNER"
@@ -41,7 +41,7 @@ allow {
 
 	# This query fires against collection -> apps
 	data.mongo.apps[app].stars == 5
-	app.id == app_id
+	app.id == to_number(app_id)
 }
 
 # Path: GET /api/mongo/apps/:app_id
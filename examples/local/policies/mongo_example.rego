@@ -22,7 +22,7 @@ allow {
 	input.path = ["api", "mongo", "apps", app_id]
 
 	# This query fires against collection -> apps
-	data.mongo.apps[app].id == app_id
+	data.mongo.apps[app].id == to_number(app_id)
 
 	# Nest elements
 	data.mongo.rights[right].right == "OWNER"
@@ -41,7 +41,7 @@ allow {
 
 	# This query fires against collection -> apps
 	data.mongo.apps[app].stars == 5
-	app.id == app_id
+	app.id == to_number(app_id)
 }
 
 # Path: GET /api/mongo/apps/:app_id
@@ -76,6 +76,19 @@ allow {
 	count(app) > 0
 }
 
+# Path: POST /api/mongo/apps/new
+# Users may create apps as long as they are the friend of any user
+allow {
+	some u
+	input.method == "POST"
+	input.path = ["api", "mongo", "apps", "new"]
+
+	data.mongo.users[u].name == input.user
+
+	# Aggregates over comprehensions are looked up by aggregation pipelines
+	count([friend | data.mongo.users[friend].friend == u.name]) > 0
+}
+
 old_or_kevin(age, friend) {
 	age == 42
 }
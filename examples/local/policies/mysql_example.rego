@@ -73,6 +73,19 @@ allow {
 	count(app) > 0
 }
 
+# Path: POST /api/mysql/apps/new
+# Users may create apps as long as their own apps have less than 10 stars in total
+allow {
+	some u
+	input.method == "POST"
+	input.path = ["api", "mysql", "apps", "new"]
+
+	data.mysql.users[u].name == input.user
+
+	# Aggregates over comprehensions are translated into subqueries
+	sum([app.stars | data.mysql.apps[app].id == data.mysql.app_rights[r].app_id; r.user_id == u.id; r.right == "OWNER"]) < 10
+}
+
 old_or_kevin(age, friend) {
 	age == 42
 }
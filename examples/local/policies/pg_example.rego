@@ -72,6 +72,19 @@ allow {
 	count(app) > 0
 }
 
+# Path: POST /api/pg/apps/new
+# Users may create apps as long as they own less than 10 apps
+allow {
+	some u
+	input.method == "POST"
+	input.path = ["api", "pg", "apps", "new"]
+
+	data.pg.pg_users[u].name == input.user
+
+	# Aggregates over comprehensions are translated into subqueries
+	count([r | data.pg.pg_app_rights[r].user_id == u.id; r.right == "OWNER"]) < 10
+}
+
 old_or_kevin(age, friend) {
 	age == 42
 }
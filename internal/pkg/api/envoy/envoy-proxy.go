@@ -4,15 +4,22 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	extauthz "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	extauthzv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/unbasical/kelon/configs"
 	"github.com/unbasical/kelon/pkg/api"
+	"github.com/unbasical/kelon/pkg/constants"
 	"github.com/unbasical/kelon/pkg/constants/logging"
+	internalErrors "github.com/unbasical/kelon/pkg/errors"
 	"github.com/unbasical/kelon/pkg/opa"
 	"google.golang.org/genproto/googleapis/rpc/code"
 	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
@@ -101,8 +108,9 @@ func (proxy *envoyProxy) Start() error {
 	// Init grpc server
 	interceptor := proxy.makeServerInterceptor()
 	proxy.envoy.server = grpc.NewServer(interceptor)
-	// Register Authorization Server
+	// Register Authorization Servers
 	extauthz.RegisterAuthorizationServer(proxy.envoy.server, proxy.envoy)
+	extauthzv3.RegisterAuthorizationServer(proxy.envoy.server, &envoyExtAuthzGrpcServerV3{proxy.envoy})
 
 	// Register reflection service on gRPC server
 	if proxy.envoy.cfg.EnableReflection {
@@ -163,12 +171,90 @@ func (p *envoyExtAuthzGrpcServer) listen() {
 	logging.LogForComponent("envoyExtAuthzGrpcServer").Info("Listener exited.")
 }
 
-// Check a new incoming request
+// httpRequestAttributes contains the attributes of the http request to check, which are shared by all versions of the ext_authz API.
+type httpRequestAttributes interface {
+	GetMethod() string
+	GetPath() string
+	GetQuery() string
+	GetBody() string
+	GetHeaders() map[string]string
+}
+
+// envoyExtAuthzGrpcServerV3 implements the envoy.service.auth.v3.Authorization service with the decision logic of envoyExtAuthzGrpcServer.
+type envoyExtAuthzGrpcServerV3 struct {
+	*envoyExtAuthzGrpcServer
+}
+
+// Check a new incoming request (envoy.service.auth.v2.Authorization)
 func (p *envoyExtAuthzGrpcServer) Check(ctx context.Context, req *extauthz.CheckRequest) (*extauthz.CheckResponse, error) {
+	decision, status, err := p.check(ctx, req.GetAttributes().GetRequest().GetHttp())
+	if err != nil {
+		return nil, err
+	}
+	resp := &extauthz.CheckResponse{Status: &rpcstatus.Status{Code: int32(status)}}
+
+	// Pass obligations upstream
+	if status == code.Code_OK && len(decision.Headers) > 0 {
+		headers := make([]*core.HeaderValueOption, 0, len(decision.Headers))
+		for name, value := range decision.Headers {
+			headers = append(headers, &core.HeaderValueOption{Header: &core.HeaderValue{Key: name, Value: value}})
+		}
+		resp.HttpResponse = &extauthz.CheckResponse_OkResponse{
+			OkResponse: &extauthz.OkHttpResponse{Headers: headers},
+		}
+	}
+
+	// If dry-run mode, override the status code to unconditionally allow the request
+	// DecisionLogging should reflect what "would" have happened
+	if p.cfg.DryRun && status != code.Code_OK {
+		resp.Status = &rpcstatus.Status{Code: int32(code.Code_OK)}
+		resp.HttpResponse = &extauthz.CheckResponse_OkResponse{
+			OkResponse: &extauthz.OkHttpResponse{},
+		}
+	}
+
+	return resp, nil
+}
+
+// Check a new incoming request (envoy.service.auth.v3.Authorization)
+func (p *envoyExtAuthzGrpcServerV3) Check(ctx context.Context, req *extauthzv3.CheckRequest) (*extauthzv3.CheckResponse, error) {
+	decision, status, err := p.check(ctx, req.GetAttributes().GetRequest().GetHttp())
+	if err != nil {
+		return nil, err
+	}
+
+	// If dry-run mode, override the status code to unconditionally allow the request
+	// DecisionLogging should reflect what "would" have happened
+	if status == code.Code_OK || p.cfg.DryRun {
+		// Pass obligations upstream
+		headers := make([]*corev3.HeaderValueOption, 0, len(decision.Headers))
+		for name, value := range decision.Headers {
+			headers = append(headers, &corev3.HeaderValueOption{Header: &corev3.HeaderValue{Key: name, Value: value}})
+		}
+
+		return &extauthzv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(code.Code_OK)},
+			HttpResponse: &extauthzv3.CheckResponse_OkResponse{
+				OkResponse: &extauthzv3.OkHttpResponse{Headers: headers},
+			},
+		}, nil
+	}
+
+	return &extauthzv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(status)},
+		HttpResponse: &extauthzv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &extauthzv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: typev3.StatusCode(decision.DenyStatus())},
+			},
+		},
+	}, nil
+}
+
+// check rebuilds the http request, evaluates the policy decision and returns it together with the resulting status code (ignoring dry-run mode).
+func (p *envoyExtAuthzGrpcServer) check(ctx context.Context, r httpRequestAttributes) (*opa.Decision, code.Code, error) {
 	// Rebuild http request
-	r := req.GetAttributes().GetRequest().GetHttp()
 	path := r.GetPath()
-	if r.Query != "" {
+	if r.GetQuery() != "" {
 		path = fmt.Sprintf("%s?%s", path, r.GetQuery())
 	}
 	body := r.GetBody()
@@ -187,27 +273,38 @@ func (p *envoyExtAuthzGrpcServer) Check(ctx context.Context, req *extauthz.Check
 	inputBody["token"] = token
 	inputBody["payload"] = body
 
-	decision, err := (*p.compiler).Execute(ctx, inputBody)
+	decision, err := (*p.compiler).Execute(ctx, map[string]interface{}{constants.Input: inputBody})
+	if timeout, isTimeout := errors.Cause(err).(internalErrors.DecisionTimeout); isTimeout && decision != nil {
+		// Decisions which exceeded their deadline are denied (fail-closed) or answered as unavailable
+		logging.LogForComponent("envoyExtAuthzGrpcServer").Warn(err.Error())
+		decision.Allow, decision.StatusCode, err = false, http.StatusForbidden, nil
+		if !timeout.Deny {
+			decision.StatusCode = http.StatusServiceUnavailable
+		}
+	}
 	if err != nil {
-		proxyErr := errors.Wrap(err, "EnvoyProxy: Error during request compilation")
-		return nil, proxyErr
+		return nil, code.Code_UNKNOWN, errors.Wrap(err, "EnvoyProxy: Error during request compilation")
 	}
 
-	resp := &extauthz.CheckResponse{}
-
+	var status code.Code
 	var reason string
 	var logDecision string
 	if decision.Allow {
 		logDecision = "ALLOW"
-		resp.Status = &rpcstatus.Status{Code: int32(code.Code_OK)}
+		status = code.Code_OK
 	} else {
 		logDecision = "DENY"
-		if !decision.Verify {
-			reason = "Unauthenticated"
-			resp.Status = &rpcstatus.Status{Code: int32(code.Code_UNAUTHENTICATED)}
-		} else {
-			reason = "Unauthorized"
-			resp.Status = &rpcstatus.Status{Code: int32(code.Code_PERMISSION_DENIED)}
+		httpStatus := decision.DenyStatus()
+		reason = opa.DenyReason(httpStatus)
+		switch httpStatus {
+		case http.StatusUnauthorized:
+			status = code.Code_UNAUTHENTICATED
+		case http.StatusTooManyRequests:
+			status = code.Code_RESOURCE_EXHAUSTED
+		case http.StatusServiceUnavailable:
+			status = code.Code_UNAVAILABLE
+		default:
+			status = code.Code_PERMISSION_DENIED
 		}
 	}
 
@@ -219,26 +316,15 @@ func (p *envoyExtAuthzGrpcServer) Check(ctx context.Context, req *extauthz.Check
 
 		if !decision.Allow {
 			logFields[logging.LabelReason] = reason
+			logFields[logging.LabelRule] = decision.Rule
 		}
 
 		logging.LogForComponent("envoyExtAuthzGrpcServer").
 			WithFields(logFields).
-			WithError(err).
 			Debug("Returning policy decision.")
 	}
 
-	// If dry-run mode, override the status code to unconditionally allow the request
-	// DecisionLogging should reflect what "would" have happened
-	if p.cfg.DryRun {
-		if resp.Status.Code != int32(code.Code_OK) {
-			resp.Status = &rpcstatus.Status{Code: int32(code.Code_OK)}
-			resp.HttpResponse = &extauthz.CheckResponse_OkResponse{
-				OkResponse: &extauthz.OkHttpResponse{},
-			}
-		}
-	}
-
-	return resp, nil
+	return decision, status, nil
 }
 
 func (proxy *envoyProxy) makeServerInterceptor() grpc.ServerOption {
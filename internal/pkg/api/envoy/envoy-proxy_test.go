@@ -2,20 +2,41 @@ package envoy
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	extauthz "github.com/envoyproxy/go-control-plane/envoy/service/auth/v2"
+	extauthzv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/unbasical/kelon/configs"
+	opaInt "github.com/unbasical/kelon/internal/pkg/opa"
+	requestInt "github.com/unbasical/kelon/internal/pkg/request"
+	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
 	"github.com/unbasical/kelon/pkg/api"
 	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
 	"github.com/unbasical/kelon/pkg/opa"
+	"github.com/unbasical/kelon/pkg/request"
 	"github.com/unbasical/kelon/pkg/telemetry"
+	"github.com/unbasical/kelon/pkg/translate"
+	"github.com/unbasical/kelon/pkg/watcher"
 	"google.golang.org/genproto/googleapis/rpc/code"
 )
 
+const slowPolicy = `package products
+
+allow {
+	data.slow.products[p].owner == "bob"
+}
+`
+
 const exampleAllowedRequest = `{
 	"attributes": {
 	  "request": {
@@ -52,6 +73,7 @@ type mockCompiler struct {
 	failOnConfigure bool
 	failOnProcess   bool
 	decision        bool
+	headers         map[string]string
 }
 
 func (c mockCompiler) GetEngine() *plugins.Manager {
@@ -65,11 +87,95 @@ func (c mockCompiler) Configure(appConfig *configs.AppConfig, compConfig *opa.Po
 	return nil
 }
 
+func (c mockCompiler) Reconfigure(appConfig *configs.AppConfig, compConfig *opa.PolicyCompilerConfig) error {
+	return c.Configure(appConfig, compConfig)
+}
+
 func (c mockCompiler) Execute(ctx context.Context, request map[string]interface{}) (*opa.Decision, error) {
 	if c.failOnProcess {
 		return &opa.Decision{Allow: false}, errors.Errorf("dummy error")
 	}
-	return &opa.Decision{Allow: true}, nil
+	return &opa.Decision{Verify: true, Allow: c.decision, Headers: c.headers}, nil
+}
+
+func (c mockCompiler) Filter(ctx context.Context, request map[string]interface{}) (*opa.FilterDecision, error) {
+	if c.failOnProcess {
+		return &opa.FilterDecision{Allow: false}, errors.Errorf("dummy error")
+	}
+	return &opa.FilterDecision{Allow: true}, nil
+}
+
+// slowDatastore allows each query after a second, unless the query is canceled before.
+type slowDatastore struct{}
+
+func (ds slowDatastore) Configure(_ *configs.AppConfig, _ string) error {
+	return nil
+}
+
+func (ds slowDatastore) Execute(ctx context.Context, _ data.Node) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(time.Second):
+		return true, nil
+	}
+}
+
+func (ds slowDatastore) Filter(_ context.Context, _ data.Node) (data.DatastoreQuery, error) {
+	return data.DatastoreQuery{}, nil
+}
+
+type noopWatcher struct{}
+
+func (w noopWatcher) Watch(_ func(watcher.ChangeType, *configs.ExternalConfig, error)) {}
+
+// newSlowDatastoreCompiler returns a compiler whose only mapping queries a slow datastore within a short deadline.
+func newSlowDatastoreCompiler(t *testing.T, onTimeout string) opa.PolicyCompiler {
+	regoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(regoDir, "products.rego"), []byte(slowPolicy), 0o600))
+
+	boolFalse, boolTrue := false, true
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: map[string]*configs.Datastore{"slow": {Type: data.TypeMysql}},
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"slow": {"shop": {Entities: []*configs.Entity{{Name: "products"}}}},
+			},
+			APIMappings: []*configs.DatastoreAPIMapping{{
+				Prefix:         "/api",
+				Datastores:     []string{"slow"},
+				Authentication: &boolFalse,
+				Authorization:  &boolTrue,
+				Mappings: []*configs.APIMapping{{
+					Path:     "/v1/products",
+					Package:  "products",
+					Deadline: &configs.Deadline{Timeout: 50 * time.Millisecond, OnTimeout: onTimeout},
+				}},
+			}},
+		},
+		MetricsProvider: telemetry.NewNoopMetricProvider(),
+		TraceProvider:   telemetry.NewNoopTraceProvider(),
+	}
+
+	var (
+		slow          data.Datastore        = slowDatastore{}
+		parser                              = requestInt.NewURLProcessor()
+		mapper                              = requestInt.NewPathMapper()
+		translator                          = translateInt.NewAstTranslator()
+		configWatcher watcher.ConfigWatcher = noopWatcher{}
+		prefix                              = "/v1"
+	)
+	compiler := opaInt.NewPolicyCompiler()
+	require.NoError(t, compiler.Configure(appConf, &opa.PolicyCompilerConfig{
+		Prefix:              &prefix,
+		RegoDir:             &regoDir,
+		ConfigWatcher:       &configWatcher,
+		PathProcessor:       &parser,
+		PathProcessorConfig: request.PathProcessorConfig{PathMapper: &mapper},
+		Translator:          &translator,
+		AstTranslatorConfig: translate.AstTranslatorConfig{Datastores: map[string]*data.Datastore{"slow": &slow}},
+	}))
+	return compiler
 }
 
 func TestCheckAllow(t *testing.T) {
@@ -107,3 +213,69 @@ func TestCheckAllow(t *testing.T) {
 		t.Fatal("Expected request to be allowed but got:", output)
 	}
 }
+
+func TestCheckV3(t *testing.T) {
+	var req extauthzv3.CheckRequest
+	if err := util.Unmarshal([]byte(exampleAllowedRequest), &req); err != nil {
+		logging.LogForComponent("envoy-proxy-test").Panic(err)
+	}
+
+	for _, allow := range []bool{true, false} {
+		proxy := NewEnvoyProxy(Config{
+			Port:             9191,
+			DryRun:           false,
+			EnableReflection: true,
+		})
+
+		//nolint:gosimple,gocritic
+		var compiler opa.PolicyCompiler
+		compiler = mockCompiler{
+			failOnConfigure: false,
+			failOnProcess:   false,
+			decision:        allow,
+			headers:         map[string]string{"X-User-Id": "42"},
+		}
+
+		_ = proxy.Configure(context.Background(), &configs.AppConfig{MetricsProvider: telemetry.NewNoopMetricProvider()}, &api.ClientProxyConfig{Compiler: &compiler})
+		server, _ := proxy.(*envoyProxy)
+
+		output, err := (&envoyExtAuthzGrpcServerV3{server.envoy}).Check(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allow && (output.Status.Code != int32(code.Code_OK) || output.GetOkResponse() == nil) {
+			t.Fatal("Expected request to be allowed but got:", output)
+		}
+		if allow && output.GetOkResponse().GetHeaders()[0].GetHeader().GetValue() != "42" {
+			t.Fatal("Expected obligations to be passed as headers but got:", output)
+		}
+		if !allow && (output.Status.Code != int32(code.Code_PERMISSION_DENIED) || output.GetDeniedResponse().GetStatus().GetCode() != typev3.StatusCode_Forbidden) {
+			t.Fatal("Expected request to be denied but got:", output)
+		}
+	}
+}
+
+func TestCheckSlowDatastore(t *testing.T) {
+	var req extauthzv3.CheckRequest
+	require.NoError(t, util.Unmarshal([]byte(exampleAllowedRequest), &req))
+
+	for onTimeout, expected := range map[string]struct {
+		code   code.Code
+		status typev3.StatusCode
+	}{
+		configs.OnTimeoutDeny:        {code: code.Code_PERMISSION_DENIED, status: typev3.StatusCode_Forbidden},
+		configs.OnTimeoutUnavailable: {code: code.Code_UNAVAILABLE, status: typev3.StatusCode_ServiceUnavailable},
+	} {
+		t.Run(onTimeout, func(t *testing.T) {
+			compiler := newSlowDatastoreCompiler(t, onTimeout)
+			proxy := NewEnvoyProxy(Config{Port: 9191})
+			require.NoError(t, proxy.Configure(context.Background(), &configs.AppConfig{MetricsProvider: telemetry.NewNoopMetricProvider()}, &api.ClientProxyConfig{Compiler: &compiler}))
+			server, _ := proxy.(*envoyProxy)
+
+			output, err := (&envoyExtAuthzGrpcServerV3{server.envoy}).Check(context.Background(), &req)
+			require.NoError(t, err)
+			assert.Equal(t, int32(expected.code), output.Status.Code)
+			assert.Equal(t, expected.status, output.GetDeniedResponse().GetStatus().GetCode())
+		})
+	}
+}
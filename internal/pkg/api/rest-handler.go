@@ -45,16 +45,44 @@ type decisionContext struct {
 	Package        string
 	Method         string
 	Authentication bool
+	Rule           string
+	StatusCode     int
 	Duration       time.Duration
 	Error          error
 	CorrelationID  uuid.UUID
 }
 
+type filterResponse struct {
+	Result struct {
+		Allow   bool                   `json:"allow"`
+		Filters map[string]filterQuery `json:"filters"`
+	} `json:"result"`
+}
+
+type decisionResponse struct {
+	Result struct {
+		Allow    bool              `json:"allow"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		Response interface{}       `json:"response,omitempty"`
+	} `json:"result"`
+}
+
+// filterQuery is the datastore native filter of a datastore. Numbered placeholders of the statement (i.e. $1 for PostgreSQL)
+// reference the parameters starting at 1 and have to be renumbered if the statement is appended to a query with own parameters.
+type filterQuery struct {
+	Statement  interface{}   `json:"statement"`
+	Parameters []interface{} `json:"parameters,omitempty"`
+}
+
 /*
  * ================ Data API ================
  */
 
 func (proxy *restProxy) handleV1DataGet(w http.ResponseWriter, r *http.Request) {
+	mapGetToPost(w, r, proxy.handleV1DataPost)
+}
+
+func mapGetToPost(w http.ResponseWriter, r *http.Request, handlePost func(http.ResponseWriter, *http.Request)) {
 	// Map query parameter "input" to request body
 	body := ""
 	query := r.URL.Query()
@@ -75,7 +103,7 @@ func (proxy *restProxy) handleV1DataGet(w http.ResponseWriter, r *http.Request)
 
 	if trans, err := http.NewRequest("POST", r.URL.String(), strings.NewReader(builder.String())); err == nil {
 		// Handle request like post
-		proxy.handleV1DataPost(w, trans)
+		handlePost(w, trans)
 	} else {
 		logging.LogForComponent("restProxy").Fatal("Unable to map GET request to POST: ", err.Error())
 	}
@@ -99,15 +127,162 @@ func (proxy *restProxy) handleV1DataPost(w http.ResponseWriter, r *http.Request)
 
 	if err != nil {
 		proxy.handleError(ctx, w, wrapErrorInLoggingContext(err))
+		return
 	}
 
 	if decision.Allow {
-		proxy.writeAllow(ctx, w, loggingContextFromDecision(decision, duration))
+		proxy.writeAllowDecision(ctx, w, decision, loggingContextFromDecision(decision, duration))
 	} else {
 		proxy.writeDeny(ctx, w, loggingContextFromDecision(decision, duration))
 	}
 }
 
+/*
+ * ================ Filter API ================
+ */
+
+func (proxy *restProxy) handleV1FilterGet(w http.ResponseWriter, r *http.Request) {
+	mapGetToPost(w, r, proxy.handleV1FilterPost)
+}
+
+func (proxy *restProxy) handleV1FilterPost(w http.ResponseWriter, r *http.Request) {
+	// Set start time for request duration
+	startTime := time.Now()
+
+	ctx := r.Context()
+
+	// Parse body of request
+	requestBody, bodyErr := proxy.parseRequestBody(r)
+	if bodyErr != nil {
+		proxy.handleError(ctx, w, wrapErrorInLoggingContext(bodyErr))
+		return
+	}
+
+	decision, err := (*proxy.config.Compiler).Filter(ctx, requestBody)
+	duration := time.Since(startTime)
+
+	if err != nil {
+		proxy.handleError(ctx, w, wrapErrorInLoggingContext(err))
+		return
+	}
+
+	loggingInfo := &decisionContext{
+		Path:           decision.Path,
+		Package:        decision.Package,
+		Method:         decision.Method,
+		Authentication: decision.Verify,
+		Rule:           decision.Rule,
+		StatusCode:     decision.DenyStatus(),
+		Duration:       duration,
+	}
+
+	if decision.Allow {
+		var response filterResponse
+		response.Result.Allow = true
+		response.Result.Filters = make(map[string]filterQuery, len(decision.Filters))
+		for datastore, filter := range decision.Filters {
+			response.Result.Filters[datastore] = filterQuery{Statement: filter.Statement, Parameters: filter.Parameters}
+		}
+
+		writeJSON(w, http.StatusOK, response)
+		proxy.recordAllow(ctx, loggingInfo)
+	} else {
+		proxy.writeDeny(ctx, w, loggingInfo)
+	}
+}
+
+/*
+ * ================ Forward-Auth API ================
+ */
+
+func (proxy *restProxy) handleV1ForwardAuth(w http.ResponseWriter, r *http.Request) {
+	// Set start time for request duration
+	startTime := time.Now()
+
+	ctx := r.Context()
+	decisionID := uuid.New()
+	if header := proxy.appConf.Global.ForwardAuth.DecisionIDHeader; header != "" {
+		w.Header().Set(header, decisionID.String())
+	}
+
+	// Build input from the headers of the reverse proxy, because the request has no body
+	input, inputErr := forwardAuthInput(r)
+	if inputErr != nil {
+		proxy.handleError(ctx, w, wrapErrorInLoggingContext(inputErr))
+		return
+	}
+	requestBody, inputErr := proxy.applyHeaderMappingsToInput(map[string]interface{}{constants.Input: input}, r)
+	if inputErr != nil {
+		proxy.handleError(ctx, w, wrapErrorInLoggingContext(inputErr))
+		return
+	}
+
+	decision, err := (*proxy.config.Compiler).Execute(ctx, requestBody)
+	duration := time.Since(startTime)
+
+	if err != nil {
+		loggingInfo := wrapErrorInLoggingContext(err)
+		loggingInfo.CorrelationID = decisionID
+		proxy.handleError(ctx, w, loggingInfo)
+		return
+	}
+
+	loggingInfo := loggingContextFromDecision(decision, duration)
+	loggingInfo.CorrelationID = decisionID
+	if decision.Allow {
+		proxy.writeForwardAuthHeaders(w, decision)
+		proxy.writeAllow(ctx, w, loggingInfo)
+	} else {
+		proxy.writeDeny(ctx, w, loggingInfo)
+	}
+}
+
+// forwardAuthInput builds the input of the original request from the X-Forwarded-* (Traefik) or X-Original-* (NGINX) headers.
+func forwardAuthInput(r *http.Request) (map[string]interface{}, error) {
+	path := firstHeaderValue(r, constants.HeaderXForwardedURI, constants.HeaderXOriginalURI)
+	if path == "" {
+		return nil, internalErrors.InvalidInput{Msg: fmt.Sprintf("ForwardAuth: Request has neither header %s nor %s!", constants.HeaderXForwardedURI, constants.HeaderXOriginalURI)}
+	}
+	method := firstHeaderValue(r, constants.HeaderXForwardedMethod, constants.HeaderXOriginalMethod)
+	if method == "" {
+		method = r.Method
+	}
+
+	input := map[string]interface{}{
+		"method": method,
+		"path":   path,
+		"token":  r.Header.Get(constants.HeaderAuthorization),
+	}
+	if host := r.Header.Get(constants.HeaderXForwardedHost); host != "" {
+		input["host"] = host
+	}
+	return input, nil
+}
+
+// writeForwardAuthHeaders sets the header obligations of an allowed decision, which are passed upstream by the reverse proxy.
+// Obligations are renamed by the configured response headers.
+func (proxy *restProxy) writeForwardAuthHeaders(w http.ResponseWriter, decision *opa.Decision) {
+	aliases := make(map[string]string, len(proxy.appConf.Global.ForwardAuth.ResponseHeaders))
+	for _, mapping := range proxy.appConf.Global.ForwardAuth.ResponseHeaders {
+		aliases[http.CanonicalHeaderKey(mapping.Name)] = mapping.Alias
+	}
+	for name, value := range decision.Headers {
+		if alias, ok := aliases[http.CanonicalHeaderKey(name)]; ok {
+			name = alias
+		}
+		w.Header().Set(name, value)
+	}
+}
+
+func firstHeaderValue(r *http.Request, headers ...string) string {
+	for _, header := range headers {
+		if value := r.Header.Get(header); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 // Migration from github.com/open-policy-agent/opa/server/server.go
 func (proxy *restProxy) handleV1DataPut(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -643,7 +818,7 @@ func (proxy *restProxy) handleError(ctx context.Context, w http.ResponseWriter,
 	logging.LogForComponent("PolicyCompiler").Errorf("Handle error response: %s", loggingInfo.Error)
 
 	// Write response
-	switch errors.Cause(loggingInfo.Error).(type) {
+	switch err := errors.Cause(loggingInfo.Error).(type) {
 	case request.PathAmbiguousError:
 		writeError(w, http.StatusNotFound, types.CodeResourceNotFound, loggingInfo.Error)
 	case request.PathNotFoundError:
@@ -652,6 +827,14 @@ func (proxy *restProxy) handleError(ctx context.Context, w http.ResponseWriter,
 		writeError(w, http.StatusBadRequest, types.CodeInvalidParameter, loggingInfo.Error)
 	case internalErrors.InvalidRequestTranslation:
 		proxy.writeDenyError(ctx, w, loggingInfo)
+	case internalErrors.DecisionTimeout:
+		if !err.Deny {
+			writeError(w, http.StatusServiceUnavailable, types.CodeEvaluation, loggingInfo.Error)
+			return
+		}
+		// Fail-closed
+		loggingInfo.StatusCode = http.StatusForbidden
+		proxy.writeDenyError(ctx, w, loggingInfo)
 	default:
 		writeError(w, http.StatusInternalServerError, types.CodeInternal, loggingInfo.Error)
 	}
@@ -671,7 +854,26 @@ func (proxy *restProxy) writeDenyError(ctx context.Context, w http.ResponseWrite
 
 func (proxy *restProxy) writeAllow(ctx context.Context, w http.ResponseWriter, loggingInfo *decisionContext) {
 	w.WriteHeader(http.StatusOK)
+	proxy.recordAllow(ctx, loggingInfo)
+}
+
+// writeAllowDecision writes the obligations of the decision as JSON (if there are any) and records the allowed decision.
+func (proxy *restProxy) writeAllowDecision(ctx context.Context, w http.ResponseWriter, decision *opa.Decision, loggingInfo *decisionContext) {
+	if decision.Headers == nil && decision.Response == nil {
+		proxy.writeAllow(ctx, w, loggingInfo)
+		return
+	}
 
+	var response decisionResponse
+	response.Result.Allow = true
+	response.Result.Headers = decision.Headers
+	response.Result.Response = decision.Response
+
+	writeJSON(w, http.StatusOK, response)
+	proxy.recordAllow(ctx, loggingInfo)
+}
+
+func (proxy *restProxy) recordAllow(ctx context.Context, loggingInfo *decisionContext) {
 	labels := map[string]string{
 		constants.LabelPolicyDecision: "allow",
 		constants.LabelRegoPackage:    loggingInfo.Package,
@@ -685,18 +887,24 @@ func (proxy *restProxy) writeAllow(ctx context.Context, w http.ResponseWriter, l
 		logging.LabelDuration: loggingInfo.Duration.String(),
 	}
 
+	if loggingInfo.CorrelationID != uuid.Nil {
+		logFields[logging.LabelCorrelation] = loggingInfo.CorrelationID.String()
+	}
+
 	logging.LogAccessDecision(proxy.config.AccessDecisionLogLevel, "ALLOW", "policyCompiler", logFields)
 }
 
 func (proxy *restProxy) writeDeny(ctx context.Context, w http.ResponseWriter, loggingInfo *decisionContext) {
-	var reason string
-	if !loggingInfo.Authentication {
-		reason = "Unauthenticated"
-		w.WriteHeader(http.StatusUnauthorized)
-	} else {
-		reason = "Unauthorized"
-		w.WriteHeader(http.StatusForbidden)
+	status := loggingInfo.StatusCode
+	if status == 0 {
+		// Request was denied without a decision (i.e. due to an error)
+		status = http.StatusForbidden
+		if !loggingInfo.Authentication {
+			status = http.StatusUnauthorized
+		}
 	}
+	reason := opa.DenyReason(status)
+	w.WriteHeader(status)
 
 	metricLabels := map[string]string{
 		constants.LabelPolicyDecision:       "deny",
@@ -713,8 +921,13 @@ func (proxy *restProxy) writeDeny(ctx context.Context, w http.ResponseWriter, lo
 		logging.LabelReason:   reason,
 	}
 
+	if loggingInfo.Rule != "" {
+		logFields[logging.LabelRule] = loggingInfo.Rule
+	}
 	if loggingInfo.Error != nil {
 		logFields[logging.LabelError] = loggingInfo.Error.Error()
+	}
+	if loggingInfo.CorrelationID != uuid.Nil {
 		logFields[logging.LabelCorrelation] = loggingInfo.CorrelationID.String()
 	}
 
@@ -727,6 +940,8 @@ func loggingContextFromDecision(decision *opa.Decision, duration time.Duration)
 		Package:        decision.Package,
 		Method:         decision.Method,
 		Authentication: decision.Verify,
+		Rule:           decision.Rule,
+		StatusCode:     decision.DenyStatus(),
 		Duration:       duration,
 	}
 }
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	opaInt "github.com/unbasical/kelon/internal/pkg/opa"
+	requestInt "github.com/unbasical/kelon/internal/pkg/request"
+	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
+	"github.com/unbasical/kelon/pkg/api"
+	"github.com/unbasical/kelon/pkg/constants"
+	"github.com/unbasical/kelon/pkg/data"
+	internalErrors "github.com/unbasical/kelon/pkg/errors"
+	"github.com/unbasical/kelon/pkg/opa"
+	"github.com/unbasical/kelon/pkg/request"
+	"github.com/unbasical/kelon/pkg/telemetry"
+	"github.com/unbasical/kelon/pkg/translate"
+	"github.com/unbasical/kelon/pkg/watcher"
+)
+
+const slowPolicy = `package apps
+
+allow {
+	data.slow.users[u].name == "arnold"
+}
+`
+
+type mockCompiler struct {
+	decision *opa.Decision
+	err      error
+}
+
+func (c mockCompiler) GetEngine() *plugins.Manager {
+	panic("implement me")
+}
+
+func (c mockCompiler) Configure(_ *configs.AppConfig, _ *opa.PolicyCompilerConfig) error {
+	return nil
+}
+
+func (c mockCompiler) Reconfigure(_ *configs.AppConfig, _ *opa.PolicyCompilerConfig) error {
+	return nil
+}
+
+func (c mockCompiler) Execute(_ context.Context, _ map[string]interface{}) (*opa.Decision, error) {
+	return c.decision, c.err
+}
+
+func (c mockCompiler) Filter(_ context.Context, _ map[string]interface{}) (*opa.FilterDecision, error) {
+	return nil, c.err
+}
+
+// slowDatastore allows each query after a second, unless the query is canceled before.
+type slowDatastore struct{}
+
+func (ds slowDatastore) Configure(_ *configs.AppConfig, _ string) error {
+	return nil
+}
+
+func (ds slowDatastore) Execute(ctx context.Context, _ data.Node) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(time.Second):
+		return true, nil
+	}
+}
+
+func (ds slowDatastore) Filter(_ context.Context, _ data.Node) (data.DatastoreQuery, error) {
+	return data.DatastoreQuery{}, nil
+}
+
+type noopWatcher struct{}
+
+func (w noopWatcher) Watch(_ func(watcher.ChangeType, *configs.ExternalConfig, error)) {}
+
+// newSlowDatastoreCompiler returns a compiler whose only mapping queries a slow datastore within a short deadline.
+func newSlowDatastoreCompiler(t *testing.T, onTimeout string) opa.PolicyCompiler {
+	regoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(regoDir, "apps.rego"), []byte(slowPolicy), 0o600))
+
+	boolFalse, boolTrue := false, true
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: map[string]*configs.Datastore{"slow": {Type: data.TypeMysql}},
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"slow": {"apps": {Entities: []*configs.Entity{{Name: "users"}}}},
+			},
+			APIMappings: []*configs.DatastoreAPIMapping{{
+				Prefix:         "/api",
+				Datastores:     []string{"slow"},
+				Authentication: &boolFalse,
+				Authorization:  &boolTrue,
+				Mappings: []*configs.APIMapping{{
+					Path:     "/apps/.*",
+					Package:  "apps",
+					Deadline: &configs.Deadline{Timeout: 50 * time.Millisecond, OnTimeout: onTimeout},
+				}},
+			}},
+		},
+		MetricsProvider: telemetry.NewNoopMetricProvider(),
+		TraceProvider:   telemetry.NewNoopTraceProvider(),
+	}
+
+	var (
+		slow          data.Datastore        = slowDatastore{}
+		parser                              = requestInt.NewURLProcessor()
+		mapper                              = requestInt.NewPathMapper()
+		translator                          = translateInt.NewAstTranslator()
+		configWatcher watcher.ConfigWatcher = noopWatcher{}
+		prefix                              = "/v1"
+	)
+	compiler := opaInt.NewPolicyCompiler()
+	require.NoError(t, compiler.Configure(appConf, &opa.PolicyCompilerConfig{
+		Prefix:              &prefix,
+		RegoDir:             &regoDir,
+		ConfigWatcher:       &configWatcher,
+		PathProcessor:       &parser,
+		PathProcessorConfig: request.PathProcessorConfig{PathMapper: &mapper},
+		Translator:          &translator,
+		AstTranslatorConfig: translate.AstTranslatorConfig{Datastores: map[string]*data.Datastore{"slow": &slow}},
+	}))
+	return compiler
+}
+
+// forwardAuth sends a forward-auth request, whose client tries to spoof the user header, to a proxy with the passed compiler.
+func forwardAuth(t *testing.T, compiler opa.PolicyCompiler) *httptest.ResponseRecorder {
+	appConf := &configs.AppConfig{MetricsProvider: telemetry.NewNoopMetricProvider()}
+	appConf.Global.ForwardAuth = configs.ForwardAuth{
+		ResponseHeaders:  []*configs.HeaderMapping{{Name: "user", Alias: "X-User-Id"}},
+		DecisionIDHeader: "X-Kelon-Decision-Id",
+	}
+	proxy := NewRestProxy("/v1", 8181)
+	require.NoError(t, proxy.Configure(context.Background(), appConf, &api.ClientProxyConfig{Compiler: &compiler}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/forward-auth", http.NoBody)
+	r.Header.Set(constants.HeaderXForwardedURI, "/api/apps/1")
+	r.Header.Set("User", "mallory")
+	r.Header.Set("X-User-Id", "mallory")
+	w := httptest.NewRecorder()
+	proxy.(*restProxy).handleV1ForwardAuth(w, r)
+	return w
+}
+
+func TestForwardAuthAllow(t *testing.T) {
+	w := forwardAuth(t, mockCompiler{decision: &opa.Decision{
+		Verify:  true,
+		Allow:   true,
+		Headers: map[string]string{"user": "arnold", "X-Tenant": "acme"},
+	}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "arnold", w.Header().Get("X-User-Id"))
+	assert.Equal(t, "acme", w.Header().Get("X-Tenant"))
+	assert.Empty(t, w.Header().Get("User"))
+	assert.NotEmpty(t, w.Header().Get("X-Kelon-Decision-Id"))
+}
+
+func TestForwardAuthDeny(t *testing.T) {
+	w := forwardAuth(t, mockCompiler{decision: &opa.Decision{
+		Verify:  true,
+		Allow:   false,
+		Headers: map[string]string{"user": "arnold"},
+	}})
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("X-User-Id"))
+	assert.Empty(t, w.Header().Get("User"))
+	assert.NotEmpty(t, w.Header().Get("X-Kelon-Decision-Id"))
+}
+
+func TestForwardAuthError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err    error
+		status int
+	}{
+		"translation": {err: internalErrors.InvalidRequestTranslation{Msg: "unsupported"}, status: http.StatusUnauthorized},
+		"internal":    {err: errors.New("dummy error"), status: http.StatusInternalServerError},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := forwardAuth(t, mockCompiler{
+				decision: &opa.Decision{Allow: false, Headers: map[string]string{"user": "arnold"}},
+				err:      tc.err,
+			})
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Empty(t, w.Header().Get("X-User-Id"))
+			assert.Empty(t, w.Header().Get("User"))
+			assert.NotEmpty(t, w.Header().Get("X-Kelon-Decision-Id"))
+		})
+	}
+}
+
+func TestForwardAuthSlowDatastore(t *testing.T) {
+	for onTimeout, status := range map[string]int{
+		configs.OnTimeoutDeny:        http.StatusForbidden,
+		configs.OnTimeoutUnavailable: http.StatusServiceUnavailable,
+	} {
+		t.Run(onTimeout, func(t *testing.T) {
+			w := forwardAuth(t, newSlowDatastoreCompiler(t, onTimeout))
+
+			assert.Equal(t, status, w.Code)
+			assert.Empty(t, w.Header().Get("X-User-Id"))
+		})
+	}
+}
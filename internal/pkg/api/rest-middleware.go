@@ -13,10 +13,11 @@ import (
 )
 
 func (proxy *restProxy) applyHandlerMiddlewareIfSet(ctx context.Context, handlerFunc func(http.ResponseWriter, *http.Request), endpoint string) http.Handler {
-	var wrappedHandler http.Handler = http.HandlerFunc(handlerFunc)
+	return proxy.applyTelemetryMiddleware(ctx, proxy.inputHeaderMappingMiddleware(http.HandlerFunc(handlerFunc)), endpoint)
+}
 
-	wrappedHandler = proxy.inputHeaderMappingMiddleware(wrappedHandler)
-	wrappedHandler = proxy.appConf.MetricsProvider.WrapHTTPHandler(ctx, wrappedHandler)
+func (proxy *restProxy) applyTelemetryMiddleware(ctx context.Context, handler http.Handler, endpoint string) http.Handler {
+	wrappedHandler := proxy.appConf.MetricsProvider.WrapHTTPHandler(ctx, handler)
 	wrappedHandler = proxy.appConf.TraceProvider.WrapHTTPHandler(ctx, wrappedHandler, endpoint)
 
 	return wrappedHandler
@@ -15,6 +15,9 @@ import (
 	"github.com/unbasical/kelon/pkg/api"
 )
 
+// writeTimeoutGrace is the time left to write a response after a decision exceeded its deadline.
+const writeTimeoutGrace = 5 * time.Second
+
 type restProxy struct {
 	pathPrefix string
 	port       uint32
@@ -81,11 +84,20 @@ func (proxy *restProxy) Start() error {
 
 	endpointData := proxy.pathPrefix + constants.EndpointSuffixData
 	endpointPolicies := proxy.pathPrefix + constants.EndpointSuffixPolicies
+	endpointFilter := proxy.pathPrefix + constants.EndpointSuffixFilter
+	endpointForwardAuth := proxy.pathPrefix + constants.EndpointSuffixForwardAuth
 
 	// Endpoints to validate queries
 	proxy.router.PathPrefix(endpointData).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1DataGet, endpointData)).Methods("GET")
 	proxy.router.PathPrefix(endpointData).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1DataPost, endpointData)).Methods("POST")
 
+	// Endpoints to receive the filters of the authorization instead of a decision
+	proxy.router.PathPrefix(endpointFilter).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1FilterGet, endpointFilter)).Methods("GET")
+	proxy.router.PathPrefix(endpointFilter).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1FilterPost, endpointFilter)).Methods("POST")
+
+	// Endpoint for reverse proxies which forward the original request via headers (i.e. NGINX auth_request or Traefik ForwardAuth)
+	proxy.router.Path(endpointForwardAuth).Handler(proxy.applyTelemetryMiddleware(ctx, http.HandlerFunc(proxy.handleV1ForwardAuth), endpointForwardAuth))
+
 	// Endpoints to update policies and data
 	proxy.router.PathPrefix(endpointData).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1DataPut, endpointData)).Methods("PUT")
 	proxy.router.PathPrefix(endpointData).Handler(proxy.applyHandlerMiddlewareIfSet(ctx, proxy.handleV1DataPatch, endpointData)).Methods("PATCH")
@@ -105,7 +117,7 @@ func (proxy *restProxy) Start() error {
 		Handler:           proxy.router,
 		Addr:              fmt.Sprintf(":%d", proxy.port),
 		ReadTimeout:       10 * time.Second,
-		WriteTimeout:      10 * time.Second,
+		WriteTimeout:      configs.MaxDeadlineTimeout + writeTimeoutGrace,
 		ReadHeaderTimeout: 0,
 	}
 
@@ -15,13 +15,14 @@ import (
 	apiInt "github.com/unbasical/kelon/internal/pkg/api"
 	"github.com/unbasical/kelon/internal/pkg/api/envoy"
 	"github.com/unbasical/kelon/internal/pkg/builtins"
-	"github.com/unbasical/kelon/internal/pkg/data"
+	dataInt "github.com/unbasical/kelon/internal/pkg/data"
 	opaInt "github.com/unbasical/kelon/internal/pkg/opa"
 	requestInt "github.com/unbasical/kelon/internal/pkg/request"
 	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
 	watcherInt "github.com/unbasical/kelon/internal/pkg/watcher"
 	"github.com/unbasical/kelon/pkg/api"
 	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
 	"github.com/unbasical/kelon/pkg/opa"
 	"github.com/unbasical/kelon/pkg/request"
 	"github.com/unbasical/kelon/pkg/telemetry"
@@ -41,6 +42,13 @@ type KelonConfiguration struct {
 	Port           *uint32
 	AstSkipUnknown *bool
 
+	// Decision cache
+	DecisionCacheSize *int
+	DecisionCacheTTL  *time.Duration
+
+	// Policy check
+	StrictPolicyCheck *bool
+
 	// Logging
 	AccessDecisionLogLevel *string
 
@@ -62,6 +70,9 @@ type KelonConfiguration struct {
 	Validate            bool
 	InputBody           *string
 	QueryOutputFilename *string
+
+	// Configs for test mode
+	TestDir *string
 }
 
 type Kelon struct {
@@ -69,6 +80,9 @@ type Kelon struct {
 	logger          *log.Entry
 	config          *KelonConfiguration
 	dsLoggingWriter io.Writer
+	compiler        opa.PolicyCompiler
+	appConfig       *configs.AppConfig
+	datastores      map[string]*data.Datastore
 	proxy           api.ClientProxy
 	envoyProxy      api.ClientProxy
 	configWatcher   watcher.ConfigWatcher
@@ -109,12 +123,19 @@ func (k *Kelon) Start() {
 
 func (k *Kelon) onConfigLoaded(change watcher.ChangeType, loadedConf *configs.ExternalConfig, err error) {
 	if err != nil {
-		k.logger.Fatalln("Unable to parse configuration: ", err.Error())
+		if change == watcher.ChangeAll {
+			k.logger.Fatalln("Unable to parse configuration: ", err.Error())
+		}
+		k.logger.Errorln("Unable to parse changed configuration! Kelon keeps running with the previous configuration: ", err.Error())
+		return
 	}
 
 	ctx := context.Background()
 
-	if change == watcher.ChangeAll {
+	switch change {
+	case watcher.ChangeConf:
+		k.reloadConfig(loadedConf)
+	case watcher.ChangeAll:
 		// Configure application
 		var (
 			config     = new(configs.AppConfig)
@@ -140,6 +161,11 @@ func (k *Kelon) onConfigLoaded(change watcher.ChangeType, loadedConf *configs.Ex
 		// load call operands for the datastore translator
 		k.loadCallOperands(config)
 
+		// Remember components which are replaced on reload
+		k.compiler = compiler
+		k.appConfig = config
+		k.datastores = serverConf.Datastores
+
 		// Start rest proxy
 		k.startNewRestProxy(ctx, config, &serverConf)
 
@@ -147,6 +173,8 @@ func (k *Kelon) onConfigLoaded(change watcher.ChangeType, loadedConf *configs.Ex
 		if k.config.EnvoyPort != nil && *k.config.EnvoyPort != 0 {
 			k.startNewEnvoyProxy(ctx, config, &serverConf)
 		}
+	default:
+		// Rego changes are handled by the PolicyCompiler itself
 	}
 }
 
@@ -195,7 +223,7 @@ func (k *Kelon) makeConfigWatcher(configLoader configs.FileConfigLoader, configW
 }
 
 func (k *Kelon) loadCallOperands(appConfig *configs.AppConfig) {
-	ops, err := data.LoadAllCallOperands(appConfig.Datastores, k.config.OperandDir)
+	ops, err := dataInt.LoadAllCallOperands(appConfig.Datastores, k.config.OperandDir)
 	if err != nil {
 		k.logger.Fatalln(err.Error())
 	}
@@ -238,28 +266,35 @@ func (k *Kelon) startNewEnvoyProxy(ctx context.Context, appConfig *configs.AppCo
 func (k *Kelon) makeServerConfig(compiler opa.PolicyCompiler, parser request.PathProcessor, mapper request.PathMapper, translator translate.AstTranslator, loadedConf *configs.ExternalConfig) api.ClientProxyConfig {
 	// Build server config
 	serverConf := api.ClientProxyConfig{
-		Compiler: &compiler,
-		PolicyCompilerConfig: opa.PolicyCompilerConfig{
-			Prefix:        k.config.PathPrefix,
-			RegoDir:       k.config.RegoDir,
-			OPAConfig:     loadedConf.OPA,
-			ConfigWatcher: &k.configWatcher,
-			PathProcessor: &parser,
-			PathProcessorConfig: request.PathProcessorConfig{
-				PathMapper: &mapper,
-			},
-			Translator: &translator,
-			AstTranslatorConfig: translate.AstTranslatorConfig{
-				Datastores:   data.MakeDatastores(loadedConf, k.dsLoggingWriter, k.config.Validate),
-				SkipUnknown:  *k.config.AstSkipUnknown,
-				ValidateMode: k.config.Validate,
-			},
-			AccessDecisionLogLevel: strings.ToUpper(*k.config.AccessDecisionLogLevel),
-		},
+		Compiler:             &compiler,
+		PolicyCompilerConfig: k.makePolicyCompilerConfig(parser, mapper, translator, loadedConf.OPA, dataInt.MakeDatastores(loadedConf, k.dsLoggingWriter, k.config.Validate)),
 	}
 	return serverConf
 }
 
+func (k *Kelon) makePolicyCompilerConfig(parser request.PathProcessor, mapper request.PathMapper, translator translate.AstTranslator, opaConf interface{}, datastores map[string]*data.Datastore) opa.PolicyCompilerConfig {
+	return opa.PolicyCompilerConfig{
+		Prefix:        k.config.PathPrefix,
+		RegoDir:       k.config.RegoDir,
+		OPAConfig:     opaConf,
+		ConfigWatcher: &k.configWatcher,
+		PathProcessor: &parser,
+		PathProcessorConfig: request.PathProcessorConfig{
+			PathMapper: &mapper,
+		},
+		Translator: &translator,
+		AstTranslatorConfig: translate.AstTranslatorConfig{
+			Datastores:   datastores,
+			SkipUnknown:  *k.config.AstSkipUnknown,
+			ValidateMode: k.config.Validate,
+		},
+		AccessDecisionLogLevel: strings.ToUpper(*k.config.AccessDecisionLogLevel),
+		DecisionCacheSize:      *k.config.DecisionCacheSize,
+		DecisionCacheTTL:       *k.config.DecisionCacheTTL,
+		StrictPolicyCheck:      *k.config.StrictPolicyCheck,
+	}
+}
+
 func parseBodyFromString(input string) (map[string]interface{}, error) {
 	in := []byte(input)
 	var raw map[string]interface{}
@@ -0,0 +1,316 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/unbasical/kelon/configs"
+	dataInt "github.com/unbasical/kelon/internal/pkg/data"
+	opaInt "github.com/unbasical/kelon/internal/pkg/opa"
+	requestInt "github.com/unbasical/kelon/internal/pkg/request"
+	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
+	watcherInt "github.com/unbasical/kelon/internal/pkg/watcher"
+	"github.com/unbasical/kelon/pkg/constants"
+	"github.com/unbasical/kelon/pkg/data"
+	"github.com/unbasical/kelon/pkg/opa"
+	"github.com/unbasical/kelon/pkg/telemetry"
+	"gopkg.in/yaml.v3"
+)
+
+// policyTestFile contains all test cases of a single file inside the test directory.
+type policyTestFile struct {
+	Tests []*policyTestCase `yaml:"tests"`
+}
+
+// policyTestCase contains the input of a request and the expected decision.
+//
+// Queries are only compared for the contained datastores. An empty list expects that no query is executed on the datastore.
+type policyTestCase struct {
+	Name    string                        `yaml:"name"`
+	Input   map[string]interface{}        `yaml:"input"`
+	Allow   *bool                         `yaml:"allow,omitempty"`
+	Verify  *bool                         `yaml:"verify,omitempty"`
+	Error   bool                          `yaml:"error,omitempty"`
+	Queries map[string][]*policyTestQuery `yaml:"queries,omitempty"`
+}
+
+type policyTestQuery struct {
+	Statement  interface{}   `yaml:"statement" json:"statement"`
+	Parameters []interface{} `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+// queryRecorder collects the queries which are executed by the test datastores.
+type queryRecorder struct {
+	mutex   sync.Mutex
+	queries map[string][]*policyTestQuery
+}
+
+func (r *queryRecorder) record(alias string, query data.DatastoreQuery) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.queries[alias] = append(r.queries[alias], &policyTestQuery{Statement: query.Statement, Parameters: query.Parameters})
+}
+
+func (r *queryRecorder) reset() map[string][]*policyTestQuery {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	recorded := r.queries
+	r.queries = make(map[string][]*policyTestQuery)
+	return recorded
+}
+
+// StartTest runs all test cases inside the configured test directory against the configured policies and
+// reports the result of each test case. True is returned if all test cases passed.
+func (k *Kelon) StartTest() bool {
+	if !k.configured {
+		k.logger.Fatalf("Kelon was not configured! Please call Configure()!")
+	}
+	if k.config.TestDir == nil || *k.config.TestDir == "" {
+		k.logger.Fatalln("No test directory specified!")
+	}
+
+	passed, err := k.runPolicyTests(os.Stdout)
+	if err != nil {
+		k.logger.Fatalln(err.Error())
+	}
+	return passed
+}
+
+// runPolicyTests runs all test cases and writes their results to out. True is returned if all test cases passed.
+//
+// Datastores of any other type than memory grant access for each query, therefore test cases which expect a request
+// to be denied after querying one of them can not be verified and fail.
+func (k *Kelon) runPolicyTests(out io.Writer) (bool, error) {
+	confLoader := configs.FileConfigLoader{FilePath: *k.config.ConfigPath}
+	loadedConf, err := confLoader.Load()
+	if err != nil {
+		return false, errors.Wrap(err, "Unable to parse configuration")
+	}
+	k.configWatcher = watcherInt.NewSimple(confLoader)
+
+	tests, err := loadPolicyTests(*k.config.TestDir)
+	if err != nil {
+		return false, errors.Wrap(err, "Unable to load test cases")
+	}
+
+	// Configure application
+	var (
+		config     = new(configs.AppConfig)
+		compiler   = opaInt.NewPolicyCompiler()
+		parser     = requestInt.NewURLProcessor()
+		mapper     = requestInt.NewPathMapper()
+		translator = translateInt.NewAstTranslator()
+		recorder   = &queryRecorder{queries: make(map[string][]*policyTestQuery)}
+	)
+
+	// Build config
+	config.Global = loadedConf.Global
+	config.APIMappings = loadedConf.APIMappings
+	config.DatastoreSchemas = loadedConf.DatastoreSchemas
+	config.Datastores = loadedConf.Datastores
+	config.OPA = loadedConf.OPA
+	config.MetricsProvider = telemetry.NewNoopMetricProvider()
+	k.metricsProvider = config.MetricsProvider
+	config.TraceProvider = telemetry.NewNoopTraceProvider()
+	k.traceProvider = config.TraceProvider
+	if config.CallOperands, err = dataInt.LoadAllCallOperands(config.Datastores, k.config.OperandDir); err != nil {
+		return false, err
+	}
+
+	datastores, err := dataInt.MakeTestDatastores(loadedConf, recorder.record)
+	if err != nil {
+		return false, err
+	}
+	compConf := k.makePolicyCompilerConfig(parser, mapper, translator, loadedConf.OPA, datastores)
+	// Each test case has to be evaluated to record its queries
+	compConf.DecisionCacheSize = 0
+	if err = compiler.Configure(config, &compConf); err != nil {
+		return false, err
+	}
+
+	// Queries on all datastores except the memory ones are granted without being evaluated
+	granting := make(map[string]string)
+	for alias, ds := range loadedConf.Datastores {
+		if ds.Type != data.TypeMemory {
+			granting[alias] = ds.Type
+		}
+	}
+
+	// Run all test cases
+	ctx := context.Background()
+	failed := 0
+	for _, file := range sortedKeys(tests) {
+		for _, test := range tests[file] {
+			recorder.reset()
+			decision, execErr := compiler.Execute(ctx, map[string]interface{}{constants.Input: test.Input})
+			problems := test.check(decision, execErr, recorder.reset(), granting)
+
+			if len(problems) == 0 {
+				fmt.Fprintf(out, "PASS: %s: %s\n", file, test.Name)
+				continue
+			}
+			failed++
+			fmt.Fprintf(out, "FAIL: %s: %s\n", file, test.Name)
+			for _, problem := range problems {
+				fmt.Fprintf(out, "    %s\n", strings.ReplaceAll(strings.TrimRight(problem, "\n"), "\n", "\n    "))
+			}
+		}
+	}
+
+	total := 0
+	for _, fileTests := range tests {
+		total += len(fileTests)
+	}
+	fmt.Fprintf(out, "--------------------------------------------------------------------------------\n")
+	fmt.Fprintf(out, "PASS: %d/%d\n", total-failed, total)
+	if failed > 0 {
+		fmt.Fprintf(out, "FAIL: %d/%d\n", failed, total)
+	}
+	return failed == 0, nil
+}
+
+// check compares the result of the test case with its expectations and returns a description of each mismatch.
+// Granting contains the datastores which grant each query (alias -> type).
+func (test *policyTestCase) check(decision *opa.Decision, err error, queries map[string][]*policyTestQuery, granting map[string]string) []string {
+	var problems []string
+	if err != nil {
+		if !test.Error {
+			problems = append(problems, fmt.Sprintf("Unexpected error: %s", err.Error()))
+		}
+		return problems
+	}
+	if test.Error {
+		problems = append(problems, "Expected an error, but the request was evaluated successfully")
+	}
+
+	if test.Verify != nil && decision.Verify != *test.Verify {
+		problems = append(problems, fmt.Sprintf("Expected verify to be %t, but was %t", *test.Verify, decision.Verify))
+	}
+	unverifiable := false
+	if test.Allow != nil && !*test.Allow {
+		// Denials can not be verified as soon as a granting datastore was queried
+		for _, datastore := range sortedKeys(queries) {
+			if dsType, ok := granting[datastore]; ok && len(queries[datastore]) > 0 {
+				unverifiable = true
+				problems = append(problems, fmt.Sprintf("Expected allow to be false, which is unverifiable without a memory datastore, because datastore %q of type %q grants each query", datastore, dsType))
+			}
+		}
+	}
+	if test.Allow != nil && !unverifiable && decision.Allow != *test.Allow {
+		problems = append(problems, fmt.Sprintf("Expected allow to be %t, but was %t", *test.Allow, decision.Allow))
+	}
+
+	for _, datastore := range sortedKeys(test.Queries) {
+		expected, normalizeErr := normalizePolicyTestQueries(test.Queries[datastore])
+		var actual string
+		if normalizeErr == nil {
+			actual, normalizeErr = normalizePolicyTestQueries(queries[datastore])
+		}
+		if normalizeErr != nil {
+			problems = append(problems, fmt.Sprintf("Unable to compare queries of datastore %q: %s", datastore, normalizeErr.Error()))
+			continue
+		}
+
+		if expected != actual {
+			diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        diffLines(expected),
+				B:        diffLines(actual),
+				FromFile: "expected",
+				ToFile:   "actual",
+				Context:  3,
+			})
+			problems = append(problems, fmt.Sprintf("Queries of datastore %q differ:\n%s", datastore, diff))
+		}
+	}
+	return problems
+}
+
+// diffLines splits the text into lines, which keep their line break.
+func diffLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// normalizePolicyTestQueries converts the queries into YAML, so that expected and recorded queries are comparable independent of their types.
+func normalizePolicyTestQueries(queries []*policyTestQuery) (string, error) {
+	if queries == nil {
+		queries = []*policyTestQuery{}
+	}
+
+	raw, err := json.Marshal(queries)
+	if err != nil {
+		return "", err
+	}
+	var normalized interface{}
+	if err = json.Unmarshal(raw, &normalized); err != nil {
+		return "", err
+	}
+	out, err := yaml.Marshal(normalized)
+	return string(out), err
+}
+
+// loadPolicyTests loads the test cases of all JSON and YAML files inside the directory (file -> test cases).
+func loadPolicyTests(dir string) (map[string][]*policyTestCase, error) {
+	result := make(map[string][]*policyTestCase)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json", ".yml", ".yaml":
+			if entry.IsDir() {
+				return nil
+			}
+		default:
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		// JSON is a subset of YAML, therefore both formats are parsed the same way
+		var loaded policyTestFile
+		if err = yaml.NewDecoder(file).Decode(&loaded); err != nil && err != io.EOF {
+			return errors.Wrapf(err, "unable to parse test file %q", path)
+		}
+		for i, test := range loaded.Tests {
+			if test.Name == "" {
+				test.Name = fmt.Sprintf("#%d", i)
+			}
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		result[rel] = loaded.Tests
+		return nil
+	})
+	return result, err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/pkg/constants/logging"
+)
+
+const policyTestConfig = `apis:
+  - path-prefix: /api/mem
+    datastores:
+      - mem
+    authentication: false
+    mappings:
+      - path: /users/.*
+        package: users.mem
+  - path-prefix: /api/pg
+    datastores:
+      - pg
+    authentication: false
+    mappings:
+      - path: /users/.*
+        package: users.pg
+
+datastores:
+  mem:
+    type: memory
+    connection:
+      location: ./fixtures
+  pg:
+    type: postgres
+    connection:
+      host: localhost
+      port: 5432
+      database: appstore
+      user: kelon
+      password: kelon
+
+entity_schemas:
+  mem:
+    appstore:
+      entities:
+        - name: users
+  pg:
+    appstore:
+      entities:
+        - name: users
+`
+
+const policyTestPolicies = `package users.mem
+
+allow {
+	some u
+	data.mem.users[u].name == input.user
+}
+`
+
+const policyTestPgPolicies = `package users.pg
+
+allow {
+	some u
+	data.pg.users[u].name == input.user
+}
+`
+
+const policyTestFixtures = `appstore:
+  users:
+    - id: 1
+      name: Arnold
+`
+
+// newTestKelonConfiguration returns the configuration of a Kelon with default flags, which loads its policies from regoDir.
+func newTestKelonConfiguration(regoDir string) *KelonConfiguration {
+	var (
+		prefix    = "/v1"
+		skip      = false
+		logLevel  = "ALL"
+		cacheSize = 0
+		cacheTTL  = time.Duration(0)
+		strict    = false
+	)
+	return &KelonConfiguration{
+		PathPrefix:             &prefix,
+		RegoDir:                &regoDir,
+		AstSkipUnknown:         &skip,
+		AccessDecisionLogLevel: &logLevel,
+		DecisionCacheSize:      &cacheSize,
+		DecisionCacheTTL:       &cacheTTL,
+		StrictPolicyCheck:      &strict,
+	}
+}
+
+// runTestPolicyTests runs the passed test files (name -> content) against the test policies.
+func runTestPolicyTests(t *testing.T, files map[string]string) (bool, string) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	writeFile("fixtures/users.yml", policyTestFixtures)
+	writeFile("policies/mem.rego", policyTestPolicies)
+	writeFile("policies/pg.rego", policyTestPgPolicies)
+	for name, content := range files {
+		writeFile(filepath.Join("tests", name), content)
+	}
+
+	// Datastore locations are relative to the working directory
+	configPath := filepath.Join(dir, "kelon.yml")
+	writeFile("kelon.yml", policyTestConfig)
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	config := newTestKelonConfiguration(filepath.Join(dir, "policies"))
+	testDir := filepath.Join(dir, "tests")
+	config.ConfigPath, config.TestDir = &configPath, &testDir
+	k := &Kelon{configured: true, logger: logging.LogForComponent("main"), config: config}
+
+	var out bytes.Buffer
+	passed, err := k.runPolicyTests(&out)
+	require.NoError(t, err)
+	return passed, out.String()
+}
+
+func Test_runPolicyTests_Pass(t *testing.T) {
+	passed, out := runTestPolicyTests(t, map[string]string{
+		"mem.yml": `tests:
+  - name: known user
+    input: {method: GET, path: /api/mem/users/1, user: Arnold}
+    allow: true
+  - name: unknown user
+    input: {method: GET, path: /api/mem/users/1, user: Mallory}
+    allow: false
+`,
+		"pg.json": `{"tests": [{
+  "name": "granted",
+  "input": {"method": "GET", "path": "/api/pg/users/1", "user": "Arnold"},
+  "allow": true,
+  "queries": {"pg": [{"statement": "SELECT count(*) FROM appstore.users WHERE ($1 = appstore.users.name)", "parameters": ["Arnold"]}]}
+}]}`,
+	})
+
+	assert.True(t, passed)
+	assert.Equal(t, `PASS: mem.yml: known user
+PASS: mem.yml: unknown user
+PASS: pg.json: granted
+--------------------------------------------------------------------------------
+PASS: 3/3
+`, out)
+}
+
+func Test_runPolicyTests_Fail(t *testing.T) {
+	passed, out := runTestPolicyTests(t, map[string]string{
+		"mem.yml": `tests:
+  - name: wrong decision
+    input: {method: GET, path: /api/mem/users/1, user: Mallory}
+    allow: true
+`,
+		"pg.yml": `tests:
+  - name: wrong query
+    input: {method: GET, path: /api/pg/users/1, user: Arnold}
+    queries:
+      pg:
+        - statement: SELECT count(*) FROM appstore.users
+          parameters: [Arnold]
+  - name: unverifiable
+    input: {method: GET, path: /api/pg/users/1, user: Mallory}
+    allow: false
+`,
+	})
+
+	// A failed test run exits with a non-zero status
+	assert.False(t, passed)
+	assert.Equal(t, `FAIL: mem.yml: wrong decision
+    Expected allow to be true, but was false
+FAIL: pg.yml: wrong query
+    Queries of datastore "pg" differ:
+    --- expected
+    +++ actual
+    @@ -1,3 +1,3 @@
+     - parameters:
+         - Arnold
+    -  statement: SELECT count(*) FROM appstore.users
+    +  statement: SELECT count(*) FROM appstore.users WHERE ($1 = appstore.users.name)
+FAIL: pg.yml: unverifiable
+    Expected allow to be false, which is unverifiable without a memory datastore, because datastore "pg" of type "postgres" grants each query
+--------------------------------------------------------------------------------
+PASS: 0/3
+FAIL: 3/3
+`, out)
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/unbasical/kelon/configs"
+	dataInt "github.com/unbasical/kelon/internal/pkg/data"
+	requestInt "github.com/unbasical/kelon/internal/pkg/request"
+	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
+)
+
+// reloadConfig replaces the path mapper, the datastores and the translator of the running PolicyCompiler by new ones
+// which are built from the reloaded configuration.
+//
+// If the reloaded configuration can not be applied, Kelon keeps running with the previous configuration.
+func (k *Kelon) reloadConfig(loadedConf *configs.ExternalConfig) {
+	if k.compiler == nil || k.appConfig == nil {
+		k.logger.Warnln("Unable to reload configuration, because Kelon was not started yet!")
+		return
+	}
+	previous := k.appConfig
+
+	if !reflect.DeepEqual(previous.Global, loadedConf.Global) || !reflect.DeepEqual(previous.OPA, loadedConf.OPA) {
+		k.logger.Warnln("Changes of the configuration sections 'global' and 'opa' are only applied on restart!")
+	}
+
+	// Build config
+	config := new(configs.AppConfig)
+	config.Global = previous.Global
+	config.APIMappings = loadedConf.APIMappings
+	config.DatastoreSchemas = loadedConf.DatastoreSchemas
+	config.Datastores = loadedConf.Datastores
+	config.OPA = previous.OPA
+	config.MetricsProvider = previous.MetricsProvider
+	config.TraceProvider = previous.TraceProvider
+
+	ops, err := dataInt.LoadAllCallOperands(config.Datastores, k.config.OperandDir)
+	if err != nil {
+		k.logger.Errorln("Unable to reload configuration! Kelon keeps running with the previous configuration: ", err.Error())
+		return
+	}
+	config.CallOperands = ops
+
+	datastores, reused, err := dataInt.MakeReloadedDatastores(loadedConf, &previous.ExternalConfig, k.datastores, k.dsLoggingWriter, k.config.Validate)
+	if err != nil {
+		k.logger.Errorln("Unable to reload configuration! Kelon keeps running with the previous configuration: ", err.Error())
+		return
+	}
+
+	// Build new sub-components
+	var (
+		parser     = requestInt.NewURLProcessor()
+		mapper     = requestInt.NewPathMapper()
+		translator = translateInt.NewAstTranslator()
+	)
+	compConf := k.makePolicyCompilerConfig(parser, mapper, translator, previous.OPA, datastores)
+
+	// Swap components
+	if err := k.compiler.Reconfigure(config, &compConf); err != nil {
+		dataInt.CloseDatastores(datastores, reused)
+		k.logger.Errorln("Unable to reload configuration! Kelon keeps running with the previous configuration: ", err.Error())
+		return
+	}
+
+	// Previous datastores are not used anymore
+	dataInt.CloseDatastores(k.datastores, reused)
+	k.appConfig = config
+	k.datastores = datastores
+	k.logger.Infoln("Reloaded configuration")
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	dataInt "github.com/unbasical/kelon/internal/pkg/data"
+	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
+	"github.com/unbasical/kelon/pkg/opa"
+	_ "modernc.org/sqlite"
+)
+
+// reconfigureCompiler only implements Reconfigure() of the opa.PolicyCompiler
+type reconfigureCompiler struct {
+	opa.PolicyCompiler
+	err          error
+	reconfigured int
+}
+
+func (c *reconfigureCompiler) Reconfigure(_ *configs.AppConfig, _ *opa.PolicyCompilerConfig) error {
+	c.reconfigured++
+	return c.err
+}
+
+func newTestReloadConfig(sqliteFile string) *configs.ExternalConfig {
+	return &configs.ExternalConfig{
+		Datastores: map[string]*configs.Datastore{
+			"sqlite": {Type: data.TypeSqlite, Connection: map[string]string{"file": sqliteFile}},
+		},
+		DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+			"sqlite": {"main": {Entities: []*configs.Entity{{Name: "users"}}}},
+		},
+	}
+}
+
+// newTestReloadKelon returns a started Kelon whose datastore is backed by a SQLite file.
+func newTestReloadKelon(t *testing.T, compiler opa.PolicyCompiler) *Kelon {
+	file := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite", file)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	k := &Kelon{
+		configured: true,
+		logger:     logging.LogForComponent("main"),
+		config:     newTestKelonConfiguration(t.TempDir()),
+		compiler:   compiler,
+	}
+
+	loadedConf := newTestReloadConfig(file)
+	config := &configs.AppConfig{ExternalConfig: *loadedConf}
+	config.CallOperands, err = dataInt.LoadAllCallOperands(config.Datastores, nil)
+	require.NoError(t, err)
+
+	k.appConfig = config
+	k.datastores = dataInt.MakeDatastores(loadedConf, nil, false)
+	for alias, ds := range k.datastores {
+		require.NoError(t, (*ds).Configure(config, alias))
+	}
+	t.Cleanup(func() { dataInt.CloseDatastores(k.datastores, nil) })
+	return k
+}
+
+func assertDatastoreOpen(t *testing.T, ds *data.Datastore) {
+	query := data.Union{Clauses: []data.Node{data.Query{
+		From: data.Entity{Value: "users"},
+		Condition: data.Condition{Clause: data.Call{
+			Operator: data.Operator{Value: "eq"},
+			Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: "users"}, Name: "name"}, data.Constant{Value: "Arnold"}},
+		}},
+	}}}
+	_, err := (*ds).Execute(context.Background(), query)
+	assert.NoError(t, err)
+}
+
+func Test_reloadConfig_ReusesUnchangedDatastore(t *testing.T) {
+	compiler := &reconfigureCompiler{}
+	k := newTestReloadKelon(t, compiler)
+	previous := k.datastores["sqlite"]
+
+	k.reloadConfig(newTestReloadConfig(k.appConfig.Datastores["sqlite"].Connection["file"]))
+
+	assert.Equal(t, 1, compiler.reconfigured)
+	assert.NotSame(t, previous, k.datastores["sqlite"])
+	// The connection pool is shared with the new datastore, so it must not be closed
+	assertDatastoreOpen(t, previous)
+}
+
+func Test_reloadConfig_KeepsPreviousOnFailedReconfigure(t *testing.T) {
+	compiler := &reconfigureCompiler{err: errors.New("invalid mapping")}
+	k := newTestReloadKelon(t, compiler)
+	previousConfig, previousDatastores := k.appConfig, k.datastores
+
+	k.reloadConfig(newTestReloadConfig(k.appConfig.Datastores["sqlite"].Connection["file"]))
+
+	assert.Equal(t, 1, compiler.reconfigured)
+	assert.Same(t, previousConfig, k.appConfig)
+	assert.Equal(t, previousDatastores, k.datastores)
+	assertDatastoreOpen(t, k.datastores["sqlite"])
+}
+
+func Test_reloadConfig_KeepsPreviousOnInvalidDatastore(t *testing.T) {
+	compiler := &reconfigureCompiler{}
+	k := newTestReloadKelon(t, compiler)
+	previousConfig, previousDatastores := k.appConfig, k.datastores
+
+	loadedConf := newTestReloadConfig(k.appConfig.Datastores["sqlite"].Connection["file"])
+	loadedConf.Datastores["sqlite"].Type = "unknown"
+	k.reloadConfig(loadedConf)
+
+	assert.Equal(t, 0, compiler.reconfigured)
+	assert.Same(t, previousConfig, k.appConfig)
+	assert.Equal(t, previousDatastores, k.datastores)
+	assertDatastoreOpen(t, k.datastores["sqlite"])
+}
@@ -5,7 +5,7 @@ import (
 	"os"
 
 	"github.com/unbasical/kelon/configs"
-	"github.com/unbasical/kelon/internal/pkg/data"
+	dataInt "github.com/unbasical/kelon/internal/pkg/data"
 	opaInt "github.com/unbasical/kelon/internal/pkg/opa"
 	requestInt "github.com/unbasical/kelon/internal/pkg/request"
 	translateInt "github.com/unbasical/kelon/internal/pkg/translate"
@@ -61,7 +61,7 @@ func (k *Kelon) StartValidate() {
 
 	serverConf := k.makeServerConfig(compiler, parser, mapper, translator, loadedConf)
 
-	config.CallOperands, err = data.LoadAllCallOperands(config.Datastores, k.config.OperandDir)
+	config.CallOperands, err = dataInt.LoadAllCallOperands(config.Datastores, k.config.OperandDir)
 	if err != nil {
 		k.logger.Fatalln(err.Error())
 	}
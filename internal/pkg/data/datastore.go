@@ -23,6 +23,10 @@ var (
 	userKey = "user"
 	//nolint:gochecknoglobals,gocritic
 	pwKey = "password"
+	//nolint:gochecknoglobals,gocritic
+	fileKey = "file"
+	//nolint:gochecknoglobals,gocritic
+	locationKey = "location"
 )
 
 func extractAndValidateDatastore(appConf *configs.AppConfig, alias string) (*configs.Datastore, error) {
@@ -40,7 +44,7 @@ func extractAndValidateDatastore(appConf *configs.AppConfig, alias string) (*con
 	if strings.EqualFold(conf.Type, "") {
 		return nil, errors.Errorf("Alias of datastore is empty! Must be one of %+v!", sql.Drivers())
 	}
-	if err := validateConnection(alias, conf.Connection); err != nil {
+	if err := validateConnection(alias, conf.Type, conf.Connection); err != nil {
 		return nil, err
 	}
 
@@ -63,7 +67,20 @@ func pingUntilReachable(alias string, ping func() error) error {
 	return nil
 }
 
-func validateConnection(alias string, conn map[string]string) error {
+func validateConnection(alias, platform string, conn map[string]string) error {
+	if platform == data.TypeSqlite {
+		if _, ok := conn[fileKey]; !ok {
+			return errors.Errorf("SqlDatastore: Field %s is missing in configured connection with alias %s!", fileKey, alias)
+		}
+		return nil
+	}
+	if platform == data.TypeMemory {
+		if _, ok := conn[locationKey]; !ok {
+			return errors.Errorf("MemoryDatastore: Field %s is missing in configured connection with alias %s!", locationKey, alias)
+		}
+		return nil
+	}
+
 	if _, ok := conn[hostKey]; !ok {
 		return errors.Errorf("SqlDatastore: Field %s is missing in configured connection with alias %s!", hostKey, alias)
 	}
@@ -92,6 +109,8 @@ func getConnectionStringForPlatform(platform string, conn map[string]string) str
 		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s%s", user, password, host, port, dbname, createConnOptionsString(options, "&", "?"))
 	case data.TypeMongo:
 		return fmt.Sprintf("mongodb://%s:%s@%s:%s/%s%s", user, password, host, port, dbname, createConnOptionsString(options, "&", "?"))
+	case data.TypeSqlite:
+		return getSqliteConnectionString(conn)
 	default:
 		logging.LogForComponent("datastore").Panic(fmt.Sprintf("Platform [%s] is not a supported DatastoreTranslator!", platform))
 		return ""
@@ -102,7 +121,7 @@ func getPreparePlaceholderForPlatform(platform string, argCounter int) string {
 	switch platform {
 	case data.TypePostgres:
 		return fmt.Sprintf("$%d", argCounter)
-	case data.TypeMysql:
+	case data.TypeMysql, data.TypeSqlite:
 		return "?"
 	default:
 		logging.LogForComponent("datastore").Panic(fmt.Sprintf("Platform [%s] is not a supported for prepared statements!", platform))
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"io"
 
 	"github.com/pkg/errors"
 	"github.com/unbasical/kelon/configs"
@@ -71,3 +72,20 @@ func (ds *defaultDatastore) Execute(ctx context.Context, astQuery data.Node) (bo
 	// Execute native Query
 	return ds.executor.Execute(ctx, dsQuery)
 }
+
+func (ds *defaultDatastore) Filter(ctx context.Context, astQuery data.Node) (data.DatastoreQuery, error) {
+	if !ds.configured {
+		return data.DatastoreQuery{}, errors.Errorf("Datastore: Datastore was not configured! Please call Configure().")
+	}
+
+	// Translate Query-AST to native filter without executing it
+	return ds.translator.Filter(ctx, astQuery)
+}
+
+// Close closes the executor of the datastore if it holds any resources (i.e. a connection pool).
+func (ds *defaultDatastore) Close() error {
+	if closer, ok := ds.executor.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package data
 
 import (
 	"io"
+	"reflect"
 
+	"github.com/pkg/errors"
 	"github.com/unbasical/kelon/configs"
 	"github.com/unbasical/kelon/pkg/constants/logging"
 	"github.com/unbasical/kelon/pkg/data"
@@ -15,40 +17,134 @@ func MakeDatastores(config *configs.ExternalConfig, dsLoggingWriter io.Writer, l
 	return makeExecutingDatastores(config)
 }
 
+// MakeReloadedDatastores creates the datastores for a reloaded configuration in the same mode as MakeDatastores.
+//
+// The executors (and therefore the connection pools) of the previous datastores are reused for all datastores
+// whose settings did not change. The aliases of these datastores are returned as well, so that
+// only the unused datastores are closed with CloseDatastores afterwards.
+//
+// Only executors which hold connections are reused. They are not configured again and keep the previous AppConfig,
+// which is fine because they only read the settings of their own datastore, which are unchanged.
+// All other executors (i.e. the ones of memory datastores) are rebuilt so that they load their fixtures again.
+func MakeReloadedDatastores(config, previousConfig *configs.ExternalConfig, previous map[string]*data.Datastore, dsLoggingWriter io.Writer, loggingMode bool) (result map[string]*data.Datastore, reused map[string]bool, err error) {
+	result = make(map[string]*data.Datastore)
+	reused = make(map[string]bool)
+	for dsName, ds := range config.Datastores {
+		if loggingMode {
+			newDs, dsErr := newLoggingDatastore(ds, dsLoggingWriter)
+			if dsErr != nil {
+				return nil, nil, dsErr
+			}
+			result[dsName] = &newDs
+			continue
+		}
+
+		newDs, dsErr := newExecutingDatastore(ds)
+		if dsErr != nil {
+			return nil, nil, dsErr
+		}
+
+		// Reuse executor if the settings of the datastore did not change
+		if previousDs, ok := previous[dsName]; ok && reflect.DeepEqual(previousConfig.Datastores[dsName], ds) {
+			if previousDefault, isDefault := (*previousDs).(*defaultDatastore); isDefault {
+				if _, holdsConnections := previousDefault.executor.(io.Closer); holdsConnections {
+					newDs = NewDatastore(newDs.(*defaultDatastore).translator, previousDefault.executor)
+					reused[dsName] = true
+					logging.LogForComponent("factory").Infof("Reuse connections of datastore with alias [%s]", dsName)
+				}
+			}
+		}
+		result[dsName] = &newDs
+	}
+	return result, reused, nil
+}
+
+// CloseDatastores closes all datastores except the ones whose alias is skipped.
+func CloseDatastores(datastores map[string]*data.Datastore, skip map[string]bool) {
+	for dsName, ds := range datastores {
+		if skip[dsName] {
+			continue
+		}
+		if closer, ok := (*ds).(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logging.LogForComponent("factory").Warnf("Unable to close datastore with alias [%s]: %s", dsName, err.Error())
+			}
+		}
+	}
+}
+
 func makeExecutingDatastores(config *configs.ExternalConfig) map[string]*data.Datastore {
 	result := make(map[string]*data.Datastore)
 	for dsName, ds := range config.Datastores {
-		switch {
-		case ds.Type == data.TypeMysql || ds.Type == data.TypePostgres:
-			newDs := NewDatastore(NewSQLDatastoreTranslator(), NewSQLDatastoreExecutor())
-			logging.LogForComponent("factory").Infof("Init SqlDatastore of type [%s] with alias [%s]", ds.Type, dsName)
-			result[dsName] = &newDs
-		case ds.Type == data.TypeMongo:
-			newDs := NewDatastore(NewMongoDatastoreTranslator(), NewMongoDatastoreExecuter())
-			logging.LogForComponent("factory").Infof("Init MongoDatastore of type [%s] with alias [%s]", ds.Type, dsName)
-			result[dsName] = &newDs
-		default:
-			logging.LogForComponent("factory").Fatalf("Unable to init datastore of type %q! Type is not supported yet!", ds.Type)
+		newDs, err := newExecutingDatastore(ds)
+		if err != nil {
+			logging.LogForComponent("factory").Fatal(err.Error())
 		}
+		logging.LogForComponent("factory").Infof("Init Datastore of type [%s] with alias [%s]", ds.Type, dsName)
+		result[dsName] = &newDs
 	}
 	return result
 }
 
-func makeLoggingDatastores(config *configs.ExternalConfig, dsLoggingWriter io.Writer) map[string]*data.Datastore {
+func newExecutingDatastore(ds *configs.Datastore) (data.Datastore, error) {
+	switch {
+	case ds.Type == data.TypeMysql || ds.Type == data.TypePostgres || ds.Type == data.TypeSqlite:
+		return NewDatastore(NewSQLDatastoreTranslator(), NewSQLDatastoreExecutor()), nil
+	case ds.Type == data.TypeMongo:
+		return NewDatastore(NewMongoDatastoreTranslator(), NewMongoDatastoreExecuter()), nil
+	case ds.Type == data.TypeMemory:
+		return NewDatastore(NewMemoryDatastoreTranslator(), NewMemoryDatastoreExecutor()), nil
+	default:
+		return nil, errors.Errorf("Unable to init datastore of type %q! Type is not supported yet!", ds.Type)
+	}
+}
+
+// MakeTestDatastores creates the datastores which are used to run policy tests. Each executed query is passed to record.
+//
+// Datastores of type memory evaluate the queries against their fixtures, all other datastores
+// grant access for each query like the datastores of the validate mode.
+func MakeTestDatastores(config *configs.ExternalConfig, record func(alias string, query data.DatastoreQuery)) (map[string]*data.Datastore, error) {
 	result := make(map[string]*data.Datastore)
 	for dsName, ds := range config.Datastores {
+		var newDs data.Datastore
 		switch {
-		case ds.Type == data.TypeMysql || ds.Type == data.TypePostgres:
-			newDs := NewDatastore(NewSQLDatastoreTranslator(), NewLoggingDatastoreExecutor(dsLoggingWriter))
-			logging.LogForComponent("factory").Infof("Init DryRun SqlDatastore of type [%s] with alias [%s]", ds.Type, dsName)
-			result[dsName] = &newDs
+		case ds.Type == data.TypeMysql || ds.Type == data.TypePostgres || ds.Type == data.TypeSqlite:
+			newDs = NewDatastore(NewSQLDatastoreTranslator(), NewRecordingDatastoreExecutor(NewLoggingDatastoreExecutor(io.Discard), record))
 		case ds.Type == data.TypeMongo:
-			newDs := NewDatastore(NewMongoDatastoreTranslator(), NewLoggingDatastoreExecutor(dsLoggingWriter))
-			logging.LogForComponent("factory").Infof("Init DryRun MongoDatastore of type [%s] with alias [%s]", ds.Type, dsName)
-			result[dsName] = &newDs
+			newDs = NewDatastore(NewMongoDatastoreTranslator(), NewRecordingDatastoreExecutor(NewLoggingDatastoreExecutor(io.Discard), record))
+		case ds.Type == data.TypeMemory:
+			newDs = NewDatastore(NewMemoryDatastoreTranslator(), NewRecordingDatastoreExecutor(NewMemoryDatastoreExecutor(), record))
 		default:
-			logging.LogForComponent("factory").Fatalf("Unable to init datastore of type %q! Type is not supported yet!", ds.Type)
+			return nil, errors.Errorf("Unable to init datastore of type %q! Type is not supported yet!", ds.Type)
+		}
+		logging.LogForComponent("factory").Debugf("Init TestDatastore of type [%s] with alias [%s]", ds.Type, dsName)
+		result[dsName] = &newDs
+	}
+	return result, nil
+}
+
+func makeLoggingDatastores(config *configs.ExternalConfig, dsLoggingWriter io.Writer) map[string]*data.Datastore {
+	result := make(map[string]*data.Datastore)
+	for dsName, ds := range config.Datastores {
+		newDs, err := newLoggingDatastore(ds, dsLoggingWriter)
+		if err != nil {
+			logging.LogForComponent("factory").Fatal(err.Error())
 		}
+		logging.LogForComponent("factory").Infof("Init DryRun Datastore of type [%s] with alias [%s]", ds.Type, dsName)
+		result[dsName] = &newDs
 	}
 	return result
 }
+
+func newLoggingDatastore(ds *configs.Datastore, dsLoggingWriter io.Writer) (data.Datastore, error) {
+	switch {
+	case ds.Type == data.TypeMysql || ds.Type == data.TypePostgres || ds.Type == data.TypeSqlite:
+		return NewDatastore(NewSQLDatastoreTranslator(), NewLoggingDatastoreExecutor(dsLoggingWriter)), nil
+	case ds.Type == data.TypeMongo:
+		return NewDatastore(NewMongoDatastoreTranslator(), NewLoggingDatastoreExecutor(dsLoggingWriter)), nil
+	case ds.Type == data.TypeMemory:
+		return NewDatastore(NewMemoryDatastoreTranslator(), NewLoggingDatastoreExecutor(dsLoggingWriter)), nil
+	default:
+		return nil, errors.Errorf("Unable to init datastore of type %q! Type is not supported yet!", ds.Type)
+	}
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+func newTestFactoryConfig(sqliteFile string) *configs.ExternalConfig {
+	return &configs.ExternalConfig{
+		Datastores: map[string]*configs.Datastore{
+			"sqlite": {Type: data.TypeSqlite, Connection: map[string]string{"file": sqliteFile}},
+			"memory": {Type: data.TypeMemory, Connection: map[string]string{"location": "./fixtures"}},
+		},
+	}
+}
+
+func executorOf(t *testing.T, ds *data.Datastore) data.DatastoreExecutor {
+	defaultDs, ok := (*ds).(*defaultDatastore)
+	require.True(t, ok)
+	return defaultDs.executor
+}
+
+func Test_MakeReloadedDatastores_ReusesConnections(t *testing.T) {
+	previousConfig := newTestFactoryConfig("./users.db")
+	previous := MakeDatastores(previousConfig, io.Discard, false)
+
+	result, reused, err := MakeReloadedDatastores(newTestFactoryConfig("./users.db"), previousConfig, previous, io.Discard, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"sqlite": true}, reused)
+	assert.Same(t, executorOf(t, previous["sqlite"]), executorOf(t, result["sqlite"]))
+	assert.NotSame(t, previous["sqlite"], result["sqlite"])
+
+	// Memory executors are rebuilt to reload their fixtures
+	assert.NotSame(t, executorOf(t, previous["memory"]), executorOf(t, result["memory"]))
+}
+
+func Test_MakeReloadedDatastores_ChangedConnection(t *testing.T) {
+	previousConfig := newTestFactoryConfig("./users.db")
+	previous := MakeDatastores(previousConfig, io.Discard, false)
+
+	result, reused, err := MakeReloadedDatastores(newTestFactoryConfig("./other.db"), previousConfig, previous, io.Discard, false)
+	require.NoError(t, err)
+	assert.Empty(t, reused)
+	assert.NotSame(t, executorOf(t, previous["sqlite"]), executorOf(t, result["sqlite"]))
+}
+
+func Test_MakeReloadedDatastores_LoggingMode(t *testing.T) {
+	previousConfig := newTestFactoryConfig("./users.db")
+	previous := MakeDatastores(previousConfig, io.Discard, true)
+
+	result, reused, err := MakeReloadedDatastores(newTestFactoryConfig("./users.db"), previousConfig, previous, io.Discard, true)
+	require.NoError(t, err)
+	assert.Empty(t, reused)
+	for alias, ds := range result {
+		assert.IsType(t, &loggingDatastoreExecutor{}, executorOf(t, ds), alias)
+	}
+}
+
+func Test_MakeReloadedDatastores_UnsupportedType(t *testing.T) {
+	previousConfig := newTestFactoryConfig("./users.db")
+	config := newTestFactoryConfig("./users.db")
+	config.Datastores["unknown"] = &configs.Datastore{Type: "unknown"}
+
+	for _, loggingMode := range []bool{false, true} {
+		_, _, err := MakeReloadedDatastores(config, previousConfig, map[string]*data.Datastore{}, io.Discard, loggingMode)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
+	"gopkg.in/yaml.v3"
+)
+
+// memoryFixtures contains all rows of all entities (schema -> entity -> rows).
+type memoryFixtures map[string]map[string][]map[string]interface{}
+
+type memoryDatastoreExecutor struct {
+	appConf    *configs.AppConfig
+	alias      string
+	fixtures   memoryFixtures
+	configured bool
+}
+
+// NewMemoryDatastoreExecutor Returns a new data.DatastoreExecutor which evaluates statements against fixtures loaded from JSON or YAML files.
+func NewMemoryDatastoreExecutor() data.DatastoreExecutor {
+	return &memoryDatastoreExecutor{
+		appConf:    nil,
+		alias:      "",
+		configured: false,
+	}
+}
+
+func (ds *memoryDatastoreExecutor) Configure(appConf *configs.AppConfig, alias string) error {
+	// Exit if already configured
+	if ds.configured {
+		return nil
+	}
+
+	// Validate config
+	conf, e := extractAndValidateDatastore(appConf, alias)
+	if e != nil {
+		return errors.Wrap(e, "MemoryDatastoreExecutor:")
+	}
+
+	// Load fixtures
+	fixtures, err := loadMemoryFixtures(conf.Connection[locationKey])
+	if err != nil {
+		return errors.Wrapf(err, "MemoryDatastoreExecutor: Unable to load fixtures of datastore with alias [%s]", alias)
+	}
+
+	ds.appConf = appConf
+	ds.alias = alias
+	ds.fixtures = fixtures
+	ds.configured = true
+	logging.LogForComponent("memoryDatastoreExecutor").Infof("Configured [%s]", alias)
+	return nil
+}
+
+func (ds *memoryDatastoreExecutor) Execute(ctx context.Context, query data.DatastoreQuery) (bool, error) {
+	statement, ok := query.Statement.(memoryStatement)
+	if !ok {
+		return false, errors.Errorf("MemoryDatastoreExecutor: Passed statement was not of type memoryStatement but of type: %T", query.Statement)
+	}
+
+	for _, q := range statement {
+		if err := ctx.Err(); err != nil {
+			return false, errors.Wrap(err, "MemoryDatastoreExecutor: Execution aborted")
+		}
+
+		matched, err := ds.matches(q, 0, memoryRow{})
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			logging.LogForComponent("memoryDatastoreExecutor").Debugf("Matching rows found for query %s -> ALLOWED", q)
+			return true, nil
+		}
+	}
+
+	logging.LogForComponent("memoryDatastoreExecutor").Debugf("No matching rows found! -> DENIED")
+	return false, nil
+}
+
+// matches binds the rows of all entities starting with the entity at the passed index and evaluates the condition for each combination.
+func (ds *memoryDatastoreExecutor) matches(q memoryQuery, index int, row memoryRow) (bool, error) {
+	if index == len(q.entities) {
+		result, err := q.condition.evaluate(row)
+		return result == true, err
+	}
+
+	entity := q.entities[index]
+	for _, r := range ds.fixtures[entity.schema][entity.name] {
+		row[entity.identifier] = r
+		if matched, err := ds.matches(q, index+1, row); err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// loadMemoryFixtures loads the fixtures from a single file or from all JSON and YAML files inside a directory.
+// Rows of the same entity in different files are merged.
+func loadMemoryFixtures(location string) (memoryFixtures, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to access fixtures")
+	}
+
+	files := []string{location}
+	if info.IsDir() {
+		entries, dirErr := os.ReadDir(location)
+		if dirErr != nil {
+			return nil, errors.Wrap(dirErr, "unable to read fixtures directory")
+		}
+
+		files = nil
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".json", ".yml", ".yaml":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(location, entry.Name()))
+				}
+			}
+		}
+	}
+
+	result := make(memoryFixtures)
+	for _, file := range files {
+		content, readErr := os.ReadFile(file)
+		if readErr != nil {
+			return nil, errors.Wrapf(readErr, "unable to read fixtures file %q", file)
+		}
+
+		// JSON is a subset of YAML, therefore both formats are parsed the same way
+		var loaded memoryFixtures
+		if parseErr := yaml.Unmarshal(content, &loaded); parseErr != nil {
+			return nil, errors.Wrapf(parseErr, "unable to parse fixtures file %q", file)
+		}
+		for schema, entities := range loaded {
+			if _, ok := result[schema]; !ok {
+				result[schema] = make(map[string][]map[string]interface{})
+			}
+			for entity, rows := range entities {
+				for _, r := range rows {
+					normalizeMemoryValue(r)
+				}
+				result[schema][entity] = append(result[schema][entity], rows...)
+			}
+		}
+	}
+	return result, nil
+}
+
+// normalizeMemoryValue converts all numbers of a loaded fixture value to float64.
+func normalizeMemoryValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = normalizeMemoryValue(nested)
+		}
+		return v
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = normalizeMemoryValue(nested)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,621 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+type memoryDatastoreTranslator struct {
+	appConf *configs.AppConfig
+	alias   string
+	schemas map[string]*configs.EntitySchema
+	// Maps each call-operand to the name of a memory operator
+	callOps    map[string]func(args ...string) (string, error)
+	configured bool
+}
+
+// memoryStatement is the native query of the memory datastore, which is a union of all contained queries.
+type memoryStatement []memoryQuery
+
+// memoryQuery matches if any combination of the rows of its entities satisfies the condition.
+type memoryQuery struct {
+	entities  []memoryEntity
+	condition memoryExpression
+}
+
+// memoryEntity references the rows of the entity with the given name inside a schema under the name which is used in the query.
+type memoryEntity struct {
+	identifier string
+	schema     string
+	name       string
+}
+
+// NewMemoryDatastoreTranslator Returns a new data.DatastoreTranslator which translates the Query-AST into statements of the memory datastore.
+func NewMemoryDatastoreTranslator() data.DatastoreTranslator {
+	return &memoryDatastoreTranslator{
+		appConf:    nil,
+		alias:      "",
+		callOps:    nil,
+		configured: false,
+	}
+}
+
+func (ds *memoryDatastoreTranslator) Configure(appConf *configs.AppConfig, alias string) error {
+	// Exit if already configured
+	if ds.configured {
+		return nil
+	}
+
+	// Validate config
+	conf, e := extractAndValidateDatastore(appConf, alias)
+	if e != nil {
+		return errors.Wrap(e, "MemoryDatastoreTranslator:")
+	}
+	if schemas, ok := appConf.DatastoreSchemas[alias]; ok {
+		if len(schemas) == 0 {
+			return errors.Errorf("MemoryDatastoreTranslator: DatastoreTranslator with alias [%s] has no schemas configured!", alias)
+		}
+
+		for schemaName, schema := range schemas {
+			if schema.HasNestedEntities() {
+				return errors.Errorf("MemoryDatastoreTranslator: Schema %q in datastore with alias [%s] contains nested entities which is not supported by Memory-Datastores yet!", schemaName, alias)
+			}
+		}
+	} else {
+		return errors.Errorf("MemoryDatastoreTranslator: DatastoreTranslator with alias [%s] has no entity-schema-mapping configured!", alias)
+	}
+
+	// Load call handlers
+	operands, ok := appConf.CallOperands[conf.Type]
+	if !ok {
+		return errors.Errorf("no call-operands found for datastore with type [%s]", conf.Type)
+	}
+	ds.callOps = operands
+	logging.LogForComponent("memoryDatastoreTranslator").Infof("[%s] loaded call operands", alias)
+
+	// Assign values
+	ds.schemas = appConf.DatastoreSchemas[alias]
+	ds.appConf = appConf
+	ds.alias = alias
+	ds.configured = true
+	logging.LogForComponent("memoryDatastoreTranslator").Infof("Configured [%s]", alias)
+	return nil
+}
+
+func (ds *memoryDatastoreTranslator) Execute(ctx context.Context, query data.Node) (data.DatastoreQuery, error) {
+	if !ds.configured {
+		return data.DatastoreQuery{}, errors.Errorf("MemoryDatastoreTranslator: Datastore was not configured! Please call Configure().")
+	}
+	logging.LogForComponent("memoryDatastoreTranslator").Debugf("TRANSLATING QUERY: ==================%+v==================", query.String())
+
+	statement, err := ds.translate(query)
+	if err != nil {
+		return data.DatastoreQuery{}, err
+	}
+
+	logging.LogForComponent("memoryDatastoreTranslator").Debugf("EXECUTING STATEMENT: ==================%s==================", statement)
+	return data.DatastoreQuery{Statement: statement}, nil
+}
+
+func (ds *memoryDatastoreTranslator) Filter(ctx context.Context, query data.Node) (data.DatastoreQuery, error) {
+	// Statements of the memory datastore are evaluated in process, so they are returned as they are
+	return ds.Execute(ctx, query)
+}
+
+func (ds *memoryDatastoreTranslator) translate(input data.Node) (memoryStatement, error) {
+	union, ok := input.(data.Union)
+	if !ok {
+		return nil, errors.Errorf("MemoryDatastoreTranslator: Expected query of type %T, but got %T", data.Union{}, input)
+	}
+
+	statement := make(memoryStatement, 0, len(union.Clauses))
+	for _, clause := range union.Clauses {
+		query, ok := clause.(data.Query)
+		if !ok {
+			return nil, errors.Errorf("MemoryDatastoreTranslator: Unexpected input: %T -> %+v", clause, clause)
+		}
+
+		// Resolve all entities which are iterated by the query
+		var translated memoryQuery
+		identifiers := make(map[string]bool)
+		for _, e := range append([]data.Entity{query.From}, query.Link.Entities...) {
+			schema, entity, err := ds.findSchemaForEntity(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			translated.entities = append(translated.entities, memoryEntity{identifier: e.Name(), schema: schema, name: entity.Name})
+			identifiers[e.Name()] = true
+		}
+
+		// Compile condition
+		condition, err := ds.compile(query.Condition.Clause, identifiers)
+		if err != nil {
+			return nil, err
+		}
+		translated.condition = condition
+		statement = append(statement, translated)
+	}
+	return statement, nil
+}
+
+// nolint:gocyclo
+func (ds *memoryDatastoreTranslator) compile(input data.Node, identifiers map[string]bool) (memoryExpression, error) {
+	switch v := input.(type) {
+	case nil:
+		// Queries without condition match all rows
+		return memoryLogical{operator: "AND"}, nil
+	case data.Condition:
+		return ds.compile(v.Clause, identifiers)
+	case data.Conjunction, data.Disjunction:
+		operator, clauses := "AND", []data.Node(nil)
+		if conjunction, ok := v.(data.Conjunction); ok {
+			clauses = conjunction.Clauses
+		} else {
+			operator, clauses = "OR", v.(data.Disjunction).Clauses
+		}
+
+		logical := memoryLogical{operator: operator}
+		for _, clause := range clauses {
+			compiled, err := ds.compile(clause, identifiers)
+			if err != nil {
+				return nil, err
+			}
+			logical.clauses = append(logical.clauses, compiled)
+		}
+		return logical, nil
+	case data.Negation:
+		compiled, err := ds.compile(v.Clause, identifiers)
+		if err != nil {
+			return nil, err
+		}
+		return memoryNegation{clause: compiled}, nil
+	case data.Call:
+		if operand, negated, isNullComparison := memoryNullComparison(v); isNullComparison {
+			compiled, err := ds.compile(operand, identifiers)
+			if err != nil {
+				return nil, err
+			}
+			return memoryNullCheck{operand: compiled, negated: negated}, nil
+		}
+
+		return ds.compileCall(v, identifiers)
+	case data.Attribute:
+		if !identifiers[v.Entity.Name()] {
+			return nil, errors.Errorf("MemoryDatastoreTranslator: Attribute %s references entity %q which is not part of the query", v.Name, v.Entity.Name())
+		}
+		return memoryAttribute{entity: v.Entity.Name(), name: v.Name}, nil
+	case *data.Constant:
+		return ds.compile(*v, identifiers)
+	case data.Constant:
+		return memoryConstant{value: memoryConstantValue(v)}, nil
+	case data.Collection:
+		values := make([]interface{}, len(v.Values))
+		for i, constant := range v.Values {
+			values[i] = memoryConstantValue(constant)
+		}
+		return memoryConstant{value: values}, nil
+	default:
+		return nil, errors.Errorf("MemoryDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
+	}
+}
+
+// compileCall resolves the memory operator of the call's call-operand and compiles the call into an application of the operator.
+// Calls with an additional operand compare the result of the operator with this operand.
+func (ds *memoryDatastoreTranslator) compileCall(call data.Call, identifiers map[string]bool) (memoryExpression, error) {
+	callOp, ok := ds.callOps[call.Operator.String()]
+	if !ok {
+		return nil, errors.Errorf("MemoryDatastoreTranslator: Datastore %q has no call-operand for operator %q", ds.alias, call.Operator.String())
+	}
+	name, err := callOp()
+	if err != nil {
+		return nil, errors.Wrap(err, "MemoryDatastoreTranslator: Error while mapping call-operand")
+	}
+	operator, ok := memoryOperators[name]
+	if !ok {
+		return nil, errors.Errorf("MemoryDatastoreTranslator: Call-operand %q is mapped to unknown operator %q", call.Operator.String(), name)
+	}
+	if len(call.Operands) != operator.args && len(call.Operands) != operator.args+1 {
+		return nil, errors.Errorf("MemoryDatastoreTranslator: Operator %q expects %d or %d operands, but got %d", name, operator.args, operator.args+1, len(call.Operands))
+	}
+
+	operands := make([]memoryExpression, len(call.Operands))
+	for i, operand := range call.Operands {
+		compiled, err := ds.compile(operand, identifiers)
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = compiled
+	}
+
+	if len(operands) > operator.args {
+		result := memoryCall{operator: name, args: operands[:operator.args]}
+		return memoryCall{operator: "eq", args: []memoryExpression{result, operands[operator.args]}}, nil
+	}
+	return memoryCall{operator: name, args: operands}, nil
+}
+
+// memoryConstantValue returns the value of the constant, whereby all numbers are converted to float64 like the values of the fixtures.
+func memoryConstantValue(c data.Constant) interface{} {
+	switch v := c.Value.(type) {
+	case int64:
+		return float64(v)
+	case json.Number:
+		if number, err := v.Float64(); err == nil {
+			return number
+		}
+		return v.String()
+	default:
+		return c.Value
+	}
+}
+
+// memoryNullComparison returns the operand which is compared with null by an (in)equality call and whether the comparison is negated.
+// False is returned for all other calls.
+func memoryNullComparison(call data.Call) (data.Node, bool, bool) {
+	op := call.Operator.String()
+	if len(call.Operands) != 2 || (op != "eq" && op != "equal" && op != "neq") {
+		return nil, false, false
+	}
+	for i, operand := range call.Operands {
+		if isNullConstant(operand) {
+			return call.Operands[1-i], op == "neq", true
+		}
+	}
+	return nil, false, false
+}
+
+func isNullConstant(node data.Node) bool {
+	switch v := node.(type) {
+	case data.Constant:
+		return v.IsNull()
+	case *data.Constant:
+		return v.IsNull()
+	default:
+		return false
+	}
+}
+
+func (ds *memoryDatastoreTranslator) findSchemaForEntity(search string) (string, *configs.Entity, error) {
+	for schema, es := range ds.schemas {
+		if found, entity := es.ContainsEntity(search); found {
+			return schema, entity, nil
+		}
+	}
+	return "", &configs.Entity{}, errors.Errorf("MemoryDatastoreTranslator: No schema found for entity %s in datastore with alias %s", search, ds.alias)
+}
+
+// Implements fmt.Stringer
+func (s memoryStatement) String() string {
+	queries := make([]string, len(s))
+	for i, q := range s {
+		queries[i] = q.String()
+	}
+	return strings.Join(queries, " UNION ")
+}
+
+// MarshalText implements encoding.TextMarshaler, so that statements can be logged
+func (s memoryStatement) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Implements fmt.Stringer
+func (q memoryQuery) String() string {
+	entities := make([]string, len(q.entities))
+	for i, e := range q.entities {
+		entities[i] = fmt.Sprintf("%s.%s AS %s", e.schema, e.name, e.identifier)
+	}
+	return fmt.Sprintf("FROM %s WHERE %s", strings.Join(entities, ", "), q.condition.String())
+}
+
+// memoryRow binds each entity of a query to one of its rows (entity -> attribute -> value).
+type memoryRow map[string]map[string]interface{}
+
+// memoryExpression is a compiled expression which is evaluated against the rows of the memory datastore.
+type memoryExpression interface {
+	// Evaluate the expression for the given row.
+	evaluate(row memoryRow) (interface{}, error)
+
+	// Get the expression as human-readable string.
+	String() string
+}
+
+// memoryOperator is a Go function which is applied to the evaluated operands of a call.
+type memoryOperator struct {
+	args int
+	fn   func(args ...interface{}) (interface{}, error)
+}
+
+// Operators of the memory datastore, which are the targets of its call-operands.
+// Missing values result in missing values, except for comparisons which are false.
+//
+//nolint:gochecknoglobals,gocritic
+var memoryOperators = map[string]memoryOperator{
+	// Mathematical operators
+	"plus":  memoryArithmetic("plus", func(l, r float64) interface{} { return l + r }),
+	"minus": memoryArithmetic("minus", func(l, r float64) interface{} { return l - r }),
+	"mul":   memoryArithmetic("mul", func(l, r float64) interface{} { return l * r }),
+	"div": memoryArithmetic("div", func(l, r float64) interface{} {
+		if r == 0 {
+			return nil
+		}
+		return l / r
+	}),
+	"rem": memoryArithmetic("rem", func(l, r float64) interface{} {
+		if r == 0 {
+			return nil
+		}
+		return math.Mod(l, r)
+	}),
+
+	// Relational operators
+	"eq":    {args: 2, fn: func(args ...interface{}) (interface{}, error) { return equalMemoryValues(args[0], args[1]), nil }},
+	"equal": {args: 2, fn: func(args ...interface{}) (interface{}, error) { return equalMemoryValues(args[0], args[1]), nil }},
+	"neq": {args: 2, fn: func(args ...interface{}) (interface{}, error) {
+		return args[0] != nil && args[1] != nil && !equalMemoryValues(args[0], args[1]), nil
+	}},
+	"lt":  memoryComparison(func(comparison int) bool { return comparison < 0 }),
+	"gt":  memoryComparison(func(comparison int) bool { return comparison > 0 }),
+	"lte": memoryComparison(func(comparison int) bool { return comparison <= 0 }),
+	"gte": memoryComparison(func(comparison int) bool { return comparison >= 0 }),
+
+	// Membership operators
+	"internal.member_2": {args: 2, fn: func(args ...interface{}) (interface{}, error) {
+		values, ok := args[1].([]interface{})
+		if !ok {
+			return nil, errors.Errorf("MemoryDatastore: Operator internal.member_2 expects a collection, but got %T", args[1])
+		}
+		return slices.ContainsFunc(values, func(value interface{}) bool { return equalMemoryValues(args[0], value) }), nil
+	}},
+
+	// Mathematical functions
+	"abs": {args: 1, fn: func(args ...interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		if number, ok := toMemoryNumber(args[0]); ok {
+			return math.Abs(number), nil
+		}
+		return nil, errors.Errorf("MemoryDatastore: Operator abs expects a number, but got %T", args[0])
+	}},
+
+	// String functions
+	"lower": memoryStringFunction("lower", strings.ToLower),
+	"upper": memoryStringFunction("upper", strings.ToUpper),
+}
+
+// memoryArithmetic returns an operator which calculates the result of two numbers (or numeric strings).
+func memoryArithmetic(name string, calculate func(l, r float64) interface{}) memoryOperator {
+	return memoryOperator{args: 2, fn: func(args ...interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		l, lOk := toMemoryNumber(args[0])
+		r, rOk := toMemoryNumber(args[1])
+		if !lOk || !rOk {
+			return nil, errors.Errorf("MemoryDatastore: Operator %s expects numbers, but got %T and %T", name, args[0], args[1])
+		}
+		return calculate(l, r), nil
+	}}
+}
+
+// memoryComparison returns an operator which checks the result of compareMemoryValues. Values which are not comparable are never matched.
+func memoryComparison(check func(comparison int) bool) memoryOperator {
+	return memoryOperator{args: 2, fn: func(args ...interface{}) (interface{}, error) {
+		comparison, ok := compareMemoryValues(args[0], args[1])
+		return ok && check(comparison), nil
+	}}
+}
+
+// memoryStringFunction returns an operator which transforms a string.
+func memoryStringFunction(name string, transform func(string) string) memoryOperator {
+	return memoryOperator{args: 1, fn: func(args ...interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		if str, ok := args[0].(string); ok {
+			return transform(str), nil
+		}
+		return nil, errors.Errorf("MemoryDatastore: Operator %s expects a string, but got %T", name, args[0])
+	}}
+}
+
+type memoryConstant struct {
+	value interface{}
+}
+
+type memoryAttribute struct {
+	entity string
+	name   string
+}
+
+type memoryLogical struct {
+	operator string
+	clauses  []memoryExpression
+}
+
+type memoryNegation struct {
+	clause memoryExpression
+}
+
+type memoryNullCheck struct {
+	operand memoryExpression
+	negated bool
+}
+
+// memoryCall applies the memory operator with the given name to its args.
+type memoryCall struct {
+	operator string
+	args     []memoryExpression
+}
+
+// Implements memoryExpression
+func (c memoryConstant) evaluate(memoryRow) (interface{}, error) {
+	return c.value, nil
+}
+
+// Implements memoryExpression
+func (c memoryConstant) String() string {
+	switch v := c.value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = memoryConstant{value: value}.String()
+		}
+		return fmt.Sprintf("(%s)", strings.Join(values, ", "))
+	default:
+		return fmt.Sprintf("%v", c.value)
+	}
+}
+
+// Implements memoryExpression
+func (a memoryAttribute) evaluate(row memoryRow) (interface{}, error) {
+	return row[a.entity][a.name], nil
+}
+
+// Implements memoryExpression
+func (a memoryAttribute) String() string {
+	return fmt.Sprintf("%s.%s", a.entity, a.name)
+}
+
+// Implements memoryExpression
+func (l memoryLogical) evaluate(row memoryRow) (interface{}, error) {
+	// Conjunctions are true until a clause is false, disjunctions are false until a clause is true
+	conjunction := l.operator == "AND"
+	for _, clause := range l.clauses {
+		value, err := clause.evaluate(row)
+		if err != nil {
+			return nil, err
+		}
+		if isTrue := value == true; isTrue != conjunction {
+			return !conjunction, nil
+		}
+	}
+	return conjunction, nil
+}
+
+// Implements memoryExpression
+func (l memoryLogical) String() string {
+	clauses := make([]string, len(l.clauses))
+	for i, clause := range l.clauses {
+		clauses[i] = clause.String()
+	}
+	return fmt.Sprintf("(%s)", strings.Join(clauses, fmt.Sprintf(" %s ", l.operator)))
+}
+
+// Implements memoryExpression
+func (n memoryNegation) evaluate(row memoryRow) (interface{}, error) {
+	value, err := n.clause.evaluate(row)
+	if err != nil {
+		return nil, err
+	}
+	return value != true, nil
+}
+
+// Implements memoryExpression
+func (n memoryNegation) String() string {
+	return fmt.Sprintf("NOT (%s)", n.clause.String())
+}
+
+// Implements memoryExpression
+func (n memoryNullCheck) evaluate(row memoryRow) (interface{}, error) {
+	value, err := n.operand.evaluate(row)
+	if err != nil {
+		return nil, err
+	}
+	return (value == nil) != n.negated, nil
+}
+
+// Implements memoryExpression
+func (n memoryNullCheck) String() string {
+	if n.negated {
+		return fmt.Sprintf("%s IS NOT NULL", n.operand.String())
+	}
+	return fmt.Sprintf("%s IS NULL", n.operand.String())
+}
+
+// Implements memoryExpression
+func (c memoryCall) evaluate(row memoryRow) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		value, err := arg.evaluate(row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return memoryOperators[c.operator].fn(args...)
+}
+
+// Implements memoryExpression
+func (c memoryCall) String() string {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", c.operator, strings.Join(args, ", "))
+}
+
+// equalMemoryValues compares two values like SQL does: Missing values are never equal and numbers are equal to their string representation.
+func equalMemoryValues(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return false
+	}
+	if comparison, ok := compareMemoryValues(left, right); ok {
+		return comparison == 0
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// compareMemoryValues compares numbers (or a number and a numeric string) and strings.
+// The second return value is false if the values are not comparable.
+func compareMemoryValues(left, right interface{}) (int, bool) {
+	_, lNumber := left.(float64)
+	_, rNumber := right.(float64)
+	if lNumber || rNumber {
+		l, lOk := toMemoryNumber(left)
+		r, rOk := toMemoryNumber(right)
+		if !lOk || !rOk {
+			return 0, false
+		}
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	l, lOk := left.(string)
+	r, rOk := right.(string)
+	if !lOk || !rOk {
+		return 0, false
+	}
+	return strings.Compare(l, r), true
+}
+
+func toMemoryNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -2,8 +2,6 @@ package data
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"sync"
 	"time"
 
@@ -11,27 +9,33 @@ import (
 	"github.com/unbasical/kelon/configs"
 	"github.com/unbasical/kelon/pkg/constants/logging"
 	"github.com/unbasical/kelon/pkg/data"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type mongoDatastoreExecuter struct {
-	appConf *configs.AppConfig
-	client  *mongo.Client
-	conn    map[string]string
+	appConf    *configs.AppConfig
+	client     *mongo.Client
+	conn       map[string]string
+	configured bool
 }
 
 func NewMongoDatastoreExecuter() data.DatastoreExecutor {
 	return &mongoDatastoreExecuter{
-		appConf: nil,
-		conn:    nil,
-		client:  nil,
+		appConf:    nil,
+		conn:       nil,
+		client:     nil,
+		configured: false,
 	}
 }
 
 func (ds *mongoDatastoreExecuter) Configure(appConf *configs.AppConfig, alias string) error {
+	// Exit if already configured
+	if ds.configured {
+		return nil
+	}
+
 	// Validate config
 	conf, e := extractAndValidateDatastore(appConf, alias)
 	if e != nil {
@@ -70,13 +74,33 @@ func (ds *mongoDatastoreExecuter) Configure(appConf *configs.AppConfig, alias st
 	ds.client = client
 	ds.conn = conf.Connection
 	ds.appConf = appConf
+	ds.configured = true
 	return nil
 }
 
+// Close disconnects the client of the executor.
+func (ds *mongoDatastoreExecuter) Close() error {
+	if !ds.configured {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return ds.client.Disconnect(ctx)
+}
+
+// queryContext limits the duration of queries without a deadline of the request (i.e. without a deadline of the API mapping).
+func (ds *mongoDatastoreExecuter) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, 5*time.Second)
+}
+
 func (ds *mongoDatastoreExecuter) Execute(ctx context.Context, query data.DatastoreQuery) (bool, error) {
-	mongoStatements, ok := query.Statement.(map[string]string)
+	mongoStatements, ok := query.Statement.(mongoStatement)
 	if !ok {
-		return false, errors.Errorf("Passed statement was not of type map[string]string but of type: #{statement}")
+		return false, errors.Errorf("MongoDatastoreExecutor: Passed statement was not of type %T but of type %T", mongoStatement{}, query.Statement)
 	}
 
 	queryResults := make([]mongoQueryResult, len(mongoStatements))
@@ -85,28 +109,19 @@ func (ds *mongoDatastoreExecuter) Execute(ctx context.Context, query data.Datast
 	var wg sync.WaitGroup
 	writeIndex := 0
 	wg.Add(len(queryResults))
-	entireQuery := ""
-	for collection, filterString := range mongoStatements {
-		entireQuery += fmt.Sprintf("%s->[%s]\n", collection, filterString)
-		logging.LogForComponent("mongoDatastoreExecutor").Debugf("EXECUTING Filter: ==================%s.find( %s )==================", collection, filterString)
+	for collection, collectionQuery := range mongoStatements {
+		logging.LogForComponent("mongoDatastoreExecutor").Debugf("EXECUTING Query: ==================%s==================", mongoStatement{collection: collectionQuery})
 
 		// Execute each of the resulting queries for each collection parallel
-		go func(wait *sync.WaitGroup, index int, coll string, fString string) {
+		go func(wait *sync.WaitGroup, index int, coll string, query mongoQuery) {
 			defer wait.Done()
 
-			// Unmarshal generated json string
-			var filter bson.M
-			unmarshalErr := json.Unmarshal([]byte(fString), &filter)
-			if unmarshalErr != nil {
-				logging.LogForComponent("mongoDatastoreExecutor").Fatal("json.Unmarshal() ERROR:", unmarshalErr)
-			}
-
 			// Execute query
 			collection := ds.client.Database(ds.conn[dbKey]).Collection(coll)
-			timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			queryCtx, cancel := ds.queryContext(ctx)
 			defer cancel()
 
-			count, searchErr := collection.CountDocuments(timeoutCtx, filter)
+			count, searchErr := ds.count(queryCtx, collection, query)
 			if searchErr != nil {
 				queryResults[index] = mongoQueryResult{
 					err:   searchErr,
@@ -120,7 +135,7 @@ func (ds *mongoDatastoreExecuter) Execute(ctx context.Context, query data.Datast
 				err:   nil,
 				count: count,
 			}
-		}(&wg, writeIndex, collection, filterString)
+		}(&wg, writeIndex, collection, collectionQuery)
 
 		// Increase write-index to avoid parallel write conflicts
 		writeIndex++
@@ -145,3 +160,28 @@ func (ds *mongoDatastoreExecuter) Execute(ctx context.Context, query data.Datast
 	}
 	return decision, nil
 }
+
+// count returns the number of documents of the collection which match the query.
+// Pipelines stop after the first document, therefore their count only indicates if any document matched.
+func (ds *mongoDatastoreExecuter) count(ctx context.Context, collection *mongo.Collection, query mongoQuery) (int64, error) {
+	if query.pipelines == nil {
+		return collection.CountDocuments(ctx, query.filter)
+	}
+
+	var count int64
+	for _, pipeline := range query.pipelines {
+		cursor, err := collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return 0, err
+		}
+		for cursor.Next(ctx) {
+			count++
+		}
+		err = cursor.Err()
+		_ = cursor.Close(ctx)
+		if err != nil || count > 0 {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -2,15 +2,19 @@ package data
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/unbasical/kelon/configs"
-	"github.com/unbasical/kelon/internal/pkg/util"
 	"github.com/unbasical/kelon/pkg/constants/logging"
 	"github.com/unbasical/kelon/pkg/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type mongoDatastoreTranslator struct {
@@ -26,6 +30,73 @@ type mongoQueryResult struct {
 	count int64
 }
 
+// mongoStatement is the native query of MongoDB datastores, which maps each collection to the query of its documents.
+type mongoStatement map[string]mongoQuery
+
+// mongoQuery matches the documents of a collection either with a filter or, if the documents have to be joined with
+// documents of other collections, with aggregation pipelines.
+type mongoQuery struct {
+	filter    bson.D
+	pipelines []mongo.Pipeline
+}
+
+// mongoOperand is an operand of a call, which is either the path of a field or a value.
+type mongoOperand struct {
+	path  string
+	value interface{}
+}
+
+// mongoScope is the document against which fields are resolved, i.e. the documents of a collection or the elements of a nested array.
+// Aggregates are stored in fields of the documents (aggregate -> field).
+type mongoScope struct {
+	collection string
+	element    mongoElement
+	joined     map[string]bool
+	aggregates map[string]string
+}
+
+// mongoElement identifies the elements of a nested array inside a collection which are matched by the same iterator.
+type mongoElement struct {
+	field    string
+	iterator string
+}
+
+// Stage which stops pipelines as soon as any document matched
+//
+//nolint:gochecknoglobals,gocritic
+var mongoLimit = bson.D{{Key: "$limit", Value: 1}}
+
+// Aggregation operators of comparisons, which are used to correlate aggregated documents with the queried ones
+//
+//nolint:gochecknoglobals,gocritic
+var mongoExprOperators = map[string]string{
+	"eq":    "$eq",
+	"equal": "$eq",
+	"neq":   "$ne",
+	"lt":    "$lt",
+	"gt":    "$gt",
+	"lte":   "$lte",
+	"gte":   "$gte",
+}
+
+// Placeholders which are passed to the call-operands to receive the structure of their mappings
+//
+//nolint:gochecknoglobals,gocritic
+var mongoPlaceholderMatcher = regexp.MustCompile(`^\{\{(\d+)\}\}$`)
+
+// Operators of comparisons which are used if the operands are swapped, so that the field is the first operand
+//
+//nolint:gochecknoglobals,gocritic
+var mongoSwappedOperators = map[string]string{
+	"eq":    "eq",
+	"equal": "equal",
+	"neq":   "neq",
+	"lt":    "gt",
+	"gt":    "lt",
+	"lte":   "gte",
+	"gte":   "lte",
+}
+
 // NewMongoDatastoreTranslator Returns a new data.DatastoreTranslator which is able to connect to MongoDB databases.
 func NewMongoDatastoreTranslator() data.DatastoreTranslator {
 	return &mongoDatastoreTranslator{
@@ -87,199 +158,850 @@ func (ds *mongoDatastoreTranslator) Execute(ctx context.Context, query data.Node
 	logging.LogForComponent("mongoDatastoreTranslator").Debugf("TRANSLATING QUERY: ==================%+v==================", query.String())
 
 	// Translate to map: collection -> filter
-	statements, err := ds.translate(query)
+	filters, pipelines, err := ds.translate(query)
 	if err != nil {
 		return data.DatastoreQuery{}, err
 	}
+	statements := existenceStatement(filters, pipelines)
 
 	logging.LogForComponent("mongoDatastoreTranslator").Debugf("EXECUTING STATEMENT: ==================%s==================\n", statements)
 
 	return data.DatastoreQuery{Statement: statements}, nil
 }
 
-// nolint:gocyclo,gocritic
-func (ds *mongoDatastoreTranslator) translate(input data.Node) (map[string]string, error) {
-	type colFilter struct {
-		collection string
-		filter     string
-	}
-	entityMatcher := regexp.MustCompile(`\{\{(.*?)\}\}`)
-	result := make(map[string]string)
-	filtersByCollection := make(map[string][]string)
-	var filters []colFilter
-	var entities util.Stack[string]
-	var relations util.Stack[string]
-	var operands util.Stack[[]string]
-	// Walk input
-	err := input.Walk(func(q data.Node) error {
-		switch v := q.(type) {
-		case data.Union:
-			// Sort collection filters by collection
-			for _, colF := range filters {
-				coll, exists := filtersByCollection[colF.collection]
-				if exists {
-					// Append filter to existing entry
-					filtersByCollection[colF.collection] = append(coll, colF.filter)
-				} else {
-					// Write new entry
-					filtersByCollection[colF.collection] = []string{colF.filter}
-				}
-			}
+// Filter translates the query into a filter document for each collection which can be used by the caller to list the matching documents.
+// Collections whose documents have to be joined with other documents are matched by a single aggregation pipeline instead, which
+// returns the matching documents unchanged.
+func (ds *mongoDatastoreTranslator) Filter(ctx context.Context, query data.Node) (data.DatastoreQuery, error) {
+	if !ds.configured {
+		return data.DatastoreQuery{}, errors.Errorf("MongoDatastoreTranslator: Datastore was not configured! Please call Configure().")
+	}
 
-			// Combine all filters for each collection with a disjunction
-			for collection, filterSlice := range filtersByCollection {
-				combinedFilter := fmt.Sprintf("{ \"$or\": [ %s ] }", strings.Join(filterSlice, ", "))
-
-				// Postprocessing
-				// If the collection is i.e. apps, then remove all occurrences of 'apps.' in the mapped filters
-				collection := collection // pin!
-				var err error
-				finalFilter := entityMatcher.ReplaceAllStringFunc(combinedFilter, func(match string) string {
-					entity := match[2 : len(match)-3] // Extract entity. Each match has format: {{<entity>.}}
-
-					// the collection is root level and therefore entirely removed
-					if entity == collection {
-						return ""
-					}
-
-					// All other entities are mapped to final paths
-					if path, found := ds.entityPaths[collection][entity]; found {
-						// Skip collection in path
-						return strings.Join(path[1:], ".") + "."
-					}
-					err = errors.Errorf("MongoDatastoreTranslator: Unable to find mapping for entity %q in collection %q", entity, collection)
-					return ""
-				})
-
-				// Stop function in case of error
-				if err != nil {
-					return err
-				}
+	filters, pipelines, err := ds.translate(query)
+	if err != nil {
+		return data.DatastoreQuery{}, err
+	}
+	return data.DatastoreQuery{Statement: filterStatement(filters, pipelines)}, nil
+}
 
-				result[collection] = finalFilter
-			}
-		case data.Query:
-			// Expected stack: entities-top -> [singleEntity] relations-top -> [singleCondition]
-			var (
-				entity    string
-				condition string
-			)
-			// Extract entity
-			entity, err := entities.Pop()
+// translate translates the query into the filters and pipelines of all queries by collection. Each filter and pipeline matches
+// the documents of one query of the union.
+func (ds *mongoDatastoreTranslator) translate(input data.Node) (map[string]bson.A, map[string][]mongo.Pipeline, error) {
+	union, ok := input.(data.Union)
+	if !ok {
+		return nil, nil, errors.Errorf("MongoDatastoreTranslator: Expected query of type %T, but got %T", data.Union{}, input)
+	}
+
+	// Collect the filters and pipelines of all queries by collection
+	filtersByCollection := make(map[string]bson.A)
+	pipelinesByCollection := make(map[string][]mongo.Pipeline)
+	for _, clause := range union.Clauses {
+		query, ok := clause.(data.Query)
+		if !ok {
+			return nil, nil, errors.Errorf("MongoDatastoreTranslator: Unexpected input: %T -> %+v", clause, clause)
+		}
+		if err := ds.validateDeeperAttributes(query); err != nil {
+			return nil, nil, err
+		}
+
+		// Several iterators of a nested entity are matched independently of each other, which is mongo's default for nested arrays.
+		// Other collections (including other iterators of the queried one) and aggregates have to be looked up by an aggregation pipeline.
+		// The queried iterator (which may be a further iterator of the collection) always references the documents themselves.
+		collection := query.From.Value
+		linked := ds.linkedCollections(query)
+		if len(linked) > 0 || len(mongoAggregates(query.Condition.Clause)) > 0 {
+			pipeline, err := ds.compilePipeline(query, linked)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-			// Extract condition
-			if !relations.IsEmpty() {
-				condition, err = relations.Peek()
-				if err != nil {
-					return err
+			pipelinesByCollection[collection] = append(pipelinesByCollection[collection], pipeline)
+			continue
+		}
+
+		// All other attributes are resolved relative to the documents of the collection
+		filter, err := ds.compile(query.Condition.Clause, mongoScope{collection: collection})
+		if err != nil {
+			return nil, nil, err
+		}
+		filtersByCollection[collection] = append(filtersByCollection[collection], filter)
+	}
+	return filtersByCollection, pipelinesByCollection, nil
+}
+
+// existenceStatement combines the filters and pipelines of each collection into queries which check if any document matches.
+func existenceStatement(filtersByCollection map[string]bson.A, pipelinesByCollection map[string][]mongo.Pipeline) mongoStatement {
+	// Combine all filters for each collection with a disjunction
+	statement := make(mongoStatement, len(filtersByCollection)+len(pipelinesByCollection))
+	for collection, filters := range filtersByCollection {
+		statement[collection] = mongoQuery{filter: bson.D{{Key: "$or", Value: filters}}}
+	}
+
+	// Collections with pipelines are only aggregated, therefore their filter is matched by a pipeline as well
+	for collection, pipelines := range pipelinesByCollection {
+		if filter := statement[collection].filter; filter != nil {
+			pipelines = append([]mongo.Pipeline{{bson.D{{Key: "$match", Value: filter}}, mongoLimit}}, pipelines...)
+		}
+		statement[collection] = mongoQuery{pipelines: pipelines}
+	}
+	return statement
+}
+
+// filterStatement combines the filters and pipelines of each collection into queries which return all matching documents.
+// Pipelines are no longer executed on the documents themselves, because they would join other documents into them and stop after
+// the first match. Instead, each pipeline looks up the document it has been started for into the field _match<n>, so that
+// documents are matched if any of these fields is non-empty. These fields are removed afterwards.
+func filterStatement(filtersByCollection map[string]bson.A, pipelinesByCollection map[string][]mongo.Pipeline) mongoStatement {
+	statement := make(mongoStatement, len(filtersByCollection)+len(pipelinesByCollection))
+	for collection, filters := range filtersByCollection {
+		if _, aggregated := pipelinesByCollection[collection]; !aggregated {
+			statement[collection] = mongoQuery{filter: bson.D{{Key: "$or", Value: filters}}}
+		}
+	}
+
+	for collection, pipelines := range pipelinesByCollection {
+		var lookups mongo.Pipeline
+		matches := append(bson.A{}, filtersByCollection[collection]...)
+		removed := bson.D{}
+		for i, pipeline := range pipelines {
+			field := fmt.Sprintf("_match%d", i)
+			correlated := append(mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$_id", "$$root"}}}}}}},
+			}, pipeline...)
+			lookups = append(lookups, bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: collection},
+				{Key: "let", Value: bson.D{{Key: "root", Value: "$_id"}}},
+				{Key: "pipeline", Value: correlated},
+				{Key: "as", Value: field},
+			}}})
+			matches = append(matches, bson.D{{Key: field, Value: bson.D{{Key: "$ne", Value: bson.A{}}}}})
+			removed = append(removed, bson.E{Key: field, Value: 0})
+		}
+
+		pipeline := append(lookups,
+			bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: matches}}}},
+			bson.D{{Key: "$project", Value: removed}},
+		)
+		statement[collection] = mongoQuery{pipelines: []mongo.Pipeline{pipeline}}
+	}
+	return statement
+}
+
+// linkedCollections returns all linked entities of the query which are no nested entities of the queried collection, but collections themselves.
+func (ds *mongoDatastoreTranslator) linkedCollections(query data.Query) []data.Entity {
+	var linked []data.Entity
+	for _, e := range query.Link.Entities {
+		if _, isCollection := ds.entityPaths[e.Value]; !isCollection {
+			continue
+		}
+		if _, isNested := ds.entityPaths[query.From.Value][e.Value]; isNested && e.Value != query.From.Value {
+			continue
+		}
+		linked = append(linked, e)
+	}
+	return linked
+}
+
+// compilePipeline translates the query into an aggregation pipeline, which looks up the linked collections into fields named
+// after their iterators. Each linked collection has to be related to the documents by an equality of attributes.
+// Aggregates are looked up afterwards into the fields _aggregate<n>.
+func (ds *mongoDatastoreTranslator) compilePipeline(query data.Query, linked []data.Entity) (mongo.Pipeline, error) {
+	scope := mongoScope{collection: query.From.Value, joined: make(map[string]bool, len(linked)), aggregates: make(map[string]string)}
+	for _, e := range linked {
+		scope.joined[e.Name()] = true
+	}
+
+	var conditions []data.Node
+	switch v := query.Condition.Clause.(type) {
+	case nil:
+	case data.Conjunction:
+		conditions = append(conditions, v.Clauses...)
+	default:
+		conditions = []data.Node{v}
+	}
+
+	// Look up linked collections as long as any of them is related to the available documents
+	var lookups mongo.Pipeline
+	pending := append(linked[:0:0], linked...)
+	available := func(attribute data.Attribute) bool {
+		for _, e := range pending {
+			if e.Name() == attribute.Entity.Name() {
+				return false
+			}
+		}
+		return true
+	}
+	for len(pending) > 0 {
+		progress := false
+	search:
+		for i, entity := range pending {
+			for j, condition := range conditions {
+				local, foreign, isJoin := mongoJoinCondition(condition, entity.Name())
+				if !isJoin || !available(local) {
+					continue
 				}
-				if relations.Size() != 1 {
-					return errors.Errorf("MongoDatastoreTranslator: Error while building Query: Too many relations left to build 1 condition! len(relations) = %d", relations.Size())
+
+				localField, err := ds.fieldPath(local, scope)
+				if err != nil {
+					return nil, err
 				}
+				lookups = append(lookups,
+					bson.D{{Key: "$lookup", Value: bson.D{
+						{Key: "from", Value: entity.Value},
+						{Key: "localField", Value: localField},
+						{Key: "foreignField", Value: foreign.Name},
+						{Key: "as", Value: entity.Name()},
+					}}},
+					bson.D{{Key: "$unwind", Value: "$" + entity.Name()}},
+				)
+				pending = append(pending[:i], pending[i+1:]...)
+				conditions = append(conditions[:j], conditions[j+1:]...)
+				progress = true
+				break search
 			}
+		}
+		if !progress {
+			return nil, errors.Errorf("MongoDatastoreTranslator: Collection %q has to be related to the queried documents by an equality of attributes", pending[0].Value)
+		}
+	}
+
+	// Aggregates are computed for the joined documents
+	for _, aggregate := range mongoAggregates(query.Condition.Clause) {
+		if _, exists := scope.aggregates[aggregate.String()]; exists {
+			continue
+		}
+		field := fmt.Sprintf("_aggregate%d", len(scope.aggregates))
+		stages, err := ds.compileAggregate(aggregate, field, scope)
+		if err != nil {
+			return nil, err
+		}
+		lookups = append(lookups, stages...)
+		scope.aggregates[aggregate.String()] = field
+	}
 
-			// Append new filter
-			filters = append(filters, colFilter{
-				collection: entity,
-				filter:     condition,
-			})
-			relations.Clear()
-		case data.Link:
-			// Reset entities because mongo does not join, but can only access directly nested elements!
-			entities.Clear()
-		case data.Condition:
-			// Skip condition
-		case data.Conjunction:
-			// Expected stack: relations-top -> [conjunctions ...]
-			if !relations.IsEmpty() {
-				rels := relations.Values()
-				relations.Clear()
-				relations.Push(fmt.Sprintf("{%s}", strings.Join(rels, ", ")))
-				logging.LogForComponent("mongoDatastoreTranslator").Debugf("CONJUNCTION: relations |%+v <- TOP", relations)
+	// Filter the documents before they are joined as far as possible
+	var before, after []data.Node
+	for _, condition := range conditions {
+		if ds.requiresLookup(condition, scope) {
+			after = append(after, condition)
+		} else {
+			before = append(before, condition)
+		}
+	}
+
+	var pipeline mongo.Pipeline
+	if len(before) > 0 {
+		filter, err := ds.compileConjunction(before, scope)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	pipeline = append(pipeline, lookups...)
+	if len(after) > 0 {
+		filter, err := ds.compileConjunction(after, scope)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	return append(pipeline, mongoLimit), nil
+}
+
+// requiresLookup checks if the clause contains any attribute of a looked up collection or any aggregate.
+func (ds *mongoDatastoreTranslator) requiresLookup(clause data.Node, scope mongoScope) bool {
+	errLookup := errors.New("clause references looked up documents")
+	return clause.Walk(func(node data.Node) error {
+		switch v := node.(type) {
+		case data.Attribute:
+			if scope.joined[v.Entity.Name()] {
+				return errLookup
 			}
+		case data.Aggregate:
+			return errLookup
+		}
+		return nil
+	}) != nil
+}
+
+// compileAggregate translates the aggregate into stages, which look up the aggregated documents and store the aggregated value
+// in the field. Conditions with attributes of the queried documents correlate both, these attributes are passed as variables.
+// Aggregating no documents results in 0 for count and sum, and in null otherwise.
+func (ds *mongoDatastoreTranslator) compileAggregate(aggregate data.Aggregate, field string, outer mongoScope) (mongo.Pipeline, error) {
+	query := aggregate.Query
+	inner := mongoScope{collection: query.From.Value}
+	if _, isCollection := ds.entityPaths[inner.collection]; !isCollection {
+		return nil, errors.Errorf("MongoDatastoreTranslator: Aggregated entity %q is no collection", inner.collection)
+	}
+	if linked := ds.linkedCollections(query); len(linked) > 0 {
+		return nil, errors.Errorf("MongoDatastoreTranslator: Aggregates over several collections are not supported, but %q was linked to %q", linked[0].Value, inner.collection)
+	}
+	innerEntities := map[string]bool{query.From.Name(): true}
+	for _, e := range query.Link.Entities {
+		innerEntities[e.Name()] = true
+	}
+
+	var conditions []data.Node
+	switch v := query.Condition.Clause.(type) {
+	case nil:
+	case data.Conjunction:
+		conditions = append(conditions, v.Clauses...)
+	default:
+		conditions = []data.Node{v}
+	}
+
+	// Split the conditions into correlations and filters of the aggregated documents
+	variables := bson.D{}
+	var correlations bson.A
+	var filters []data.Node
+	for _, condition := range conditions {
+		correlation, isCorrelation, err := ds.compileCorrelation(condition, innerEntities, inner, outer, &variables)
+		if err != nil {
+			return nil, err
+		}
+		if isCorrelation {
+			correlations = append(correlations, correlation)
+		} else {
+			filters = append(filters, condition)
+		}
+	}
+
+	var pipeline mongo.Pipeline
+	if len(correlations) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{{Key: "$and", Value: correlations}}}}}})
+	}
+	if len(filters) > 0 {
+		filter, err := ds.compileConjunction(filters, inner)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+
+	// Aggregate the values (or documents) into the field value
+	value := ""
+	if aggregate.Value != nil {
+		attribute, ok := aggregate.Value.(data.Attribute)
+		if !ok || attribute.Entity.Value != inner.collection {
+			return nil, errors.Errorf("MongoDatastoreTranslator: Only fields of collection %q can be aggregated, but got %+v", inner.collection, aggregate.Value)
+		}
+		value = "$" + attribute.Name
+	}
+	if aggregate.Distinct && value != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: value}}}})
+		value = "$_id"
+	}
+	var defaultValue interface{}
+	switch fn := aggregate.Function.String(); fn {
+	case "count":
+		pipeline = append(pipeline, bson.D{{Key: "$count", Value: "value"}})
+		defaultValue = 0
+	case "sum", "max", "min":
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "value", Value: bson.D{{Key: "$" + fn, Value: value}}},
+		}}})
+		if fn == "sum" {
+			defaultValue = 0
+		}
+	default:
+		return nil, errors.Errorf("MongoDatastoreTranslator: Unknown aggregate function [%s]", fn)
+	}
+
+	lookup := bson.D{{Key: "from", Value: inner.collection}}
+	if len(variables) > 0 {
+		lookup = append(lookup, bson.E{Key: "let", Value: variables})
+	}
+	lookup = append(lookup, bson.E{Key: "pipeline", Value: pipeline}, bson.E{Key: "as", Value: field})
+	return mongo.Pipeline{
+		bson.D{{Key: "$lookup", Value: lookup}},
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: field, Value: bson.D{
+			{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$arrayElemAt", Value: bson.A{"$" + field + ".value", 0}}}, defaultValue}},
+		}}}}},
+	}, nil
+}
+
+// compileCorrelation translates a comparison, which contains attributes of the queried documents, into an aggregation expression
+// on the aggregated documents. The attributes of the queried documents are added to the variables.
+// False is returned for conditions which only contain attributes of the aggregated documents.
+func (ds *mongoDatastoreTranslator) compileCorrelation(condition data.Node, innerEntities map[string]bool, inner, outer mongoScope, variables *bson.D) (bson.D, bool, error) {
+	correlated := false
+	_ = condition.Walk(func(node data.Node) error {
+		if attribute, ok := node.(data.Attribute); ok && !innerEntities[attribute.Entity.Name()] {
+			correlated = true
+		}
+		return nil
+	})
+	if !correlated {
+		return nil, false, nil
+	}
+
+	call, ok := condition.(data.Call)
+	operator, isComparison := mongoExprOperators[call.Operator.String()]
+	if !ok || !isComparison || len(call.Operands) != 2 {
+		return nil, false, errors.Errorf("MongoDatastoreTranslator: Aggregated documents can only be correlated by comparisons, but got %+v", condition)
+	}
+
+	args := make(bson.A, len(call.Operands))
+	for i, operand := range call.Operands {
+		switch v := operand.(type) {
 		case data.Attribute:
-			// Expected stack:  top -> [entity, ...]
-			var entity string
-			entity, err := entities.Pop()
+			if innerEntities[v.Entity.Name()] {
+				if v.Entity.Value != inner.collection {
+					return nil, false, errors.Errorf("MongoDatastoreTranslator: Aggregated documents can only be correlated by fields of collection %q, but got %+v", inner.collection, v)
+				}
+				args[i] = "$" + v.Name
+				continue
+			}
+			path, err := ds.fieldPath(v, outer)
 			if err != nil {
-				return err
+				return nil, false, err
 			}
-			// Mark entity with . to be replaced in finished query
-			if err := util.AppendToTop(&operands, fmt.Sprintf("\"{{%s.}}%s\"", entity, v.Name)); err != nil {
-				return err
+			variable := fmt.Sprintf("v%d", len(*variables))
+			*variables = append(*variables, bson.E{Key: variable, Value: "$" + path})
+			args[i] = "$$" + variable
+		case *data.Constant:
+			value, err := mongoValue(*v)
+			if err != nil {
+				return nil, false, err
 			}
-		case data.Call:
-			// Expected stack:  top -> [args..., call-op]
-			var ops []string
-			ops, err := operands.Pop()
+			args[i] = bson.D{{Key: "$literal", Value: value}}
+		case data.Constant:
+			value, err := mongoValue(v)
 			if err != nil {
-				return err
+				return nil, false, err
 			}
-			op := ops[0]
-
-			// Sort call operands in case of eq operation
-			// This has to be done because MongoDB maps equality to normal JSON-Attributes.
-			if len(ops) == 3 {
-				// Check if first operand is not an entity
-				if !entityMatcher.MatchString(ops[1]) {
-					// Swap operands
-					ops[1], ops[2] = ops[2], ops[1]
-				}
+			args[i] = bson.D{{Key: "$literal", Value: value}}
+		default:
+			return nil, false, errors.Errorf("MongoDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
+		}
+	}
+	return bson.D{{Key: operator, Value: args}}, true, nil
+}
+
+// mongoAggregates returns all aggregates inside the clause.
+func mongoAggregates(clause data.Node) []data.Aggregate {
+	var aggregates []data.Aggregate
+	if clause == nil {
+		return nil
+	}
+	_ = clause.Walk(func(node data.Node) error {
+		if aggregate, ok := node.(data.Aggregate); ok {
+			aggregates = append(aggregates, aggregate)
+		}
+		return nil
+	})
+	return aggregates
+}
+
+// mongoJoinCondition checks if the condition is an equality of an attribute of the entity with an attribute of another entity.
+// The attribute of the other entity and the attribute of the entity are returned.
+func mongoJoinCondition(condition data.Node, entity string) (data.Attribute, data.Attribute, bool) {
+	call, ok := condition.(data.Call)
+	if !ok || len(call.Operands) != 2 || (call.Operator.String() != "eq" && call.Operator.String() != "equal") {
+		return data.Attribute{}, data.Attribute{}, false
+	}
+	left, leftOk := call.Operands[0].(data.Attribute)
+	right, rightOk := call.Operands[1].(data.Attribute)
+	if !leftOk || !rightOk || left.Entity.Name() == right.Entity.Name() {
+		return data.Attribute{}, data.Attribute{}, false
+	}
+
+	switch entity {
+	case left.Entity.Name():
+		return right, left, true
+	case right.Entity.Name():
+		return left, right, true
+	default:
+		return data.Attribute{}, data.Attribute{}, false
+	}
+}
+
+func (ds *mongoDatastoreTranslator) compile(input data.Node, scope mongoScope) (bson.D, error) {
+	switch v := input.(type) {
+	case nil:
+		// Queries without condition match all documents
+		return bson.D{}, nil
+	case data.Condition:
+		return ds.compile(v.Clause, scope)
+	case data.Conjunction, data.Disjunction:
+		if conjunction, isConjunction := v.(data.Conjunction); isConjunction {
+			return ds.compileConjunction(conjunction.Clauses, scope)
+		}
+
+		clauses := v.(data.Disjunction).Clauses
+		filters := make([]bson.D, 0, len(clauses))
+		for _, clause := range clauses {
+			compiled, err := ds.compile(clause, scope)
+			if err != nil {
+				return nil, err
 			}
+			filters = append(filters, compiled)
+		}
+		return bson.D{{Key: "$or", Value: mongoArray(filters)}}, nil
+	case data.Negation:
+		compiled, err := ds.compile(v.Clause, scope)
+		if err != nil {
+			return nil, err
+		}
+		return bson.D{{Key: "$nor", Value: bson.A{compiled}}}, nil
+	case data.Call:
+		return ds.compileCall(v, scope)
+	default:
+		return nil, errors.Errorf("MongoDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
+	}
+}
 
-			// Handle Call
-			var nextRel string
-			if mongoCallOp, ok := ds.callOps[op]; ok {
-				// Expected stack:  top -> [args..., call-op]
-				logging.LogForComponent("mongoDatastoreTranslator").Debugln("NEW FUNCTION CALL")
-				var callOpError error
-				nextRel, callOpError = mongoCallOp(ops[1:]...)
-				// Check for call operand error
-				if callOpError != nil {
-					return callOpError
-				}
-			} else {
-				// Stop function in case of error
-				return errors.Errorf("MongoDatastoreTranslator: Unable to find mapping for operator [%s] in your policy by any of your datastore config!", op)
+// compileConjunction groups the clauses by the elements of nested arrays they are matching. All conditions on the same element are
+// matched with $elemMatch, because each of them would match any element of the array otherwise.
+func (ds *mongoDatastoreTranslator) compileConjunction(clauses []data.Node, scope mongoScope) (bson.D, error) {
+	filters := make([]bson.D, 0, len(clauses))
+	grouped := make(map[mongoElement][]data.Node)
+	positions := make(map[mongoElement]int)
+	var elements []mongoElement
+	for _, clause := range clauses {
+		// Elements can only be grouped inside the documents of the collection
+		if element, ok := ds.clauseElement(clause, scope.collection); ok && scope.element == (mongoElement{}) {
+			if _, exists := grouped[element]; !exists {
+				positions[element] = len(filters)
+				elements = append(elements, element)
+				filters = append(filters, nil)
 			}
+			grouped[element] = append(grouped[element], clause)
+			continue
+		}
 
-			if operands.Size() > 0 {
-				// If we are in nested call -> push as operand
-				if err := util.AppendToTop(&operands, nextRel); err != nil {
-					return err
-				}
-			} else {
-				// We reached root operation -> relation is processed
-				relations.Push(nextRel)
-				logging.LogForComponent("mongoDatastoreTranslator").Debugf("RELATION DONE: relations |%+v <- TOP", relations)
+		compiled, err := ds.compile(clause, scope)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, compiled)
+	}
+
+	for _, element := range elements {
+		elementScope := mongoScope{collection: scope.collection, element: element}
+		matched := make([]bson.D, 0, len(grouped[element]))
+		for _, clause := range grouped[element] {
+			compiled, err := ds.compile(clause, elementScope)
+			if err != nil {
+				return nil, err
 			}
-		case data.Operator:
-			operands.Push([]string{})
-			if err := util.AppendToTop(&operands, v.String()); err != nil {
-				return err
+			matched = append(matched, compiled)
+		}
+		filters[positions[element]] = bson.D{{Key: element.field, Value: bson.D{{Key: "$elemMatch", Value: mongoConjunction(matched)}}}}
+	}
+	return mongoConjunction(filters), nil
+}
+
+// clauseElement returns the element of a nested array if all attributes inside the clause belong to it.
+func (ds *mongoDatastoreTranslator) clauseElement(clause data.Node, collection string) (mongoElement, bool) {
+	var (
+		element mongoElement
+		found   bool
+	)
+	errMixed := errors.New("clause contains attributes of several elements")
+	err := clause.Walk(func(node data.Node) error {
+		attribute, ok := node.(data.Attribute)
+		if !ok {
+			return nil
+		}
+		attributeElement, ok := ds.attributeElement(attribute, collection)
+		if !ok || (found && attributeElement != element) {
+			return errMixed
+		}
+		element, found = attributeElement, true
+		return nil
+	})
+	return element, found && err == nil
+}
+
+// validateDeeperAttributes rejects attributes of entities which are nested inside the elements of an array that is iterated
+// several times, because the query does not tell which of the iterators they belong to.
+func (ds *mongoDatastoreTranslator) validateDeeperAttributes(query data.Query) error {
+	collection := query.From.Value
+	iterated := make(map[string]bool)
+	for _, e := range query.Link.Entities {
+		if path, found := ds.entityPaths[collection][e.Value]; found && len(path) == 2 && e.Alias != "" {
+			iterated[path[1]] = true
+		}
+	}
+	if len(iterated) == 0 || query.Condition.Clause == nil {
+		return nil
+	}
+
+	return query.Condition.Walk(func(node data.Node) error {
+		attribute, ok := node.(data.Attribute)
+		if !ok {
+			return nil
+		}
+		if path, found := ds.entityPaths[collection][attribute.Entity.Value]; found && len(path) > 2 && iterated[path[1]] {
+			return errors.Errorf("MongoDatastoreTranslator: Attribute %q of entity %q is ambiguous, because array %q of collection %q is iterated several times",
+				attribute.Name, attribute.Entity.Value, path[1], collection)
+		}
+		return nil
+	})
+}
+
+// attributeElement returns the element of a nested array to which the attribute belongs. Entities which are nested directly inside
+// the collection are arrays whose elements are identified by their iterators. All deeper entities belong to the only iterator of their array
+// (see validateDeeperAttributes).
+func (ds *mongoDatastoreTranslator) attributeElement(attribute data.Attribute, collection string) (mongoElement, bool) {
+	path, found := ds.entityPaths[collection][attribute.Entity.Value]
+	if !found || len(path) < 2 {
+		return mongoElement{}, false
+	}
+	if len(path) == 2 {
+		return mongoElement{field: path[1], iterator: attribute.Entity.Name()}, true
+	}
+	return mongoElement{field: path[1], iterator: path[1]}, true
+}
+
+func (ds *mongoDatastoreTranslator) compileCall(call data.Call, scope mongoScope) (bson.D, error) {
+	op := call.Operator.String()
+	operands := make([]mongoOperand, len(call.Operands))
+	for i, operand := range call.Operands {
+		translated, err := ds.operand(operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = translated
+	}
+
+	// MongoDB maps comparisons to the compared field, therefore the field has to be the first operand
+	if len(operands) == 2 && !operands[0].isField() && operands[1].isField() {
+		if swapped, ok := mongoSwappedOperators[op]; ok {
+			op = swapped
+			operands[0], operands[1] = operands[1], operands[0]
+		}
+	}
+
+	callOp, ok := ds.callOps[op]
+	if !ok {
+		return nil, errors.Errorf("MongoDatastoreTranslator: Unable to find mapping for operator [%s] in your policy by any of your datastore config!", op)
+	}
+
+	// Map placeholders to receive the structure of the call-operand's mapping, which is filled with the operands afterwards
+	placeholders := make([]string, len(operands))
+	for i := range operands {
+		placeholders[i] = fmt.Sprintf("\"{{%d}}\"", i)
+	}
+	mapping, err := callOp(placeholders...)
+	if err != nil {
+		return nil, errors.Wrap(err, "MongoDatastoreTranslator: Error while mapping call-operand")
+	}
+	var mapped bson.D
+	if err = bson.UnmarshalExtJSON([]byte(fmt.Sprintf("{ %s }", mapping)), false, &mapped); err != nil {
+		return nil, errors.Wrapf(err, "MongoDatastoreTranslator: Mapping of operator [%s] is no valid filter: %s", op, mapping)
+	}
+
+	filter, err := substituteMongoOperands(mapped, operands)
+	if err != nil {
+		return nil, err
+	}
+	return filter.(bson.D), nil
+}
+
+func (ds *mongoDatastoreTranslator) operand(input data.Node, scope mongoScope) (mongoOperand, error) {
+	switch v := input.(type) {
+	case data.Attribute:
+		path, err := ds.fieldPath(v, scope)
+		return mongoOperand{path: path}, err
+	case *data.Constant:
+		return ds.operand(*v, scope)
+	case data.Constant:
+		// Note that MongoDB matches missing fields with null, so that null constants behave like IS NULL in SQL.
+		value, err := mongoValue(v)
+		return mongoOperand{value: value}, err
+	case data.Collection:
+		values := make(bson.A, len(v.Values))
+		for i, constant := range v.Values {
+			value, err := mongoValue(constant)
+			if err != nil {
+				return mongoOperand{}, err
 			}
-		case data.Entity:
-			entities.Push(v.String())
-		case data.Constant:
-			if v.IsNumeric {
-				if err := util.AppendToTop(&operands, v.String()); err != nil {
-					return err
+			values[i] = value
+		}
+		return mongoOperand{value: values}, nil
+	case data.Aggregate:
+		field, ok := scope.aggregates[v.String()]
+		if !ok {
+			return mongoOperand{}, errors.Errorf("MongoDatastoreTranslator: Aggregate %s was not looked up", v.String())
+		}
+		return mongoOperand{path: field}, nil
+	case data.Call:
+		return mongoOperand{}, errors.Errorf("MongoDatastoreTranslator: Nested call of operator [%s] is not supported by MongoDB", v.Operator.String())
+	default:
+		return mongoOperand{}, errors.Errorf("MongoDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
+	}
+}
+
+// mongoValue returns the value of the constant. Numbers which exceed int64 and float64 (json.Number) are converted into decimals,
+// which MongoDB compares exactly with all other numbers.
+func mongoValue(c data.Constant) (interface{}, error) {
+	number, ok := c.Value.(json.Number)
+	if !ok {
+		return c.Value, nil
+	}
+	decimal, err := primitive.ParseDecimal128(string(number))
+	if err != nil {
+		return nil, errors.Wrapf(err, "MongoDatastoreTranslator: Number %s can not be represented as decimal", number)
+	}
+	return decimal, nil
+}
+
+// fieldPath returns the path of the attribute inside the documents of the scope.
+func (ds *mongoDatastoreTranslator) fieldPath(attribute data.Attribute, scope mongoScope) (string, error) {
+	entity := attribute.Entity.Value
+
+	// Looked up collections are stored in the field named after their iterator
+	if scope.joined[attribute.Entity.Name()] {
+		return attribute.Entity.Name() + "." + attribute.Name, nil
+	}
+
+	// The collection is root level and therefore entirely removed
+	if entity == scope.collection {
+		return attribute.Name, nil
+	}
+
+	// All other entities are mapped to their paths
+	path, found := ds.entityPaths[scope.collection][entity]
+	if !found {
+		return "", errors.Errorf("MongoDatastoreTranslator: Unable to find mapping for entity %q in collection %q", entity, scope.collection)
+	}
+
+	// Skip collection in path and the array of the matched elements
+	fields := append([]string{}, path[1:]...)
+	if scope.element.field != "" {
+		fields = fields[1:]
+	}
+	return strings.Join(append(fields, attribute.Name), "."), nil
+}
+
+// mongoConjunction combines the filters into a single filter. Filters on distinct fields are merged into one document,
+// all others are combined with $and.
+func mongoConjunction(filters []bson.D) bson.D {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+
+	merged := bson.D{}
+	fields := make(map[string]bool)
+	for _, filter := range filters {
+		for _, element := range filter {
+			if fields[element.Key] {
+				return bson.D{{Key: "$and", Value: mongoArray(filters)}}
+			}
+			fields[element.Key] = true
+			merged = append(merged, element)
+		}
+	}
+	return merged
+}
+
+func mongoArray(filters []bson.D) bson.A {
+	values := make(bson.A, len(filters))
+	for i, filter := range filters {
+		values[i] = filter
+	}
+	return values
+}
+
+// substituteMongoOperands replaces the placeholders inside the mapping of a call-operand with the operands.
+// Placeholders which are used as keys are replaced with the paths of fields, all others with values. Values therefore
+// never become part of the filter's syntax.
+func substituteMongoOperands(mapped interface{}, operands []mongoOperand) (interface{}, error) {
+	switch v := mapped.(type) {
+	case bson.D:
+		result := make(bson.D, len(v))
+		for i, element := range v {
+			key := element.Key
+			if operand, isPlaceholder := mongoPlaceholder(key, operands); isPlaceholder {
+				if !operand.isField() {
+					return nil, errors.Errorf("MongoDatastoreTranslator: MongoDB can only compare fields with values, but got value %v instead of a field", operand.value)
 				}
-			} else {
-				if err := util.AppendToTop(&operands, fmt.Sprintf("\"%s\"", v.String())); err != nil {
-					return err
+				key = operand.path
+			}
+
+			value, err := substituteMongoOperands(element.Value, operands)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = bson.E{Key: key, Value: value}
+		}
+		return result, nil
+	case bson.A:
+		result := make(bson.A, len(v))
+		for i, element := range v {
+			value, err := substituteMongoOperands(element, operands)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case string:
+		if operand, isPlaceholder := mongoPlaceholder(v, operands); isPlaceholder {
+			if operand.isField() {
+				return nil, errors.Errorf("MongoDatastoreTranslator: MongoDB can only compare fields with values, but got field %q instead of a value", operand.path)
+			}
+			return operand.value, nil
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// mongoPlaceholder returns the operand which is referenced by the placeholder (if any).
+func mongoPlaceholder(s string, operands []mongoOperand) (mongoOperand, bool) {
+	match := mongoPlaceholderMatcher.FindStringSubmatch(s)
+	if match == nil {
+		return mongoOperand{}, false
+	}
+	index, err := strconv.Atoi(match[1])
+	if err != nil || index >= len(operands) {
+		return mongoOperand{}, false
+	}
+	return operands[index], true
+}
+
+func (o mongoOperand) isField() bool {
+	return o.path != ""
+}
+
+// MarshalJSON implements json.Marshaler, so that the queries are rendered as extended JSON (i.e. inside responses of filter requests).
+// Each collection is either rendered as filter document or as list of aggregation pipelines.
+func (s mongoStatement) MarshalJSON() ([]byte, error) {
+	rendered := make(map[string]interface{}, len(s))
+	for collection, query := range s {
+		if query.pipelines == nil {
+			raw, err := bson.MarshalExtJSON(query.filter, false, false)
+			if err != nil {
+				return nil, errors.Wrapf(err, "MongoDatastoreTranslator: Unable to render filter of collection %q", collection)
+			}
+			rendered[collection] = json.RawMessage(raw)
+			continue
+		}
+
+		pipelines := make([][]json.RawMessage, len(query.pipelines))
+		for i, pipeline := range query.pipelines {
+			for _, stage := range pipeline {
+				raw, err := bson.MarshalExtJSON(stage, false, false)
+				if err != nil {
+					return nil, errors.Wrapf(err, "MongoDatastoreTranslator: Unable to render pipeline of collection %q", collection)
 				}
+				pipelines[i] = append(pipelines[i], raw)
 			}
-		default:
-			// Stop function in case of error
-			return errors.Errorf("MongoDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
 		}
-		return nil
-	})
+		rendered[collection] = pipelines
+	}
+	return json.Marshal(rendered)
+}
+
+// Implements fmt.Stringer
+func (s mongoStatement) String() string {
+	rendered, err := s.MarshalJSON()
 	if err != nil {
-		logging.LogForComponent("mongoDatastoreTranslator").Debug(err)
+		return err.Error()
 	}
-	return result, err
+	return string(rendered)
 }
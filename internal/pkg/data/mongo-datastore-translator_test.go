@@ -0,0 +1,456 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+func newTestMongoTranslator(t *testing.T) data.DatastoreTranslator {
+	datastores := map[string]*configs.Datastore{
+		"mongo": {
+			Type: data.TypeMongo,
+			Connection: map[string]string{
+				"host":     "localhost",
+				"port":     "27017",
+				"database": "appstore",
+				"user":     "user",
+				"password": "password",
+			},
+			Metadata: map[string]string{},
+		},
+	}
+	callOps, err := LoadAllCallOperands(datastores, nil)
+	require.NoError(t, err)
+
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: datastores,
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"mongo": {
+					"appstore": {
+						Entities: []*configs.Entity{
+							{Name: "users"},
+							{Name: "apps", Entities: []*configs.Entity{
+								{Name: "rights", Entities: []*configs.Entity{{Name: "user", Alias: "users"}}},
+							}},
+						},
+					},
+				},
+			},
+		},
+		CallOperands: callOps,
+	}
+
+	translator := NewMongoDatastoreTranslator()
+	require.NoError(t, translator.Configure(appConf, "mongo"))
+	return translator
+}
+
+func Test_MongoTranslator_Execute(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Link: data.Link{Entities: []data.Entity{{Value: "rights"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("rights", "right", data.Constant{Value: "OWNER"}),
+				data.Disjunction{Clauses: []data.Node{
+					eqCall("apps", "name", data.Constant{Value: `a", "$where": "1`}),
+					data.Call{
+						Operator: data.Operator{Value: "lt"},
+						Operands: []data.Node{data.Constant{Value: int64(2)}, data.Attribute{Entity: data.Entity{Value: "apps"}, Name: "stars"}},
+					},
+				}},
+				data.Negation{Clause: eqCall("apps", "id", data.Constant{Value: int64(1)})},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apps": {"$or": [{
+		"rights": {"$elemMatch": {"right": "OWNER"}},
+		"$or": [{"name": "a\", \"$where\": \"1"}, {"stars": {"$gt": 2}}],
+		"$nor": [{"id": 1}]
+	}]}}`, string(rendered))
+}
+
+func Test_MongoTranslator_Filter(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	filter, err := translator.Filter(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "age", data.Constant{Value: int64(42)})},
+		},
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Link: data.Link{Entities: []data.Entity{{Value: "apps"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("apps", "owner_id", data.Attribute{Entity: data.Entity{Value: "users"}, Name: "id"}),
+				eqCall("apps", "name", data.Constant{Value: "Kelon"}),
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Documents are matched by a lookup of themselves, so that they are neither limited nor unwound
+	rendered, err := json.Marshal(filter.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [[
+		{"$lookup": {
+			"from": "users",
+			"let": {"root": "$_id"},
+			"pipeline": [
+				{"$match": {"$expr": {"$eq": ["$_id", "$$root"]}}},
+				{"$lookup": {"from": "apps", "localField": "id", "foreignField": "owner_id", "as": "apps"}},
+				{"$unwind": "$apps"},
+				{"$match": {"apps.name": "Kelon"}},
+				{"$limit": 1}
+			],
+			"as": "_match0"
+		}},
+		{"$match": {"$or": [{"age": 42}, {"_match0": {"$ne": []}}]}},
+		{"$project": {"_match0": 0}}
+	]]}`, string(rendered))
+
+	// Collections without linked collections are still filtered by documents
+	filter, err = translator.Filter(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "name", data.Constant{Value: "Arnold"})},
+		},
+	}})
+	require.NoError(t, err)
+	rendered, err = json.Marshal(filter.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": {"$or": [{"name": "Arnold"}]}}`, string(rendered))
+}
+
+func Test_MongoTranslator_Conjunction(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				data.Negation{Clause: eqCall("users", "age", data.Constant{Value: int64(42)})},
+				data.Negation{Clause: eqCall("users", "friend", data.Constant{Value: nil})},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Filters on the same field can not be merged into one document
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": {"$or": [{"$and": [
+		{"name": "Arnold"},
+		{"$nor": [{"age": 42}]},
+		{"$nor": [{"friend": null}]}
+	]}]}}`, string(rendered))
+}
+
+func Test_MongoTranslator_Negation(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+	banned := data.Entity{Value: "users", Alias: "users_2"}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				data.Negation{Clause: eqCall("users", "role", data.Constant{Value: "BANNED"})},
+			}}},
+		},
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Kevin"}),
+				// Negated support rule, i.e. "not count([x | data.mongo.users[x].role == "BANNED"; ...]) > 0"
+				data.Negation{Clause: data.Call{
+					Operator: data.Operator{Value: "gt"},
+					Operands: []data.Node{
+						data.Aggregate{
+							Function: data.Operator{Value: "count"},
+							Query: data.Query{
+								From: banned,
+								Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+									data.Call{
+										Operator: data.Operator{Value: "eq"},
+										Operands: []data.Node{data.Attribute{Entity: banned, Name: "role"}, data.Constant{Value: "BANNED"}},
+									},
+								}}},
+							},
+						},
+						data.Constant{Value: int64(0)},
+					},
+				}},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [
+		[{"$match": {"$or": [{"name": "Arnold", "$nor": [{"role": "BANNED"}]}]}}, {"$limit": 1}],
+		[
+			{"$match": {"name": "Kevin"}},
+			{"$lookup": {
+				"from": "users",
+				"pipeline": [
+					{"$match": {"role": "BANNED"}},
+					{"$count": "value"}
+				],
+				"as": "_aggregate0"
+			}},
+			{"$addFields": {"_aggregate0": {"$ifNull": [{"$arrayElemAt": ["$_aggregate0.value", 0]}, 0]}}},
+			{"$match": {"$nor": [{"_aggregate0": {"$gt": 0}}]}},
+			{"$limit": 1}
+		]
+	]}`, string(rendered))
+}
+
+func Test_MongoTranslator_LargeNumber(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "id", data.Constant{Value: json.Number("123456789012345678901234567890")})},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Integers exceeding int64 are compared as decimals
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": {"$or": [{"id": {"$numberDecimal": "123456789012345678901234567890"}}]}}`, string(rendered))
+}
+
+func Test_MongoTranslator_ElemMatch(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Link: data.Link{Entities: []data.Entity{{Value: "rights"}, {Value: "rights", Alias: "rights_2"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("apps", "id", data.Constant{Value: int64(2)}),
+				eqCall("rights", "right", data.Constant{Value: "OWNER"}),
+				eqCall("rights", "user_id", data.Constant{Value: int64(1)}),
+				data.Call{
+					Operator: data.Operator{Value: "eq"},
+					Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: "rights", Alias: "rights_2"}, Name: "right"}, data.Constant{Value: "READ"}},
+				},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Conditions on the same iterator have to match the same element, all iterators are matched independently
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apps": {"$or": [{"$and": [
+		{"id": 2},
+		{"rights": {"$elemMatch": {"right": "OWNER", "user_id": 1}}},
+		{"rights": {"$elemMatch": {"right": "READ"}}}
+	]}]}}`, string(rendered))
+
+	// Deeper entities belong to the first iterator of their array as long as it is the only one
+	query, err = translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Link: data.Link{Entities: []data.Entity{{Value: "rights"}, {Value: "users"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("rights", "right", data.Constant{Value: "OWNER"}),
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+	rendered, err = json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apps": {"$or": [{"rights": {"$elemMatch": {"right": "OWNER", "user.name": "Arnold"}}}]}}`, string(rendered))
+}
+
+func Test_MongoTranslator_AmbiguousDeeperAttribute(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	_, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Link: data.Link{Entities: []data.Entity{{Value: "rights"}, {Value: "users"}, {Value: "rights", Alias: "rights_2"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("rights", "right", data.Constant{Value: "OWNER"}),
+				data.Call{
+					Operator: data.Operator{Value: "eq"},
+					Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: "rights", Alias: "rights_2"}, Name: "right"}, data.Constant{Value: "READ"}},
+				},
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+			}}},
+		},
+	}})
+	assert.ErrorContains(t, err, "is ambiguous")
+}
+
+func Test_MongoTranslator_Lookup(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Link: data.Link{Entities: []data.Entity{{Value: "apps"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				eqCall("apps", "owner_id", data.Attribute{Entity: data.Entity{Value: "users"}, Name: "id"}),
+				data.Call{
+					Operator: data.Operator{Value: "gt"},
+					Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: "apps"}, Name: "stars"}, data.Constant{Value: int64(2)}},
+				},
+			}}},
+		},
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Link: data.Link{Entities: []data.Entity{{Value: "users", Alias: "users_2"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "friend", data.Attribute{Entity: data.Entity{Value: "users", Alias: "users_2"}, Name: "name"}),
+				eqCall("users_2", "name", data.Constant{Value: "Kevin"}),
+			}}},
+		},
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "age", data.Constant{Value: int64(42)})},
+		},
+	}})
+	require.NoError(t, err)
+
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [
+		[{"$match": {"$or": [{"age": 42}]}}, {"$limit": 1}],
+		[
+			{"$match": {"name": "Arnold"}},
+			{"$lookup": {"from": "apps", "localField": "id", "foreignField": "owner_id", "as": "apps"}},
+			{"$unwind": "$apps"},
+			{"$match": {"apps.stars": {"$gt": 2}}},
+			{"$limit": 1}
+		],
+		[
+			{"$lookup": {"from": "users", "localField": "friend", "foreignField": "name", "as": "users_2"}},
+			{"$unwind": "$users_2"},
+			{"$match": {"users_2.name": "Kevin"}},
+			{"$limit": 1}
+		]
+	]}`, string(rendered))
+
+	// Linked collections have to be related to the queried documents
+	_, err = translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Link:      data.Link{Entities: []data.Entity{{Value: "apps"}}},
+			Condition: data.Condition{Clause: eqCall("apps", "id", data.Constant{Value: int64(1)})},
+		},
+	}})
+	assert.ErrorContains(t, err, "has to be related to the queried documents")
+}
+
+func Test_MongoTranslator_SelfLink(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+	friend := data.Entity{Value: "users", Alias: "users_friend1"}
+
+	// The query may start at a further iterator of the collection, e.g. if the policy references it first
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: friend,
+			Link: data.Link{Entities: []data.Entity{{Value: "users"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				data.Call{
+					Operator: data.Operator{Value: "eq"},
+					Operands: []data.Node{data.Attribute{Entity: friend, Name: "role"}, data.Constant{Value: "ADMIN"}},
+				},
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				eqCall("users", "friend", data.Attribute{Entity: friend, Name: "name"}),
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [[
+		{"$match": {"role": "ADMIN"}},
+		{"$lookup": {"from": "users", "localField": "name", "foreignField": "friend", "as": "users"}},
+		{"$unwind": "$users"},
+		{"$match": {"users.name": "Arnold"}},
+		{"$limit": 1}
+	]]}`, string(rendered))
+}
+
+func Test_MongoTranslator_Aggregate(t *testing.T) {
+	translator := newTestMongoTranslator(t)
+	friend := data.Entity{Value: "users", Alias: "users_2"}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				data.Call{
+					Operator: data.Operator{Value: "lt"},
+					Operands: []data.Node{
+						data.Aggregate{
+							Function: data.Operator{Value: "max"},
+							Value:    data.Attribute{Entity: friend, Name: "age"},
+							Query: data.Query{
+								From: friend,
+								Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+									data.Call{
+										Operator: data.Operator{Value: "eq"},
+										Operands: []data.Node{data.Attribute{Entity: friend, Name: "friend"}, data.Attribute{Entity: data.Entity{Value: "users"}, Name: "name"}},
+									},
+									data.Call{
+										Operator: data.Operator{Value: "neq"},
+										Operands: []data.Node{data.Attribute{Entity: friend, Name: "name"}, data.Constant{Value: "$name"}},
+									},
+								}}},
+							},
+						},
+						data.Constant{Value: int64(42)},
+					},
+				},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Attributes of the queried documents are passed as variables, values of the aggregated documents are never field paths
+	rendered, err := json.Marshal(query.Statement)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"users": [[
+		{"$match": {"name": "Arnold"}},
+		{"$lookup": {
+			"from": "users",
+			"let": {"v0": "$name"},
+			"pipeline": [
+				{"$match": {"$expr": {"$and": [{"$eq": ["$friend", "$$v0"]}]}}},
+				{"$match": {"name": {"$ne": "$name"}}},
+				{"$group": {"_id": null, "value": {"$max": "$age"}}}
+			],
+			"as": "_aggregate0"
+		}},
+		{"$addFields": {"_aggregate0": {"$ifNull": [{"$arrayElemAt": ["$_aggregate0.value", 0]}, null]}}},
+		{"$match": {"_aggregate0": {"$lt": 42}}},
+		{"$limit": 1}
+	]]}`, string(rendered))
+}
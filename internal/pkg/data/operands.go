@@ -53,6 +53,20 @@ func (h GenericCallOpMapper) Map(args ...string) (string, error) {
 	return result, nil
 }
 
+// memoryCallOpMapper maps a call-operand of the memory datastore to the name of the memory operator which evaluates the call.
+type memoryCallOpMapper struct {
+	operator string
+	target   string
+}
+
+func (h memoryCallOpMapper) Handles() string {
+	return h.operator
+}
+
+func (h memoryCallOpMapper) Map(_ ...string) (string, error) {
+	return h.target, nil
+}
+
 type callHandlers struct {
 	CallOperands []*loadedCallHandler `yaml:"call-operands"`
 }
@@ -116,6 +130,9 @@ func (h *loadedCallHandler) Map(args ...string) (string, error) {
 
 // LoadAllCallOperands will try loading the call operands from the configured directory.
 // If directory was not configured or and error while parsing occurred, the default call operands will be used.
+//
+// Call operands of memory datastores map to the name of a memory operator instead of a query fragment.
+// Therefore, the mapping of a custom call operand of a memory datastore has to be the name of a memory operator (i.e. 'abs').
 func LoadAllCallOperands(dsConfs map[string]*configs.Datastore, callOperandsDir *string) (map[string]map[string]func(args ...string) (string, error), error) {
 	operands := map[string]map[string]func(args ...string) (string, error){}
 	dsFunctions := map[string]int{}
@@ -125,14 +142,18 @@ func LoadAllCallOperands(dsConfs map[string]*configs.Datastore, callOperandsDir
 		var customHandlers []data.CallOpMapper
 		var parseErr error
 
-		defaultHandlers, parseErr = loadDefaultDatastoreCallOps(dsConf.Type, dsFunctions)
+		if dsConf.Type == data.TypeMemory {
+			defaultHandlers = loadDefaultMemoryCallOps()
+		} else {
+			defaultHandlers, parseErr = loadDefaultDatastoreCallOps(dsConf.Type, dsFunctions)
+		}
 		if parseErr != nil {
 			return nil, errors.Wrapf(parseErr, "unable to load call operands for datastores of type %s", dsConf.Type)
 		}
 
 		if callOperandsDir != nil && *callOperandsDir != "" {
 			callOpsFilePath := fmt.Sprintf("%s/%s.yml", *callOperandsDir, strings.ToLower(dsConf.Type))
-			customHandlers, parseErr = loadDatastoreCallOpsFile(callOpsFilePath, dsFunctions)
+			customHandlers, parseErr = loadDatastoreCallOpsFile(callOpsFilePath, dsConf.Type, dsFunctions)
 			if parseErr != nil {
 				logging.LogForComponent("callOperandsLoader").Warnf("failed loading custom call operands for %s. Only default call operands will be used: %s", dsConf.Type, parseErr.Error())
 			}
@@ -152,7 +173,7 @@ func LoadAllCallOperands(dsConfs map[string]*configs.Datastore, callOperandsDir
 	return operands, nil
 }
 
-func loadDatastoreCallOpsBytes(input []byte, dsFunctions map[string]int) ([]data.CallOpMapper, error) {
+func loadDatastoreCallOpsBytes(input []byte, dsType string, dsFunctions map[string]int) ([]data.CallOpMapper, error) {
 	if input == nil {
 		return nil, errors.Errorf("Data must not be nil! ")
 	}
@@ -174,6 +195,13 @@ func loadDatastoreCallOpsBytes(input []byte, dsFunctions map[string]int) ([]data
 			dsFunctions[h.Operator] = h.ArgsCount
 		}
 
+		if dsType == data.TypeMemory {
+			if operator, ok := memoryOperators[h.Mapping]; !ok || operator.args != h.ArgsCount {
+				return nil, errors.Errorf("call operand %q with %d args has to be mapped to a memory operator with the same args, but is mapped to %q", h.Operator, h.ArgsCount, h.Mapping)
+			}
+			result[i] = memoryCallOpMapper{operator: h.Operator, target: h.Mapping}
+			continue
+		}
 		if err := h.Init(); err != nil {
 			return nil, errors.Wrap(err, "Error while loading call operands")
 		}
@@ -183,7 +211,7 @@ func loadDatastoreCallOpsBytes(input []byte, dsFunctions map[string]int) ([]data
 	return result, nil
 }
 
-func loadDatastoreCallOpsFile(filePath string, dsFunctions map[string]int) ([]data.CallOpMapper, error) {
+func loadDatastoreCallOpsFile(filePath, dsType string, dsFunctions map[string]int) ([]data.CallOpMapper, error) {
 	if filePath == "" {
 		return nil, errors.Errorf("FilePath must not be empty! ")
 	}
@@ -191,7 +219,7 @@ func loadDatastoreCallOpsFile(filePath string, dsFunctions map[string]int) ([]da
 	// Load datastoreOpsBytes from file
 	datastoreOpsBytes, ioError := os.ReadFile(filePath)
 	if ioError == nil {
-		return loadDatastoreCallOpsBytes(datastoreOpsBytes, dsFunctions)
+		return loadDatastoreCallOpsBytes(datastoreOpsBytes, dsType, dsFunctions)
 	}
 	return nil, errors.Wrap(ioError, "Unable to load datastore-call-operands")
 }
@@ -203,5 +231,14 @@ func loadDefaultDatastoreCallOps(dsType string, dsFunctions map[string]int) ([]d
 		return nil, errors.Wrapf(ioError, "unable to load default call-operands for datastore %q", dsType)
 	}
 
-	return loadDatastoreCallOpsBytes(opsBytes, dsFunctions)
+	return loadDatastoreCallOpsBytes(opsBytes, dsType, dsFunctions)
+}
+
+// loadDefaultMemoryCallOps maps each memory operator to itself.
+func loadDefaultMemoryCallOps() []data.CallOpMapper {
+	result := make([]data.CallOpMapper, 0, len(memoryOperators))
+	for operator := range memoryOperators {
+		result = append(result, memoryCallOpMapper{operator: operator, target: operator})
+	}
+	return result
 }
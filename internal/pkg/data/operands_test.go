@@ -45,3 +45,17 @@ func Test_Operands_LoadNonExisting(t *testing.T) {
 	_, err := LoadAllCallOperands(dummyDatastoreConf, &dirpath)
 	assert.NoError(t, err, "no errors should be thrown. default call operands should be loaded")
 }
+
+func Test_Operands_LoadMemory(t *testing.T) {
+	dirpath := "./testdata"
+	handlers, err := LoadAllCallOperands(map[string]*configs.Datastore{"mem": {Type: data.TypeMemory}}, &dirpath)
+	assert.NoError(t, err, "loading the memory call operands should not result in an error")
+
+	eq, err := handlers["memory"]["eq"]()
+	assert.NoError(t, err, "Mapping 'eq' should be included in call-ops mappings for memory")
+	assert.Equal(t, "eq", eq)
+
+	custom, err := handlers["memory"]["absolute"]()
+	assert.NoError(t, err, "Mapping 'absolute' should be included in call-ops mappings for memory")
+	assert.Equal(t, "abs", custom)
+}
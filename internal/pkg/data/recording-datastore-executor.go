@@ -0,0 +1,37 @@
+package data
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+type recordingDatastoreExecutor struct {
+	alias    string
+	executor data.DatastoreExecutor
+	record   func(alias string, query data.DatastoreQuery)
+}
+
+// NewRecordingDatastoreExecutor Returns a new data.DatastoreExecutor which passes each query to record before it is executed by the passed executor.
+func NewRecordingDatastoreExecutor(executor data.DatastoreExecutor, record func(alias string, query data.DatastoreQuery)) data.DatastoreExecutor {
+	return &recordingDatastoreExecutor{
+		alias:    "",
+		executor: executor,
+		record:   record,
+	}
+}
+
+func (ds *recordingDatastoreExecutor) Configure(appConf *configs.AppConfig, alias string) error {
+	if err := ds.executor.Configure(appConf, alias); err != nil {
+		return errors.Wrap(err, "RecordingDatastoreExecutor:")
+	}
+	ds.alias = alias
+	return nil
+}
+
+func (ds *recordingDatastoreExecutor) Execute(ctx context.Context, query data.DatastoreQuery) (bool, error) {
+	ds.record(ds.alias, query)
+	return ds.executor.Execute(ctx, query)
+}
@@ -19,18 +19,25 @@ import (
 )
 
 type sqlDatastoreExecutor struct {
-	dbPool  *sql.DB
-	appConf *configs.AppConfig
+	dbPool     *sql.DB
+	appConf    *configs.AppConfig
+	configured bool
 }
 
 func NewSQLDatastoreExecutor() data.DatastoreExecutor {
 	return &sqlDatastoreExecutor{
-		dbPool:  nil,
-		appConf: nil,
+		dbPool:     nil,
+		appConf:    nil,
+		configured: false,
 	}
 }
 
 func (ds *sqlDatastoreExecutor) Configure(appConf *configs.AppConfig, alias string) error {
+	// Exit if already configured
+	if ds.configured {
+		return nil
+	}
+
 	// Validate config
 	conf, e := extractAndValidateDatastore(appConf, alias)
 	if e != nil {
@@ -38,7 +45,13 @@ func (ds *sqlDatastoreExecutor) Configure(appConf *configs.AppConfig, alias stri
 	}
 
 	// Init database connection pool
-	db, err := sql.Open(conf.Type, getConnectionStringForPlatform(conf.Type, conf.Connection))
+	var db *sql.DB
+	var err error
+	if conf.Type == data.TypeSqlite {
+		db, err = openSqliteDatabase(conf.Connection)
+	} else {
+		db, err = sql.Open(conf.Type, getConnectionStringForPlatform(conf.Type, conf.Connection))
+	}
 	if err != nil {
 		return errors.Wrap(err, "SqlDatastore: Error while connecting to database")
 	}
@@ -57,9 +70,18 @@ func (ds *sqlDatastoreExecutor) Configure(appConf *configs.AppConfig, alias stri
 
 	ds.appConf = appConf
 	ds.dbPool = db
+	ds.configured = true
 	return nil
 }
 
+// Close closes the connection pool of the executor.
+func (ds *sqlDatastoreExecutor) Close() error {
+	if !ds.configured {
+		return nil
+	}
+	return ds.dbPool.Close()
+}
+
 func (ds *sqlDatastoreExecutor) applyMetadataConfigs(conf *configs.Datastore, db *sql.DB) error {
 	if conf.Metadata == nil {
 		return nil
@@ -95,7 +117,8 @@ func (ds *sqlDatastoreExecutor) Execute(ctx context.Context, query data.Datastor
 		return false, errors.Errorf("Passed statement was not of type string but of type: %T", query.Statement)
 	}
 
-	rows, err := ds.dbPool.Query(sqlStatement, query.Parameters...)
+	// The statement is canceled as soon as the request is canceled or its deadline is exceeded
+	rows, err := ds.dbPool.QueryContext(ctx, sqlStatement, query.Parameters...)
 	if err != nil {
 		return false, errors.Wrap(err, "sqlDatastoreExecutor: Error while executing statement")
 	}
@@ -105,6 +128,7 @@ func (ds *sqlDatastoreExecutor) Execute(ctx context.Context, query data.Datastor
 		}
 	}()
 
+	// Each query shape results in a positive number for matching rows, therefore reading stops at the first positive row
 	result := false
 	for rows.Next() {
 		var count int
@@ -117,6 +141,9 @@ func (ds *sqlDatastoreExecutor) Execute(ctx context.Context, query data.Datastor
 			break
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return false, errors.Wrap(err, "SqlDatastore: Unable to read result")
+	}
 
 	if !result {
 		logging.LogForComponent("sqlDatastoreExecutor").Debugf("No resulting row with count > 0 found! -> DENIED")
@@ -2,20 +2,45 @@ package data
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/unbasical/kelon/configs"
 	"github.com/unbasical/kelon/internal/pkg/util"
+	"github.com/unbasical/kelon/pkg/constants"
 	"github.com/unbasical/kelon/pkg/constants/logging"
 	"github.com/unbasical/kelon/pkg/data"
+	internalErrors "github.com/unbasical/kelon/pkg/errors"
+)
+
+// sqlNull is the operand of null constants, which are not bound as parameters.
+const sqlNull = "NULL"
+
+// sqlEmptySet is the operand of empty collections. Memberships in an empty collection are rendered as sqlFalse,
+// because SQL does not allow empty value lists and NOT (x IN (NULL)) would be NULL instead of true.
+const sqlEmptySet = "()"
+
+// sqlFalse is a predicate which is never true.
+const sqlFalse = "1 = 0"
+
+// Query shapes, which can be configured with the datastore's metadata constants.MetaQueryShape.
+const (
+	// sqlQueryShapeCount counts all matching rows of each query (default).
+	sqlQueryShapeCount = "count"
+	// sqlQueryShapeExists checks the existence of a matching row for each query.
+	sqlQueryShapeExists = "exists"
+	// sqlQueryShapeLimit selects only the first matching row of all queries.
+	sqlQueryShapeLimit = "limit"
 )
 
 type sqlDatastoreTranslator struct {
 	appConf    *configs.AppConfig
 	alias      string
 	platform   string
+	queryShape string
 	conn       map[string]string
 	schemas    map[string]*configs.EntitySchema
 	callOps    map[string]func(args ...string) (string, error)
@@ -48,10 +73,14 @@ func (ds *sqlDatastoreTranslator) Configure(appConf *configs.AppConfig, alias st
 			return errors.Errorf("SqlDatastoreTranslator: DatastoreTranslator with alias [%s] has no schemas configured!", alias)
 		}
 
+		attachments := getSqliteAttachments(conf.Connection)
 		for schemaName, schema := range schemas {
 			if schema.HasNestedEntities() {
 				return errors.Errorf("SqlDatastoreTranslator: Schema %q in datastore with alias [%s] contains nested entities which is not supported by SQL-Datastores yet!", schemaName, alias)
 			}
+			if _, attached := attachments[schemaName]; conf.Type == data.TypeSqlite && !attached && schemaName != sqliteMainSchema && schemaName != sqliteTempSchema {
+				return errors.Errorf("SqlDatastoreTranslator: Schema %q in sqlite datastore with alias [%s] is neither %q, %q nor attached with connection field %q!", schemaName, alias, sqliteMainSchema, sqliteTempSchema, sqliteAttachPrefix+schemaName)
+			}
 		}
 	} else {
 		return errors.Errorf("SqlDatastoreTranslator: DatastoreTranslator with alias [%s] has no entity-schema-mapping configured!", alias)
@@ -65,6 +94,18 @@ func (ds *sqlDatastoreTranslator) Configure(appConf *configs.AppConfig, alias st
 	ds.callOps = operands
 	logging.LogForComponent("sqlDatastoreTranslator").Infof("SqlDatastoreTranslator [%s] laoded call operands", alias)
 
+	// Load query shape
+	queryShape := sqlQueryShapeCount
+	if shape, ok := conf.Metadata[constants.MetaQueryShape]; ok {
+		queryShape = shape
+	}
+	switch queryShape {
+	case sqlQueryShapeCount, sqlQueryShapeExists, sqlQueryShapeLimit:
+		ds.queryShape = queryShape
+	default:
+		return errors.Errorf("SqlDatastoreTranslator: Datastore with alias [%s] has unknown %s %q! Allowed are %q, %q and %q", alias, constants.MetaQueryShape, queryShape, sqlQueryShapeCount, sqlQueryShapeExists, sqlQueryShapeLimit)
+	}
+
 	// Assign values
 	ds.conn = conf.Connection
 	ds.platform = conf.Type
@@ -83,7 +124,7 @@ func (ds *sqlDatastoreTranslator) Execute(ctx context.Context, query data.Node)
 	logging.LogForComponent("sqlDatastoreTranslator").Debugf("TRANSLATING QUERY: ==================%+v==================", query.String())
 
 	// Translate query to into sql statement
-	statement, params, err := ds.translatePrepared(query)
+	statement, params, err := ds.translatePrepared(query, false)
 	if err != nil {
 		return data.DatastoreQuery{}, err
 	}
@@ -93,8 +134,71 @@ func (ds *sqlDatastoreTranslator) Execute(ctx context.Context, query data.Node)
 	return data.DatastoreQuery{Statement: statement, Parameters: params}, nil
 }
 
+// Filter translates the query into a condition on the root entity of its queries. The placeholders of PostgreSQL are numbered
+// from $1 in the order of the parameters, so that callers with own parameters have to shift them by the number of their parameters.
+func (ds *sqlDatastoreTranslator) Filter(ctx context.Context, query data.Node) (data.DatastoreQuery, error) {
+	if !ds.configured {
+		return data.DatastoreQuery{}, errors.Errorf("SqlDatastoreTranslator: DatastoreTranslator was not configured! Please call Configure(). ")
+	}
+	logging.LogForComponent("sqlDatastoreTranslator").Debugf("TRANSLATING FILTER: ==================%+v==================", query.String())
+
+	if err := sqlValidateFilterRoot(query); err != nil {
+		return data.DatastoreQuery{}, err
+	}
+
+	// Translate query to into sql condition
+	condition, params, err := ds.translatePrepared(query, true)
+	if err != nil {
+		return data.DatastoreQuery{}, err
+	}
+
+	logging.LogForComponent("sqlDatastoreTranslator").Debugf("FILTER CONDITION: ==================%s==================\nPARAMS: %+v", condition, params)
+
+	return data.DatastoreQuery{Statement: condition, Parameters: params}, nil
+}
+
+// sqlValidateFilterRoot checks that all queries of the union have the same root entity, because the caller appends the
+// filter to the WHERE-clause of a single query on this entity.
+func sqlValidateFilterRoot(input data.Node) error {
+	union, ok := input.(data.Union)
+	if !ok {
+		return nil
+	}
+
+	var root *data.Entity
+	for _, clause := range union.Clauses {
+		query, isQuery := clause.(data.Query)
+		if !isQuery {
+			continue
+		}
+		if root == nil {
+			from := query.From
+			root = &from
+			continue
+		}
+		if query.From != *root {
+			return internalErrors.InvalidRequestTranslation{Causes: []string{
+				fmt.Sprintf("SqlDatastoreTranslator: Filters have to be rooted at the same entity, but got %q and %q", root.String(), query.From.String()),
+			}}
+		}
+	}
+	return nil
+}
+
+// translatePrepared translates the input into a prepared statement, which results in a positive number for any matching row
+// (see sqlQueryShapeCount, sqlQueryShapeExists and sqlQueryShapeLimit).
+// If asFilter is set, each query is translated into a plain condition instead, which can be appended to the WHERE-clause
+// of a query on the query's root entity. Linked entities are therefore checked by an EXISTS-subquery.
+func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node, asFilter bool) (q string, params []interface{}, err error) {
+	return ds.translateStatement(input, asFilter, "", nil)
+}
+
+// translateStatement translates the input like translatePrepared. If a selection is passed, each query selects it instead
+// of the configured query shape. The parameters of the statement are appended to the passed values, so that the statement
+// can be embedded into another one.
+//
 // nolint:gocyclo,gocritic
-func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string, params []interface{}, err error) {
+func (ds *sqlDatastoreTranslator) translateStatement(input data.Node, asFilter bool, selection string, values []interface{}) (q string, params []interface{}, err error) {
 	var query util.Stack[string]
 	var selects util.Stack[string]
 	var entities util.Stack[string]
@@ -103,15 +207,25 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 
 	var operands util.Stack[[]string]
 
-	// Used for prepared statements
-	var values []interface{}
+	// Linked entities are joined on their relations to the query's root entity. Filters have no root entity inside
+	// their subquery, which is why they keep all relations inside their condition.
+	if !asFilter {
+		input = sqlJoinLinkedEntities(input)
+	}
 
 	// Walk input
 	err = input.Walk(func(q data.Node) error {
 		switch v := q.(type) {
 		case data.Union:
 			// Expected stack:  top -> [Queries...]
-			query.Push(strings.Join(selects.Values(), " UNION "))
+			switch {
+			case asFilter:
+				query.Push(strings.Join(selects.Values(), " OR "))
+			case selection != "":
+				query.Push(strings.Join(selects.Values(), " UNION "))
+			default:
+				query.Push(ds.sqlUnion(selects.Values()))
+			}
 			selects.Clear()
 		case data.Query:
 			// Expected stack: entities-top -> [singleEntity] relations-top -> [singleCondition]
@@ -140,10 +254,33 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 				}
 			}
 
-			//nolint:gosec
-			selects.Push(fmt.Sprintf("SELECT count(*) FROM %s%s%s", entity, joinClause, condition))
+			switch {
+			case selection != "":
+				selects.Push(sqlSelectValue(selection, entity+joinClause, condition))
+			case !asFilter:
+				selects.Push(ds.sqlSelect(entity+joinClause, condition))
+			case condition == "":
+				// Each row of the root entity fulfills the query
+				selects.Push("1 = 1")
+			case joinClause == "":
+				selects.Push(condition)
+			default:
+				// Linked entities are not part of the caller's query
+				//nolint:gosec
+				selects.Push(fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", strings.TrimPrefix(joinClause, ", "), condition))
+			}
 			joins.Clear()
 			relations.Clear()
+		case data.Join:
+			// Expected stack: entities-top -> [joinedEntity] relations-top -> [joinConditions...]
+			var entity string
+			entity, err = entities.Pop()
+			if err != nil {
+				return err
+			}
+			//nolint:gosec
+			joins.Push(fmt.Sprintf(" INNER JOIN %s ON %s", entity, strings.Join(relations.Values(), " AND ")))
+			relations.Clear()
 		case data.Link:
 			// Expected stack: entities-top -> [entities]
 			for _, entity := range entities.Values() {
@@ -152,16 +289,8 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 			entities.Clear()
 		case data.Condition:
 			// Expected stack: relations-top -> [singleRelation]
-			if !relations.IsEmpty() {
-				var rel string
-				rel, err = relations.Pop()
-				if err != nil {
-					return err
-				}
-				//nolint:gosec
-				relations.Push(fmt.Sprintf(" WHERE %s", rel))
-				logging.LogForComponent("sqlDatastoreTranslator").Debugf("CONDITION: relations |%+v <- TOP", relations)
-			}
+			// The relation is left on the stack and rendered by the surrounding query
+			logging.LogForComponent("sqlDatastoreTranslator").Debugf("CONDITION: relations |%+v <- TOP", relations)
 		case data.Disjunction:
 			// Expected stack: relations-top -> [disjunctions ...]
 			if !relations.IsEmpty() {
@@ -177,6 +306,14 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 				relations.Push(fmt.Sprintf("(%s)", strings.Join(rels, " AND ")))
 				logging.LogForComponent("sqlDatastoreTranslator").Debugf("CONJUNCTION: relations |%+v <- TOP", relations)
 			}
+		case data.Negation:
+			// Expected stack: relations-top -> [negatedRelation, ...]
+			var negated string
+			negated, err = relations.Pop()
+			if err != nil {
+				return err
+			}
+			relations.Push(fmt.Sprintf("NOT (%s)", negated))
 		case data.Attribute:
 			// Expected stack:  top -> [entity, ...]
 			var entity string
@@ -184,6 +321,10 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 			if err != nil {
 				return err
 			}
+			if v.Entity.Alias != "" {
+				// Further iterators of an entity are qualified by their alias
+				entity = v.Entity.Alias
+			}
 			if err = util.AppendToTop(&operands, fmt.Sprintf("%s.%s", entity, v.Name)); err != nil {
 				return err
 			}
@@ -198,7 +339,11 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 
 			// Handle Call
 			var nextRel string
-			if sqlCallOp, ok := ds.callOps[op]; ok {
+			if nullRel, isNullComparison := sqlNullComparison(op, ops[1:]); isNullComparison {
+				nextRel = nullRel
+			} else if isSQLEmptyMembership(op, ops[1:]) {
+				nextRel = sqlFalse
+			} else if sqlCallOp, ok := ds.callOps[op]; ok {
 				// Expected stack:  top -> [args..., call-op]
 				logging.LogForComponent("sqlDatastoreTranslator").Debugln("NEW FUNCTION CALL")
 				var callOpError error
@@ -220,28 +365,62 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 				relations.Push(nextRel)
 				logging.LogForComponent("sqlDatastoreTranslator").Debugf("RELATION DONE: relations |%+v <- TOP", relations)
 			}
+		case data.Aggregate:
+			// Expected stack:  top -> [args...]
+			var subquery string
+			subquery, values, err = ds.sqlAggregate(v, values)
+			if err != nil {
+				return err
+			}
+			if err = util.AppendToTop(&operands, subquery); err != nil {
+				return err
+			}
 		case data.Operator:
 			operands.Push([]string{})
 			if err = util.AppendToTop(&operands, v.String()); err != nil {
 				return err
 			}
 		case data.Entity:
-			schema, entity, schemaError := ds.findSchemaForEntity(v.String())
+			schema, entity, schemaError := ds.findSchemaForEntity(v.Value)
 			if schemaError != nil {
 				return schemaError
 			}
-			if schema == "public" && ds.appConf.Datastores[ds.alias].Type == "postgres" {
-				// Special handle when datastore is postgres and schema is public
-				entities.Push(entity.Name)
-			} else {
-				// Normal case for all entities
-				entities.Push(fmt.Sprintf("%s.%s", schema, entity.Name))
+			table := entity.Name
+			if schema != "" {
+				// Normal case for all entities, which are not addressed without schema
+				table = fmt.Sprintf("%s.%s", schema, entity.Name)
+			}
+			if v.Alias != "" {
+				table = fmt.Sprintf("%s AS %s", table, v.Alias)
 			}
+			entities.Push(table)
 		case data.Constant:
-			values = append(values, v.String())
+			if v.IsNull() {
+				// NULL is never bound as parameter, because comparisons with NULL have to be rendered as IS NULL
+				if err = util.AppendToTop(&operands, sqlNull); err != nil {
+					return err
+				}
+				break
+			}
+			values = append(values, sqlParameter(ds.platform, v.Value))
 			if err = util.AppendToTop(&operands, getPreparePlaceholderForPlatform(ds.platform, len(values))); err != nil {
 				return err
 			}
+		case data.Collection:
+			if len(v.Values) == 0 {
+				if err = util.AppendToTop(&operands, sqlEmptySet); err != nil {
+					return err
+				}
+				break
+			}
+			placeholders := make([]string, len(v.Values))
+			for i, value := range v.Values {
+				values = append(values, sqlParameter(ds.platform, value.Value))
+				placeholders[i] = getPreparePlaceholderForPlatform(ds.platform, len(values))
+			}
+			if err = util.AppendToTop(&operands, fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))); err != nil {
+				return err
+			}
 
 		default:
 			return errors.Errorf("SqlDatastoreTranslator: Unexpected input: %T -> %+v", v, v)
@@ -254,11 +433,232 @@ func (ds *sqlDatastoreTranslator) translatePrepared(input data.Node) (q string,
 	return strings.Join(query.Values(), ""), values, err
 }
 
+// sqlSelect renders a single query on the entities in the configured query shape.
+func (ds *sqlDatastoreTranslator) sqlSelect(from, condition string) string {
+	if condition != "" {
+		from = fmt.Sprintf("%s WHERE %s", from, condition)
+	}
+
+	switch ds.queryShape {
+	case sqlQueryShapeExists:
+		return fmt.Sprintf("SELECT CASE WHEN EXISTS (SELECT 1 FROM %s) THEN 1 ELSE 0 END", from)
+	case sqlQueryShapeLimit:
+		return fmt.Sprintf("SELECT 1 FROM %s", from)
+	default:
+		return fmt.Sprintf("SELECT count(*) FROM %s", from)
+	}
+}
+
+// sqlSelectValue renders a query, which selects the passed value.
+func sqlSelectValue(value, from, condition string) string {
+	if condition != "" {
+		from = fmt.Sprintf("%s WHERE %s", from, condition)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s", value, from)
+}
+
+// sqlParameter returns the value which is bound as parameter for the constant's value. Numbers which exceed int64 and float64 (json.Number)
+// are not supported by the drivers, therefore they are bound as unsigned integers (MySQL only) or as their exact decimal representation,
+// which the database converts into the type of the compared column.
+func sqlParameter(platform string, value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if platform == data.TypeMysql {
+		if unsigned, err := strconv.ParseUint(string(number), 10, 64); err == nil {
+			return unsigned
+		}
+	}
+	return string(number)
+}
+
+// sqlAggregate renders the aggregate as a scalar subquery, which is correlated with the enclosing query by the attributes
+// of its entities. The parameters of the subquery are appended to the passed values.
+func (ds *sqlDatastoreTranslator) sqlAggregate(aggregate data.Aggregate, values []interface{}) (string, []interface{}, error) {
+	value := "*"
+	if aggregate.Value != nil {
+		attribute, ok := aggregate.Value.(data.Attribute)
+		if !ok {
+			return "", nil, errors.Errorf("SqlDatastoreTranslator: Unable to aggregate %T -> %+v", aggregate.Value, aggregate.Value)
+		}
+		entity := attribute.Entity.Alias
+		if entity == "" {
+			schema, configured, err := ds.findSchemaForEntity(attribute.Entity.Value)
+			if err != nil {
+				return "", nil, err
+			}
+			entity = configured.Name
+			if schema != "" {
+				entity = fmt.Sprintf("%s.%s", schema, entity)
+			}
+		}
+		value = fmt.Sprintf("%s.%s", entity, attribute.Name)
+	}
+	if aggregate.Distinct {
+		value = "DISTINCT " + value
+	}
+
+	var selection string
+	switch aggregate.Function.String() {
+	case "count", "max", "min":
+		selection = fmt.Sprintf("%s(%s)", aggregate.Function.String(), value)
+	case "sum":
+		// The sum of no rows is 0 (like in Rego), and not NULL
+		selection = fmt.Sprintf("COALESCE(sum(%s), 0)", value)
+	default:
+		return "", nil, errors.Errorf("SqlDatastoreTranslator: Unknown aggregate function [%s]", aggregate.Function.String())
+	}
+
+	subquery, values, err := ds.translateStatement(data.Union{Clauses: []data.Node{aggregate.Query}}, false, selection, values)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("(%s)", subquery), values, nil
+}
+
+// sqlUnion combines all rendered queries in the configured query shape. Except for sqlQueryShapeCount, duplicate
+// results are kept (UNION ALL), so that the database is able to return the first result without evaluating all queries.
+func (ds *sqlDatastoreTranslator) sqlUnion(selects []string) string {
+	switch ds.queryShape {
+	case sqlQueryShapeExists:
+		return strings.Join(selects, " UNION ALL ")
+	case sqlQueryShapeLimit:
+		return strings.Join(selects, " UNION ALL ") + " LIMIT 1"
+	default:
+		return strings.Join(selects, " UNION ")
+	}
+}
+
+// sqlJoinLinkedEntities rewrites all queries of the union, so that each linked entity, which is related to the query's
+// root entity (or a previously joined entity) by the equality of their attributes, is joined on these equalities.
+// All other linked entities and conditions remain as they are.
+func sqlJoinLinkedEntities(input data.Node) data.Node {
+	union, ok := input.(data.Union)
+	if !ok {
+		return input
+	}
+
+	clauses := make([]data.Node, len(union.Clauses))
+	for i, clause := range union.Clauses {
+		clauses[i] = clause
+		if query, isQuery := clause.(data.Query); isQuery {
+			clauses[i] = sqlJoinQuery(query)
+		}
+	}
+	return data.Union{Clauses: clauses}
+}
+
+func sqlJoinQuery(query data.Query) data.Query {
+	conjunction, ok := query.Condition.Clause.(data.Conjunction)
+	if !ok || len(query.Link.Entities) == 0 {
+		return query
+	}
+
+	var joins []data.Join
+	joined := map[string]bool{query.From.Name(): true}
+	linked := append(query.Link.Entities[:0:0], query.Link.Entities...)
+	conditions := append(conjunction.Clauses[:0:0], conjunction.Clauses...)
+
+	// Join linked entities as long as any of them is related to the joined ones
+	for progress := true; progress; {
+		progress = false
+		for i, entity := range linked {
+			var on, remaining []data.Node
+			for _, condition := range conditions {
+				if other, isJoin := sqlJoinCondition(condition, entity.Name()); isJoin && joined[other] {
+					on = append(on, condition)
+				} else {
+					remaining = append(remaining, condition)
+				}
+			}
+			if len(on) == 0 {
+				continue
+			}
+
+			joins = append(joins, data.Join{Entity: entity, On: on})
+			joined[entity.Name()] = true
+			linked = append(linked[:i], linked[i+1:]...)
+			conditions = remaining
+			progress = true
+			break
+		}
+	}
+
+	return data.Query{
+		From:      query.From,
+		Link:      data.Link{Entities: linked, Joins: joins},
+		Condition: data.Condition{Clause: data.Conjunction{Clauses: conditions}},
+	}
+}
+
+// sqlJoinCondition checks if the condition is an equality of an attribute of the entity with an attribute of another entity
+// and returns the other entity's name.
+func sqlJoinCondition(condition data.Node, entity string) (string, bool) {
+	call, ok := condition.(data.Call)
+	if !ok || len(call.Operands) != 2 || (call.Operator.String() != "eq" && call.Operator.String() != "equal") {
+		return "", false
+	}
+	left, leftOk := call.Operands[0].(data.Attribute)
+	right, rightOk := call.Operands[1].(data.Attribute)
+	if !leftOk || !rightOk || left.Entity.Name() == right.Entity.Name() {
+		return "", false
+	}
+
+	switch entity {
+	case left.Entity.Name():
+		return right.Entity.Name(), true
+	case right.Entity.Name():
+		return left.Entity.Name(), true
+	default:
+		return "", false
+	}
+}
+
+// sqlNullComparison translates (in)equality comparisons with NULL into IS NULL and IS NOT NULL,
+// because NULL is never equal (or unequal) to any value in SQL. False is returned for all other calls.
+func sqlNullComparison(op string, args []string) (string, bool) {
+	if len(args) != 2 || (op != "eq" && op != "equal" && op != "neq") {
+		return "", false
+	}
+
+	var operand string
+	switch {
+	case args[1] == sqlNull:
+		operand = args[0]
+	case args[0] == sqlNull:
+		operand = args[1]
+	default:
+		return "", false
+	}
+
+	if op == "neq" {
+		return fmt.Sprintf("%s IS NOT NULL", operand), true
+	}
+	return fmt.Sprintf("%s IS NULL", operand), true
+}
+
+// isSQLEmptyMembership returns true for memberships in an empty collection.
+func isSQLEmptyMembership(op string, args []string) bool {
+	return op == "internal.member_2" && len(args) == 2 && args[1] == sqlEmptySet
+}
+
+// findSchemaForEntity returns the schema which qualifies the searched entity inside a statement.
+// An empty schema is returned for entities which are addressed without schema.
 func (ds *sqlDatastoreTranslator) findSchemaForEntity(search string) (string, *configs.Entity, error) {
 	// Find custom mapping
 	for schema, es := range ds.schemas {
 		if found, entity := es.ContainsEntity(search); found {
-			return schema, entity, nil
+			switch {
+			case ds.platform == data.TypePostgres && schema == "public":
+				// Special handle when datastore is postgres and schema is public
+				return "", entity, nil
+			case ds.platform == data.TypeSqlite && schema == sqliteMainSchema:
+				// The main database of sqlite is addressed without schema, attached databases by their schema
+				return "", entity, nil
+			default:
+				return schema, entity, nil
+			}
 		}
 	}
 	err := errors.Errorf("SqlDatastoreTranslator: No schema found for entity %s in datastore with alias %s", search, ds.alias)
@@ -0,0 +1,282 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+	internalErrors "github.com/unbasical/kelon/pkg/errors"
+)
+
+func newTestSQLTranslator(t *testing.T, platform string) data.DatastoreTranslator {
+	datastores := map[string]*configs.Datastore{
+		"sql": {
+			Type: platform,
+			Connection: map[string]string{
+				"host":     "localhost",
+				"port":     "5432",
+				"database": "appstore",
+				"user":     "user",
+				"password": "password",
+			},
+			Metadata: map[string]string{},
+		},
+	}
+	callOps, err := LoadAllCallOperands(datastores, nil)
+	require.NoError(t, err)
+
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: datastores,
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"sql": {
+					"appstore": {
+						Entities: []*configs.Entity{{Name: "users"}, {Name: "apps"}},
+					},
+				},
+			},
+		},
+		CallOperands: callOps,
+	}
+
+	translator := NewSQLDatastoreTranslator()
+	require.NoError(t, translator.Configure(appConf, "sql"))
+	return translator
+}
+
+func eqCall(entity, attribute string, value data.Node) data.Call {
+	return data.Call{
+		Operator: data.Operator{Value: "eq"},
+		Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: entity}, Name: attribute}, value},
+	}
+}
+
+func linkedTestQuery() data.Node {
+	return data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("apps", "id", data.Constant{Value: int64(1)}),
+			}}},
+		},
+		data.Query{
+			From: data.Entity{Value: "apps"},
+			Link: data.Link{Entities: []data.Entity{{Value: "users"}}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("apps", "owner_id", data.Attribute{Entity: data.Entity{Value: "users"}, Name: "id"}),
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+			}}},
+		},
+	}}
+}
+
+func Test_SQLTranslator_Execute(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+
+	query, err := translator.Execute(context.Background(), linkedTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.apps WHERE (appstore.apps.id = $1) UNION "+
+		"SELECT count(*) FROM appstore.apps INNER JOIN appstore.users ON appstore.apps.owner_id = appstore.users.id WHERE (appstore.users.name = $2)", query.Statement)
+	assert.Equal(t, []interface{}{int64(1), "Arnold"}, query.Parameters)
+}
+
+func Test_SQLTranslator_Filter(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypeMysql)
+
+	filter, err := translator.Filter(context.Background(), linkedTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "(appstore.apps.id = ?) OR "+
+		"EXISTS (SELECT 1 FROM appstore.users WHERE (appstore.apps.owner_id = appstore.users.id AND appstore.users.name = ?))", filter.Statement)
+	assert.Equal(t, []interface{}{int64(1), "Arnold"}, filter.Parameters)
+
+	// Numbered placeholders always start at $1, callers with own parameters have to renumber them
+	filter, err = newTestSQLTranslator(t, data.TypePostgres).Filter(context.Background(), linkedTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "(appstore.apps.id = $1) OR "+
+		"EXISTS (SELECT 1 FROM appstore.users WHERE (appstore.apps.owner_id = appstore.users.id AND appstore.users.name = $2))", filter.Statement)
+	assert.Equal(t, []interface{}{int64(1), "Arnold"}, filter.Parameters)
+}
+
+func Test_SQLTranslator_FilterMismatchedRoots(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+
+	// A condition on users can not be appended to a query on apps
+	_, err := translator.Filter(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "apps"},
+			Condition: data.Condition{Clause: eqCall("apps", "id", data.Constant{Value: int64(1)})},
+		},
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "name", data.Constant{Value: "Arnold"})},
+		},
+	}})
+	var translationErr internalErrors.InvalidRequestTranslation
+	require.ErrorAs(t, err, &translationErr)
+	assert.Contains(t, translationErr.Causes[0], "same entity")
+}
+
+func Test_SQLTranslator_Negation(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				data.Negation{Clause: eqCall("users", "role", data.Constant{Value: "BANNED"})},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.users WHERE (appstore.users.name = $1 AND NOT (appstore.users.role = $2))", query.Statement)
+	assert.Equal(t, []interface{}{"Arnold", "BANNED"}, query.Parameters)
+}
+
+func Test_SQLTranslator_LargeNumber(t *testing.T) {
+	query := data.Union{Clauses: []data.Node{
+		data.Query{
+			From:      data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: eqCall("users", "id", data.Constant{Value: json.Number("18446744073709551615")})},
+		},
+	}}
+
+	// Integers exceeding int64 are bound exactly
+	mysql, err := newTestSQLTranslator(t, data.TypeMysql).Execute(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint64(18446744073709551615)}, mysql.Parameters)
+
+	postgres, err := newTestSQLTranslator(t, data.TypePostgres).Execute(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"18446744073709551615"}, postgres.Parameters)
+}
+
+func Test_SQLTranslator_Collection(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+	memberCall := func(values ...data.Constant) data.Call {
+		return data.Call{
+			Operator: data.Operator{Value: "internal.member_2"},
+			Operands: []data.Node{data.Attribute{Entity: data.Entity{Value: "users"}, Name: "role"}, data.Collection{Values: values}},
+		}
+	}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				memberCall(data.Constant{Value: "ADMIN"}, data.Constant{Value: "OWNER"}),
+			}}},
+		},
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				memberCall(),
+			}}},
+		},
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				data.Negation{Clause: memberCall()},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.users WHERE (appstore.users.name = $1 AND appstore.users.role IN ($2, $3)) UNION "+
+		"SELECT count(*) FROM appstore.users WHERE (1 = 0) UNION "+
+		"SELECT count(*) FROM appstore.users WHERE (NOT (1 = 0))", query.Statement)
+	assert.Equal(t, []interface{}{"Arnold", "ADMIN", "OWNER"}, query.Parameters)
+}
+
+func Test_SQLTranslator_Null(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypeMysql)
+	null := data.Constant{Value: nil}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				eqCall("users", "deleted_at", null),
+				data.Call{
+					Operator: data.Operator{Value: "neq"},
+					Operands: []data.Node{null, data.Attribute{Entity: data.Entity{Value: "users"}, Name: "verified_at"}},
+				},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.users WHERE (appstore.users.name = ? AND appstore.users.deleted_at IS NULL AND appstore.users.verified_at IS NOT NULL)", query.Statement)
+	assert.Equal(t, []interface{}{"Arnold"}, query.Parameters)
+}
+
+func Test_SQLTranslator_SelfJoin(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+	friend := data.Entity{Value: "users", Alias: "users_2"}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Link: data.Link{Entities: []data.Entity{friend}},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				eqCall("users", "friend_id", data.Attribute{Entity: friend, Name: "id"}),
+				data.Call{
+					Operator: data.Operator{Value: "eq"},
+					Operands: []data.Node{data.Attribute{Entity: friend, Name: "name"}, data.Constant{Value: "Kevin"}},
+				},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.users INNER JOIN appstore.users AS users_2 ON appstore.users.friend_id = users_2.id "+
+		"WHERE (appstore.users.name = $1 AND users_2.name = $2)", query.Statement)
+	assert.Equal(t, []interface{}{"Arnold", "Kevin"}, query.Parameters)
+}
+
+func Test_SQLTranslator_Aggregate(t *testing.T) {
+	translator := newTestSQLTranslator(t, data.TypePostgres)
+	ownedApps := data.Query{
+		From: data.Entity{Value: "apps"},
+		Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+			eqCall("apps", "owner_id", data.Attribute{Entity: data.Entity{Value: "users"}, Name: "id"}),
+			eqCall("apps", "public", data.Constant{Value: true}),
+		}}},
+	}
+
+	query, err := translator.Execute(context.Background(), data.Union{Clauses: []data.Node{
+		data.Query{
+			From: data.Entity{Value: "users"},
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: []data.Node{
+				eqCall("users", "name", data.Constant{Value: "Arnold"}),
+				data.Call{
+					Operator: data.Operator{Value: "lt"},
+					Operands: []data.Node{data.Aggregate{Function: data.Operator{Value: "count"}, Query: ownedApps}, data.Constant{Value: int64(10)}},
+				},
+				data.Call{
+					Operator: data.Operator{Value: "lte"},
+					Operands: []data.Node{
+						data.Aggregate{
+							Function: data.Operator{Value: "sum"},
+							Value:    data.Attribute{Entity: data.Entity{Value: "apps"}, Name: "stars"},
+							Distinct: true,
+							Query:    ownedApps,
+						},
+						data.Constant{Value: int64(20)},
+					},
+				},
+			}}},
+		},
+	}})
+	require.NoError(t, err)
+
+	// Parameters of the subqueries are numbered in order of their occurrence
+	assert.Equal(t, "SELECT count(*) FROM appstore.users WHERE (appstore.users.name = $1 "+
+		"AND (SELECT count(*) FROM appstore.apps WHERE (appstore.apps.owner_id = appstore.users.id AND appstore.apps.public = $2)) < $3 "+
+		"AND (SELECT COALESCE(sum(DISTINCT appstore.apps.stars), 0) FROM appstore.apps WHERE (appstore.apps.owner_id = appstore.users.id AND appstore.apps.public = $4)) <= $5)", query.Statement)
+	assert.Equal(t, []interface{}{"Arnold", true, int64(10), true, int64(20)}, query.Parameters)
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+)
+
+const (
+	// Prefix of all connection fields which attach a database file to the connection under the given schema (i.e. attach.logs: ./logs.db)
+	sqliteAttachPrefix = "attach."
+	// Schema of SQLite's main database
+	sqliteMainSchema = "main"
+	// Schema of SQLite's temporary database
+	sqliteTempSchema = "temp"
+	// Filename of SQLite's in-memory database
+	sqliteInMemory = ":memory:"
+)
+
+// sqliteConnector implements driver.Connector by opening connections to the configured database file
+// and attaching all configured database files to each new connection.
+type sqliteConnector struct {
+	dsn         string
+	attachments map[string]string
+	driver      *sqlite.Driver
+}
+
+// openSqliteDatabase opens a new connection pool for the SQLite database configured by the passed connection.
+func openSqliteDatabase(conn map[string]string) (*sql.DB, error) {
+	files := getSqliteAttachments(conn)
+	files[sqliteMainSchema] = conn[fileKey]
+	for schema, file := range files {
+		if file == sqliteInMemory {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return nil, errors.Wrapf(err, "SqliteDatastore: Database file %q of schema %q is not accessible", file, schema)
+		}
+	}
+
+	return sql.OpenDB(sqliteConnector{
+		dsn:         getSqliteConnectionString(conn),
+		attachments: getSqliteAttachments(conn),
+		driver:      &sqlite.Driver{},
+	}), nil
+}
+
+// Connect implements driver.Connector
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.Errorf("SqliteDatastore: Connection of type %T is unable to execute statements", conn)
+	}
+	for schema, file := range c.attachments {
+		statement := fmt.Sprintf("ATTACH DATABASE ? AS \"%s\"", strings.ReplaceAll(schema, "\"", "\"\""))
+		if _, err := execer.ExecContext(ctx, statement, []driver.NamedValue{{Ordinal: 1, Value: file}}); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrapf(err, "SqliteDatastore: Unable to attach database %q as schema %q", file, schema)
+		}
+	}
+	return conn, nil
+}
+
+// Driver implements driver.Connector
+func (c sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// getSqliteConnectionString returns the database file with all connection options which are no attachments.
+func getSqliteConnectionString(conn map[string]string) string {
+	var options []string
+	for key, value := range conn {
+		if key == fileKey || strings.HasPrefix(key, sqliteAttachPrefix) {
+			continue
+		}
+		options = append(options, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(options)
+
+	return conn[fileKey] + createConnOptionsString(options, "&", "?")
+}
+
+// getSqliteAttachments returns all database files which are attached to a connection (schema -> file).
+func getSqliteAttachments(conn map[string]string) map[string]string {
+	attachments := make(map[string]string)
+	for key, value := range conn {
+		if schema := strings.TrimPrefix(key, sqliteAttachPrefix); schema != key && schema != "" {
+			attachments[schema] = value
+		}
+	}
+	return attachments
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+	_ "modernc.org/sqlite"
+)
+
+func createTestSqliteFile(t *testing.T, file string, statements ...string) {
+	db, err := sql.Open("sqlite", file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		require.NoError(t, err)
+	}
+}
+
+func Test_getSqliteConnectionString(t *testing.T) {
+	conn := map[string]string{
+		"file":          "./appstore.db",
+		"attach.audits": "./audits.db",
+		"mode":          "ro",
+		"_pragma":       "busy_timeout(5000)",
+	}
+	assert.Equal(t, "./appstore.db?_pragma=busy_timeout(5000)&mode=ro", getSqliteConnectionString(conn))
+	assert.Equal(t, map[string]string{"audits": "./audits.db"}, getSqliteAttachments(conn))
+}
+
+func Test_SqliteDatastore(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "users.db")
+	attachedFile := filepath.Join(dir, "appstore.db")
+	createTestSqliteFile(t, mainFile,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (1, 'Arnold'), (2, 'Kevin')")
+	createTestSqliteFile(t, attachedFile,
+		"CREATE TABLE apps (id INTEGER PRIMARY KEY, owner_id INTEGER)",
+		"INSERT INTO apps VALUES (1, 2), (2, 1)")
+
+	datastores := map[string]*configs.Datastore{
+		"sqlite": {
+			Type: data.TypeSqlite,
+			Connection: map[string]string{
+				"file":            mainFile,
+				"attach.appstore": attachedFile,
+			},
+			Metadata: map[string]string{},
+		},
+	}
+	callOps, err := LoadAllCallOperands(datastores, nil)
+	require.NoError(t, err)
+
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: datastores,
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"sqlite": {
+					"main":     {Entities: []*configs.Entity{{Name: "users"}}},
+					"appstore": {Entities: []*configs.Entity{{Name: "apps"}}},
+				},
+			},
+		},
+		CallOperands: callOps,
+	}
+
+	translator := NewSQLDatastoreTranslator()
+	require.NoError(t, translator.Configure(appConf, "sqlite"))
+	executor := NewSQLDatastoreExecutor()
+	require.NoError(t, executor.Configure(appConf, "sqlite"))
+	defer executor.(*sqlDatastoreExecutor).Close()
+
+	query, err := translator.Execute(context.Background(), linkedTestQuery())
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM appstore.apps WHERE (appstore.apps.id = ?) UNION "+
+		"SELECT count(*) FROM appstore.apps INNER JOIN users ON appstore.apps.owner_id = users.id WHERE (users.name = ?)", query.Statement)
+
+	allowed, err := executor.Execute(context.Background(), query)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	query.Parameters = []interface{}{"3", "Bob"}
+	allowed, err = executor.Execute(context.Background(), query)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func Test_SqliteDatastore_UnattachedSchema(t *testing.T) {
+	datastores := map[string]*configs.Datastore{
+		"sqlite": {
+			Type:       data.TypeSqlite,
+			Connection: map[string]string{"file": ":memory:"},
+			Metadata:   map[string]string{},
+		},
+	}
+	callOps, err := LoadAllCallOperands(datastores, nil)
+	require.NoError(t, err)
+
+	appConf := &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: datastores,
+			DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+				"sqlite": {"appstore": {Entities: []*configs.Entity{{Name: "apps"}}}},
+			},
+		},
+		CallOperands: callOps,
+	}
+
+	assert.Error(t, NewSQLDatastoreTranslator().Configure(appConf, "sqlite"))
+}
+
+func Test_SqliteDatastore_QueryShapes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "appstore.db")
+	createTestSqliteFile(t, file,
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE apps (id INTEGER PRIMARY KEY, owner_id INTEGER)",
+		"INSERT INTO users VALUES (1, 'Arnold'), (2, 'Kevin')",
+		"INSERT INTO apps VALUES (1, 2), (2, 1)")
+
+	expected := map[string]string{
+		sqlQueryShapeExists: "SELECT CASE WHEN EXISTS (SELECT 1 FROM apps WHERE (apps.id = ?)) THEN 1 ELSE 0 END UNION ALL " +
+			"SELECT CASE WHEN EXISTS (SELECT 1 FROM apps INNER JOIN users ON apps.owner_id = users.id WHERE (users.name = ?)) THEN 1 ELSE 0 END",
+		sqlQueryShapeLimit: "SELECT 1 FROM apps WHERE (apps.id = ?) UNION ALL " +
+			"SELECT 1 FROM apps INNER JOIN users ON apps.owner_id = users.id WHERE (users.name = ?) LIMIT 1",
+	}
+	for shape, statement := range expected {
+		datastores := map[string]*configs.Datastore{
+			"sqlite": {
+				Type:       data.TypeSqlite,
+				Connection: map[string]string{"file": file},
+				Metadata:   map[string]string{"queryShape": shape},
+			},
+		}
+		callOps, err := LoadAllCallOperands(datastores, nil)
+		require.NoError(t, err)
+		appConf := &configs.AppConfig{
+			ExternalConfig: configs.ExternalConfig{
+				Datastores: datastores,
+				DatastoreSchemas: map[string]map[string]*configs.EntitySchema{
+					"sqlite": {"main": {Entities: []*configs.Entity{{Name: "users"}, {Name: "apps"}}}},
+				},
+			},
+			CallOperands: callOps,
+		}
+
+		translator := NewSQLDatastoreTranslator()
+		require.NoError(t, translator.Configure(appConf, "sqlite"))
+		executor := NewSQLDatastoreExecutor()
+		require.NoError(t, executor.Configure(appConf, "sqlite"))
+
+		query, err := translator.Execute(context.Background(), linkedTestQuery())
+		require.NoError(t, err)
+		assert.Equal(t, statement, query.Statement)
+
+		allowed, err := executor.Execute(context.Background(), query)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		query.Parameters = []interface{}{"3", "Bob"}
+		allowed, err = executor.Execute(context.Background(), query)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		require.NoError(t, executor.(*sqlDatastoreExecutor).Close())
+	}
+}
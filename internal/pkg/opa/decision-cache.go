@@ -0,0 +1,175 @@
+package opa
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/unbasical/kelon/pkg/opa"
+)
+
+const (
+	decisionCacheHit  = "hit"
+	decisionCacheMiss = "miss"
+)
+
+// decisionCache caches the decisions of each package (bounded by size and TTL) keyed by the hash of the OPA input they were made for.
+//
+// Each flush increases the epoch of the cache. Decisions which were evaluated during an older epoch are not stored anymore,
+// so that decisions which were made with outdated policies or data never end up in the cache.
+//
+// Note that the cache is only flushed if policies or data of OPA change. Changes of the data inside the datastores are unknown
+// to kelon, therefore they are only taken into account after the cached decisions expired (TTL).
+type decisionCache struct {
+	mutex    sync.Mutex
+	size     int
+	ttl      time.Duration
+	epoch    uint64
+	packages map[string]*decisionCachePackage
+}
+
+// decisionCachePackage is the LRU list of the cached decisions of a single package.
+type decisionCachePackage struct {
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type decisionCacheEntry struct {
+	key      string
+	decision opa.Decision
+	expires  time.Time
+}
+
+// newDecisionCache returns a new decisionCache which holds up to size decisions per package for the passed TTL.
+// If size is not positive, nil is returned which means that caching is disabled. A TTL which is not positive never expires decisions.
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	if size <= 0 {
+		return nil
+	}
+	return &decisionCache{
+		size:     size,
+		ttl:      ttl,
+		packages: make(map[string]*decisionCachePackage),
+	}
+}
+
+// key normalizes the passed OPA input by marshaling it to JSON (which sorts all map keys) and returns its hash.
+func (c *decisionCache) key(input map[string]interface{}) (string, error) {
+	normalized, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(normalized)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// currentEpoch returns the epoch which has to be passed to put() for a decision which is evaluated afterwards.
+func (c *decisionCache) currentEpoch() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.epoch
+}
+
+// get returns a copy of the cached decision of the package for the passed key if it is present and not expired.
+func (c *decisionCache) get(pkg, key string) (*opa.Decision, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached, ok := c.packages[pkg]
+	if !ok {
+		return nil, false
+	}
+	element, ok := cached.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*decisionCacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		cached.order.Remove(element)
+		delete(cached.entries, key)
+		return nil, false
+	}
+
+	cached.order.MoveToFront(element)
+	decision := copyDecision(entry.decision)
+	return &decision, true
+}
+
+// put stores the decision of the package for the passed key, as long as the cache was not flushed since the passed epoch.
+func (c *decisionCache) put(pkg, key string, epoch uint64, decision *opa.Decision) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if epoch != c.epoch {
+		return
+	}
+
+	cached, ok := c.packages[pkg]
+	if !ok {
+		cached = &decisionCachePackage{order: list.New(), entries: make(map[string]*list.Element)}
+		c.packages[pkg] = cached
+	}
+
+	entry := &decisionCacheEntry{key: key, decision: copyDecision(*decision), expires: time.Now().Add(c.ttl)}
+	if element, exists := cached.entries[key]; exists {
+		element.Value = entry
+		cached.order.MoveToFront(element)
+		return
+	}
+	cached.entries[key] = cached.order.PushFront(entry)
+
+	// Evict least recently used decision
+	if cached.order.Len() > c.size {
+		oldest := cached.order.Back()
+		cached.order.Remove(oldest)
+		delete(cached.entries, oldest.Value.(*decisionCacheEntry).key)
+	}
+}
+
+// flush removes all cached decisions.
+func (c *decisionCache) flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.epoch++
+	c.packages = make(map[string]*decisionCachePackage)
+}
+
+// copyDecision returns a deep copy of the decision, so that neither the cached decision nor the returned ones share their headers
+// and response with each other.
+func copyDecision(decision opa.Decision) opa.Decision {
+	if decision.Headers != nil {
+		headers := make(map[string]string, len(decision.Headers))
+		for name, value := range decision.Headers {
+			headers[name] = value
+		}
+		decision.Headers = headers
+	}
+	decision.Response = copyValue(decision.Response)
+	return decision
+}
+
+// copyValue returns a deep copy of the objects and arrays of a value returned by OPA. All other values are immutable.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			copied[key] = copyValue(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = copyValue(element)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,103 @@
+package opa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/pkg/opa"
+)
+
+func Test_decisionCache_key(t *testing.T) {
+	cache := newDecisionCache(1, 0)
+	first, err := cache.key(map[string]interface{}{"method": "GET", "path": []string{"api", "apps"}, "user": "arnold"})
+	require.NoError(t, err)
+	second, err := cache.key(map[string]interface{}{"user": "arnold", "path": []string{"api", "apps"}, "method": "GET"})
+	require.NoError(t, err)
+	other, err := cache.key(map[string]interface{}{"user": "kevin", "path": []string{"api", "apps"}, "method": "GET"})
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func Test_decisionCache(t *testing.T) {
+	assert.Nil(t, newDecisionCache(0, time.Minute))
+
+	cache := newDecisionCache(2, time.Minute)
+	epoch := cache.currentEpoch()
+	cache.put("applications.pg", "a", epoch, &opa.Decision{Verify: true, Allow: true})
+	cache.put("applications.pg", "b", epoch, &opa.Decision{Verify: true, Allow: false})
+	cache.put("applications.mysql", "a", epoch, &opa.Decision{Verify: false})
+
+	decision, ok := cache.get("applications.pg", "a")
+	require.True(t, ok)
+	assert.True(t, decision.Allow)
+
+	// Least recently used decision is evicted
+	cache.put("applications.pg", "c", epoch, &opa.Decision{Verify: true, Allow: true})
+	_, ok = cache.get("applications.pg", "b")
+	assert.False(t, ok)
+	_, ok = cache.get("applications.pg", "a")
+	assert.True(t, ok)
+	_, ok = cache.get("applications.mysql", "a")
+	assert.True(t, ok)
+
+	// Decisions which were evaluated before a flush are not stored
+	cache.flush()
+	_, ok = cache.get("applications.pg", "a")
+	assert.False(t, ok)
+	cache.put("applications.pg", "a", epoch, &opa.Decision{Verify: true, Allow: true})
+	_, ok = cache.get("applications.pg", "a")
+	assert.False(t, ok)
+}
+
+func Test_decisionCache_Copy(t *testing.T) {
+	cache := newDecisionCache(1, 0)
+	decision := &opa.Decision{
+		Verify:   true,
+		Allow:    true,
+		Headers:  map[string]string{"X-User": "arnold"},
+		Response: map[string]interface{}{"roles": []interface{}{"ADMIN"}},
+	}
+	cache.put("applications.pg", "a", cache.currentEpoch(), decision)
+	decision.Headers["X-User"] = "kevin"
+
+	// Neither the stored decision nor any returned decision can be modified by callers
+	first, ok := cache.get("applications.pg", "a")
+	require.True(t, ok)
+	first.Headers["X-User"] = "kevin"
+	first.Response.(map[string]interface{})["roles"].([]interface{})[0] = "USER"
+
+	second, ok := cache.get("applications.pg", "a")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"X-User": "arnold"}, second.Headers)
+	assert.Equal(t, map[string]interface{}{"roles": []interface{}{"ADMIN"}}, second.Response)
+}
+
+func Test_decisionCache_TTL(t *testing.T) {
+	cache := newDecisionCache(1, time.Millisecond)
+	cache.put("applications.pg", "a", cache.currentEpoch(), &opa.Decision{Verify: true, Allow: true})
+
+	time.Sleep(5 * time.Millisecond)
+	_, ok := cache.get("applications.pg", "a")
+	assert.False(t, ok)
+}
+
+func Test_OPA_OnChange(t *testing.T) {
+	ctx := context.Background()
+	engine, err := NewOPA(ctx, "")
+	require.NoError(t, err)
+
+	cache := newDecisionCache(1, 0)
+	require.NoError(t, engine.OnChange(ctx, cache.flush))
+	cache.put("applications.pg", "a", cache.currentEpoch(), &opa.Decision{Verify: true, Allow: true})
+
+	store := engine.manager.Store
+	require.NoError(t, storage.WriteOne(ctx, store, storage.AddOp, storage.MustParsePath("/users"), map[string]interface{}{}))
+	_, ok := cache.get("applications.pg", "a")
+	assert.False(t, ok)
+}
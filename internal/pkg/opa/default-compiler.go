@@ -3,9 +3,12 @@ package opa
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/pkg/errors"
@@ -14,6 +17,7 @@ import (
 	requestInt "github.com/unbasical/kelon/internal/pkg/request"
 	"github.com/unbasical/kelon/pkg/constants"
 	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
 	internalErrors "github.com/unbasical/kelon/pkg/errors"
 	"github.com/unbasical/kelon/pkg/opa"
 	"github.com/unbasical/kelon/pkg/request"
@@ -22,16 +26,25 @@ import (
 
 type policyCompiler struct {
 	configured bool
-	appConfig  *configs.AppConfig
-	config     *opa.PolicyCompilerConfig
 	engine     *OPA
+	cache      *decisionCache
+	mutex      sync.RWMutex
+	current    *compilerGeneration
+}
+
+// compilerGeneration contains the configuration and all sub-components which are replaced on a configuration reload.
+// Each request is processed entirely with the generation which was active as the request arrived.
+type compilerGeneration struct {
+	appConfig *configs.AppConfig
+	config    *opa.PolicyCompilerConfig
+	inFlight  sync.WaitGroup
 }
 
 // Return a new instance of the default implementation of the opa.PolicyCompiler.
 func NewPolicyCompiler() opa.PolicyCompiler {
 	return &policyCompiler{
 		configured: false,
-		config:     nil,
+		current:    nil,
 	}
 }
 
@@ -51,12 +64,23 @@ func (compiler *policyCompiler) Configure(appConf *configs.AppConfig, compConf *
 		return errors.Wrap(e, "PolicyCompiler: Error while initializing dependencies.")
 	}
 
+	// Policies are checked against the active generation each time they are loaded
+	compiler.current = &compilerGeneration{appConfig: appConf, config: compConf}
+
 	// Start OPA in background
-	engine, err := startOPA(compConf.OPAConfig, *compConf.RegoDir)
+	engine, err := startOPA(compConf.OPAConfig, *compConf.RegoDir, CheckPolicies(compiler.checkPolicies))
 	if err != nil {
 		return errors.Wrap(err, "PolicyCompiler: Error while starting OPA.")
 	}
 
+	// Flush cached decisions each time policies or data change (i.e. on rego reload or via the policy and data API)
+	cache := newDecisionCache(compConf.DecisionCacheSize, compConf.DecisionCacheTTL)
+	if cache != nil {
+		if err := engine.OnChange(context.Background(), cache.flush); err != nil {
+			return errors.Wrap(err, "PolicyCompiler: Error while registering decision cache invalidation.")
+		}
+	}
+
 	// Register watcher for rego changes
 	(*compConf.ConfigWatcher).Watch(func(changeType watcher.ChangeType, config *configs.ExternalConfig, e error) {
 		if changeType == watcher.ChangeRego {
@@ -68,24 +92,284 @@ func (compiler *policyCompiler) Configure(appConf *configs.AppConfig, compConf *
 
 	// Assign variables
 	compiler.engine = engine
-	compiler.appConfig = appConf
-	compiler.config = compConf
+	compiler.cache = cache
 	compiler.configured = true
 	logging.LogForComponent("policyCompiler").Infoln("Configured PolicyCompiler")
 	return nil
 }
 
+// See Reconfigure() from opa.PolicyCompiler
+func (compiler *policyCompiler) Reconfigure(appConf *configs.AppConfig, compConf *opa.PolicyCompilerConfig) error {
+	if !compiler.configured {
+		return errors.Errorf("PolicyCompiler was not configured! Please call Configure(). ")
+	}
+
+	if e := initDependencies(compConf, appConf); e != nil {
+		return errors.Wrap(e, "PolicyCompiler: Error while initializing dependencies.")
+	}
+
+	// Check loaded policies against the new configuration
+	if err := checkPolicies(compiler.engine.manager.GetCompiler(), appConf, compConf.StrictPolicyCheck); err != nil {
+		return errors.Wrap(err, "PolicyCompiler: Error while checking policies.")
+	}
+
+	// Swap generations
+	compiler.mutex.Lock()
+	previous := compiler.current
+	compiler.current = &compilerGeneration{appConfig: appConf, config: compConf}
+	compiler.mutex.Unlock()
+
+	// Cached decisions may depend on the previous configuration
+	if compiler.cache != nil {
+		compiler.cache.flush()
+	}
+
+	// Wait for all requests which are still processed by the previous generation
+	previous.inFlight.Wait()
+	logging.LogForComponent("policyCompiler").Infoln("Reconfigured PolicyCompiler")
+	return nil
+}
+
+// acquireGeneration returns the currently active generation which has to be released by calling inFlight.Done() afterwards.
+func (compiler *policyCompiler) acquireGeneration() *compilerGeneration {
+	compiler.mutex.RLock()
+	defer compiler.mutex.RUnlock()
+
+	gen := compiler.current
+	gen.inFlight.Add(1)
+	return gen
+}
+
+// checkPolicies checks the passed policies against the configuration of the active generation.
+func (compiler *policyCompiler) checkPolicies(astCompiler *ast.Compiler) error {
+	gen := compiler.acquireGeneration()
+	defer gen.inFlight.Done()
+
+	return checkPolicies(astCompiler, gen.appConfig, gen.config.StrictPolicyCheck)
+}
+
 // Execute expects a map with the following structure:
 //
 // - input
 //   - method: match policy on HTTP method
 //   - path: match policy on HTTP path
-func (compiler policyCompiler) Execute(ctx context.Context, requestBody map[string]interface{}) (*opa.Decision, error) {
+func (compiler *policyCompiler) Execute(ctx context.Context, requestBody map[string]interface{}) (*opa.Decision, error) {
+	// Validate if policy compiler was configured correctly
+	if !compiler.configured {
+		return nil, errors.Errorf("PolicyCompiler was not configured! Please call Configure(). ")
+	}
+
+	gen := compiler.acquireGeneration()
+	defer gen.inFlight.Done()
+
+	input, output, method, path, err := compiler.parseRequest(gen, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// The deadline covers the evaluation of all rules including their datastore queries
+	ctx, cancel := withDeadline(ctx, output.Deadline)
+	defer cancel()
+
+	if compiler.cache == nil {
+		return compiler.evalDecision(ctx, gen, input, output, method, path)
+	}
+
+	// Serve decision from cache if possible
+	key, err := compiler.cache.key(extractOpaInput(output, input))
+	if err != nil {
+		logging.LogForComponent("policyCompiler").Warnf("Unable to cache decision due to: %s", err.Error())
+		return compiler.evalDecision(ctx, gen, input, output, method, path)
+	}
+	if decision, ok := compiler.cache.get(output.Package, key); ok {
+		compiler.updateDecisionCacheMetric(ctx, gen, output.Package, decisionCacheHit)
+		return decision, nil
+	}
+	compiler.updateDecisionCacheMetric(ctx, gen, output.Package, decisionCacheMiss)
+
+	// Errors are never cached
+	epoch := compiler.cache.currentEpoch()
+	decision, err := compiler.evalDecision(ctx, gen, input, output, method, path)
+	if err == nil {
+		compiler.cache.put(output.Package, key, epoch, decision)
+	}
+	return decision, err
+}
+
+// evalDecision evaluates the rules of the parsed request in the configured order until the first one is not fulfilled.
+func (compiler *policyCompiler) evalDecision(ctx context.Context, gen *compilerGeneration, input map[string]interface{}, output *request.PathProcessorOutput, method, path string) (*opa.Decision, error) {
+	decision := &opa.Decision{Verify: true, Allow: true, Package: output.Package, Method: method, Path: path}
+
+	rules := output.EffectiveRules()
+	for _, rule := range rules {
+		if rule.Obligation != "" {
+			continue
+		}
+		fulfilled, err := compiler.evalFunction(ctx, gen, rule.Name, input, output)
+		if err != nil || !fulfilled {
+			decision.Verify, decision.Allow = rule.Status != http.StatusUnauthorized, false
+			decision.Rule, decision.StatusCode = rule.Name, rule.Status
+			return decision, deadlineError(ctx, output.Deadline, err)
+		}
+	}
+
+	// Obligations are only evaluated for allowed requests
+	if err := compiler.evalObligations(ctx, rules, input, output, decision); err != nil {
+		decision.Allow = false
+		return decision, deadlineError(ctx, output.Deadline, err)
+	}
+	return decision, nil
+}
+
+// evalObligations evaluates the rules which provide the obligations (see configs.ObligationRule()) and assigns their values to the decision.
+// Rules whose values do not fit their obligation are ignored.
+//
+// Obligations are evaluated as plain OPA queries, so they can only use the input and data of OPA. References to datastores
+// are always undefined (see checkObligations()).
+func (compiler *policyCompiler) evalObligations(ctx context.Context, rules []*configs.PolicyRule, input map[string]interface{}, output *request.PathProcessorOutput, decision *opa.Decision) error {
+	extractedInput := extractOpaInput(output, input)
+
+	headers, defined, err := compiler.evalObligation(ctx, extractedInput, output.Package, configs.ObligationRule(rules, configs.ObligationHeaders))
+	if err != nil {
+		return err
+	}
+	if defined {
+		if decision.Headers, err = obligationHeaders(headers); err != nil {
+			logging.LogForComponent("policyCompiler").Warnf("Ignoring obligation %q of package %q due to: %s", configs.ObligationHeaders, output.Package, err.Error())
+		}
+	}
+
+	response, defined, err := compiler.evalObligation(ctx, extractedInput, output.Package, configs.ObligationRule(rules, configs.ObligationResponse))
+	if err != nil {
+		return err
+	}
+	if defined {
+		decision.Response = response
+	}
+	return nil
+}
+
+// evalObligation evaluates the rule of the package. An empty rule name or a rule which the package does not define is
+// undefined without being evaluated. Functions are ignored.
+func (compiler *policyCompiler) evalObligation(ctx context.Context, input interface{}, pkg, rule string) (interface{}, bool, error) {
+	if rule == "" {
+		return nil, false, nil
+	}
+
+	ref := fmt.Sprintf("data.%s.%s", pkg, rule)
+	rules, err := compiler.engine.Rules(ref)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "PolicyCompiler: Error while looking up rule %q", rule)
+	}
+	if len(rules) == 0 {
+		return nil, false, nil
+	}
+	for _, r := range rules {
+		if len(r.Head.Args) > 0 {
+			logging.LogForComponent("policyCompiler").Warnf("Ignoring rule %q of package %q, because obligations can not be provided by functions", rule, pkg)
+			return nil, false, nil
+		}
+	}
+
+	value, defined, err := compiler.engine.Evaluate(ctx, input, ref)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "PolicyCompiler: Error while evaluating rule %q", rule)
+	}
+	return value, defined, nil
+}
+
+// obligationHeaders converts the value of the obligation 'headers' into header values. Arrays are joined by commas.
+func obligationHeaders(value interface{}) (map[string]string, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("PolicyCompiler: Obligation %q has to be an object, but was of type %T", configs.ObligationHeaders, value)
+	}
+
+	headers := make(map[string]string, len(object))
+	for name, header := range object {
+		switch v := header.(type) {
+		case string:
+			headers[name] = v
+		case []interface{}:
+			values := make([]string, len(v))
+			for i, item := range v {
+				values[i] = fmt.Sprint(item)
+			}
+			headers[name] = strings.Join(values, ",")
+		default:
+			headers[name] = fmt.Sprint(v)
+		}
+	}
+	return headers, nil
+}
+
+// Filter expects the same request body as Execute.
+//
+// All rules are evaluated as usual, except the filter rule (see configs.FilterRule()) whose datastore queries are only translated and returned as filters.
+func (compiler *policyCompiler) Filter(ctx context.Context, requestBody map[string]interface{}) (*opa.FilterDecision, error) {
 	// Validate if policy compiler was configured correctly
 	if !compiler.configured {
 		return nil, errors.Errorf("PolicyCompiler was not configured! Please call Configure(). ")
 	}
 
+	gen := compiler.acquireGeneration()
+	defer gen.inFlight.Done()
+
+	input, output, method, path, err := compiler.parseRequest(gen, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withDeadline(ctx, output.Deadline)
+	defer cancel()
+
+	decision := &opa.FilterDecision{Verify: true, Allow: true, Package: output.Package, Method: method, Path: path}
+	deny := func(rule *configs.PolicyRule) {
+		decision.Verify, decision.Allow, decision.Filters = rule.Status != http.StatusUnauthorized, false, nil
+		decision.Rule, decision.StatusCode = rule.Name, rule.Status
+	}
+
+	rules := output.EffectiveRules()
+	filterRule := configs.FilterRule(rules)
+	for _, rule := range rules {
+		if rule.Obligation != "" {
+			continue
+		}
+		if rule == filterRule {
+			allowed, filters, filterErr := compiler.filterFunction(ctx, gen, rule.Name, input, output)
+			if filterErr != nil || !allowed {
+				deny(rule)
+				return decision, deadlineError(ctx, output.Deadline, filterErr)
+			}
+			decision.Filters = filters
+			continue
+		}
+
+		fulfilled, evalErr := compiler.evalFunction(ctx, gen, rule.Name, input, output)
+		if evalErr != nil || !fulfilled {
+			deny(rule)
+			return decision, deadlineError(ctx, output.Deadline, evalErr)
+		}
+	}
+
+	return decision, nil
+}
+
+func (compiler *policyCompiler) updateDecisionCacheMetric(ctx context.Context, gen *compilerGeneration, pkg, result string) {
+	if gen.appConfig.MetricsProvider == nil {
+		return
+	}
+
+	labels := map[string]string{
+		constants.LabelRegoPackage:         pkg,
+		constants.LabelDecisionCacheResult: result,
+	}
+	gen.appConfig.MetricsProvider.UpdateCounterMetric(ctx, constants.InstrumentDecisionCache, int64(1), labels)
+}
+
+// parseRequest extracts the input of the request body and maps it to the responsible package.
+// nolint:gocritic
+func (compiler *policyCompiler) parseRequest(gen *compilerGeneration, requestBody map[string]interface{}) (input map[string]interface{}, output *request.PathProcessorOutput, method, path string, err error) {
 	// Extract input
 	for rootKey := range requestBody {
 		if rootKey != "input" {
@@ -95,55 +379,32 @@ func (compiler policyCompiler) Execute(ctx context.Context, requestBody map[stri
 
 	rawInput, exists := requestBody[constants.Input]
 	if !exists {
-		return nil, internalErrors.InvalidInput{Msg: "PolicyCompiler: Incoming requestBody had no field 'input'!"}
+		return nil, nil, "", "", internalErrors.InvalidInput{Msg: "PolicyCompiler: Incoming requestBody had no field 'input'!"}
 	}
 
 	input, ok := rawInput.(map[string]interface{})
 	if !ok {
-		return nil, internalErrors.InvalidInput{Msg: "PolicyCompiler: Field 'input' in requestBody body was no nested JSON object!"}
+		return nil, nil, "", "", internalErrors.InvalidInput{Msg: "PolicyCompiler: Field 'input' in requestBody body was no nested JSON object!"}
 	}
 	logging.LogForComponent("policyCompiler").Debugf("Received input: %+v", input)
 
 	// Process path
-	output, err := compiler.processPath(input)
+	output, err = compiler.processPath(gen, input)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", "", err
 	}
 
-	path, err := extractURLFromRequestBody(input)
+	inputURL, err := extractURLFromRequestBody(input)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", "", err
 	}
 
-	method, err := extractMethodFromRequestBody(input)
+	method, err = extractMethodFromRequestBody(input)
 	if err != nil {
-		return nil, err
+		return nil, nil, "", "", err
 	}
 
-	var verify = true
-	var allow = true
-
-	// Authentication
-	if output.Authentication {
-		verify, err = compiler.evalFunction(ctx, "verify", input, output)
-		if err != nil {
-			return &opa.Decision{Verify: false, Allow: false, Package: output.Package, Method: method, Path: path.String()}, err
-		}
-	}
-
-	// Authorization
-	if verify {
-		if output.Authorization {
-			allow, err = compiler.evalFunction(ctx, "allow", input, output)
-			if err != nil {
-				return &opa.Decision{Verify: true, Allow: false, Package: output.Package, Method: method, Path: path.String()}, err
-			}
-		}
-	} else {
-		allow = false
-	}
-
-	return &opa.Decision{Verify: verify, Allow: allow, Package: output.Package, Method: method, Path: path.String()}, nil
+	return input, output, method, inputURL.String(), nil
 }
 
 func anyQuerySucceeded(queries *rego.PartialQueries) bool {
@@ -161,7 +422,7 @@ func anyQuerySucceeded(queries *rego.PartialQueries) bool {
 	return false
 }
 
-func (compiler policyCompiler) processPath(input map[string]interface{}) (*request.PathProcessorOutput, error) {
+func (compiler *policyCompiler) processPath(gen *compilerGeneration, input map[string]interface{}) (*request.PathProcessorOutput, error) {
 	inputURL, err := extractURLFromRequestBody(input)
 	if err != nil {
 		return nil, err
@@ -171,7 +432,7 @@ func (compiler policyCompiler) processPath(input map[string]interface{}) (*reque
 		return nil, err
 	}
 
-	output, err := (*compiler.config.PathProcessor).Process(&requestInt.URLProcessorInput{
+	output, err := (*gen.config.PathProcessor).Process(&requestInt.URLProcessorInput{
 		Method: method,
 		URL:    inputURL,
 	})
@@ -182,7 +443,7 @@ func (compiler policyCompiler) processPath(input map[string]interface{}) (*reque
 	return output, nil
 }
 
-func (compiler *policyCompiler) evalFunction(ctx context.Context, function string, input map[string]interface{}, output *request.PathProcessorOutput) (bool, error) {
+func (compiler *policyCompiler) evalFunction(ctx context.Context, gen *compilerGeneration, function string, input map[string]interface{}, output *request.PathProcessorOutput) (bool, error) {
 	// Compile mapped path
 	queries, err := compiler.opaCompile(ctx, input, function, output)
 	if err != nil {
@@ -199,18 +460,52 @@ func (compiler *policyCompiler) evalFunction(ctx context.Context, function strin
 	}
 
 	// Otherwise translate ast
-	return (*compiler.config.Translator).Process(context.WithValue(ctx, constants.ContextKeyRegoPackage, output.Package), queries, output.Datastores)
+	return (*gen.config.Translator).Process(context.WithValue(ctx, constants.ContextKeyRegoPackage, output.Package), queries, output.Datastores)
+}
+
+func (compiler *policyCompiler) filterFunction(ctx context.Context, gen *compilerGeneration, function string, input map[string]interface{}, output *request.PathProcessorOutput) (bool, map[string]data.DatastoreQuery, error) {
+	// Compile mapped path
+	queries, err := compiler.opaCompile(ctx, input, function, output)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// OPA decided denied
+	if queries.Queries == nil {
+		return false, nil, nil
+	}
+	// Check if any query succeeded, which means that there is nothing to filter
+	if done := anyQuerySucceeded(queries); done {
+		return true, nil, nil
+	}
+
+	// Otherwise translate ast into filters
+	filters, err := (*gen.config.Translator).Filter(context.WithValue(ctx, constants.ContextKeyRegoPackage, output.Package), queries, output.Datastores)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, filters, nil
 }
 
 func (compiler *policyCompiler) opaCompile(ctx context.Context, input map[string]interface{}, function string, output *request.PathProcessorOutput) (*rego.PartialQueries, error) {
 	// Extract parameters for partial evaluation
-	opts := compiler.extractOpaOpts(output)
+	unknowns := extractOpaUnknowns(output)
 	extractedInput := extractOpaInput(output, input)
 	query := fmt.Sprintf("data.%s.%s == true", output.Package, function)
 	logging.LogForComponent("policyCompiler").Debugf("Sending query=%s", query)
 
+	// Each policy evaluation may only use its share of the deadline, so that time is left for the datastore queries
+	if output.Deadline != nil && output.Deadline.PolicyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, output.Deadline.PolicyTimeout)
+		defer cancel()
+	}
+
 	// Compile clientRequest and return answer
-	queries, err := compiler.engine.PartialEvaluate(ctx, extractedInput, query, opts...)
+	queries, err := compiler.engine.PartialEvaluate(ctx, extractedInput, query, unknowns)
+	if err == nil {
+		err = plugInput(queries, extractedInput)
+	}
 	if err == nil {
 		if log.IsLevelEnabled(log.DebugLevel) {
 			for _, q := range queries.Queries {
@@ -219,7 +514,53 @@ func (compiler *policyCompiler) opaCompile(ctx context.Context, input map[string
 		}
 		return queries, nil
 	}
-	return nil, err
+	return nil, deadlineError(ctx, output.Deadline, err)
+}
+
+// plugInput replaces all references to the input inside the queries by their values. Partial evaluation saves comprehensions,
+// which depend on unknowns, as they are, which is why their bodies may still reference the input.
+func plugInput(queries *rego.PartialQueries, input map[string]interface{}) error {
+	value, err := ast.InterfaceToValue(input)
+	if err != nil {
+		return errors.Wrap(err, "PolicyCompiler: Unable to convert input")
+	}
+
+	for i, query := range queries.Queries {
+		plugged, transformErr := ast.TransformRefs(query, func(ref ast.Ref) (ast.Value, error) {
+			if !ref.HasPrefix(ast.InputRootRef) {
+				return ref, nil
+			}
+			if found, findErr := value.Find(ref[1:]); findErr == nil {
+				return found, nil
+			}
+			// Undefined references are kept and rejected by the translator
+			return ref, nil
+		})
+		if transformErr != nil {
+			return errors.Wrap(transformErr, "PolicyCompiler: Unable to plug input")
+		}
+		queries.Queries[i], _ = plugged.(ast.Body)
+	}
+	return nil
+}
+
+// withDeadline limits the context to the timeout of the deadline (if any).
+func withDeadline(ctx context.Context, deadline *configs.Deadline) (context.Context, context.CancelFunc) {
+	if deadline == nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, deadline.Timeout)
+}
+
+// deadlineError converts the error into an errors.DecisionTimeout if it was caused by the exceeded deadline of the context.
+func deadlineError(ctx context.Context, deadline *configs.Deadline, err error) error {
+	if err == nil || deadline == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	if _, isTimeout := errors.Cause(err).(internalErrors.DecisionTimeout); isTimeout {
+		return err
+	}
+	return internalErrors.DecisionTimeout{Cause: err, Deny: deadline.OnTimeout != configs.OnTimeoutUnavailable}
 }
 
 func extractMethodFromRequestBody(input map[string]interface{}) (string, error) {
@@ -259,15 +600,13 @@ func extractURLFromRequestBody(input map[string]interface{}) (*url.URL, error) {
 	return nil, internalErrors.InvalidInput{Msg: "PolicyCompiler: Object 'input' of request body didn't contain a 'path'. "}
 }
 
-func (compiler *policyCompiler) extractOpaOpts(output *request.PathProcessorOutput) []func(*rego.Rego) {
+func extractOpaUnknowns(output *request.PathProcessorOutput) []string {
 	unknowns := make([]string, len(output.Datastores))
 	for i, datastore := range output.Datastores {
 		unknowns[i] = fmt.Sprintf("data.%s", datastore)
 	}
 	logging.LogForComponent("policyCompiler").Debugf("Sending unknowns %+v", unknowns)
-	return []func(*rego.Rego){
-		rego.Unknowns(unknowns),
-	}
+	return unknowns
 }
 
 func extractOpaInput(output *request.PathProcessorOutput, input map[string]interface{}) map[string]interface{} {
@@ -304,9 +643,9 @@ func initDependencies(compConf *opa.PolicyCompilerConfig, appConf *configs.AppCo
 	return nil
 }
 
-func startOPA(conf interface{}, regosPath string) (*OPA, error) {
+func startOPA(conf interface{}, regosPath string, opts ...func(*OPA) error) (*OPA, error) {
 	ctx := context.Background()
-	engine, err := NewOPA(ctx, regosPath, ConfigOPA(conf))
+	engine, err := NewOPA(ctx, regosPath, append([]func(*OPA) error{ConfigOPA(conf)}, opts...)...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to initialize OPA!")
 	}
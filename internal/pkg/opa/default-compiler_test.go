@@ -0,0 +1,224 @@
+package opa
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
+	internalErrors "github.com/unbasical/kelon/pkg/errors"
+	"github.com/unbasical/kelon/pkg/opa"
+	"github.com/unbasical/kelon/pkg/request"
+	"github.com/unbasical/kelon/pkg/translate"
+	"github.com/unbasical/kelon/pkg/watcher"
+)
+
+const rulesPolicy = `package apps
+
+verify {
+	input.user != ""
+}
+
+allow {
+	data.mem.users[u].name == input.user
+}
+
+rate_ok {
+	input.rate < 10
+}
+`
+
+// staticPathProcessor maps each request to the same output.
+type staticPathProcessor struct {
+	output request.PathProcessorOutput
+}
+
+func (p staticPathProcessor) Configure(_ *configs.AppConfig, _ *request.PathProcessorConfig) error {
+	return nil
+}
+
+func (p staticPathProcessor) Process(_ interface{}) (*request.PathProcessorOutput, error) {
+	output := p.output
+	return &output, nil
+}
+
+// staticTranslator allows each request and returns the same filter for each datastore.
+type staticTranslator struct{}
+
+func (t staticTranslator) Configure(_ *configs.AppConfig, _ *translate.AstTranslatorConfig) error {
+	return nil
+}
+
+func (t staticTranslator) Process(_ context.Context, _ *rego.PartialQueries, _ []string) (bool, error) {
+	return true, nil
+}
+
+func (t staticTranslator) Filter(_ context.Context, _ *rego.PartialQueries, datastores []string) (map[string]data.DatastoreQuery, error) {
+	filters := make(map[string]data.DatastoreQuery, len(datastores))
+	for _, datastore := range datastores {
+		filters[datastore] = data.DatastoreQuery{Statement: "filter"}
+	}
+	return filters, nil
+}
+
+type noopWatcher struct{}
+
+func (w noopWatcher) Watch(_ func(watcher.ChangeType, *configs.ExternalConfig, error)) {}
+
+const obligationsPolicy = `package apps
+
+allow {
+	input.user != ""
+}
+
+headers[header] {
+	header := concat("-", ["X", input.user])
+}
+
+user_headers := {"X-User": input.user}
+
+response(user) := {"user": user}
+`
+
+func newTestRulesCompiler(t *testing.T, output request.PathProcessorOutput) opa.PolicyCompiler {
+	return newTestCompiler(t, rulesPolicy, output)
+}
+
+func newTestCompiler(t *testing.T, policy string, output request.PathProcessorOutput) opa.PolicyCompiler {
+	regoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(regoDir, "apps.rego"), []byte(policy), 0o600))
+
+	var (
+		parser        request.PathProcessor   = staticPathProcessor{output: output}
+		trans         translate.AstTranslator = staticTranslator{}
+		configWatcher watcher.ConfigWatcher   = noopWatcher{}
+		prefix                                = "/v1"
+	)
+	appConf := &configs.AppConfig{ExternalConfig: configs.ExternalConfig{
+		Datastores: map[string]*configs.Datastore{"mem": {Type: data.TypeMemory}},
+	}}
+	compiler := NewPolicyCompiler()
+	require.NoError(t, compiler.Configure(appConf, &opa.PolicyCompilerConfig{
+		Prefix:        &prefix,
+		RegoDir:       &regoDir,
+		ConfigWatcher: &configWatcher,
+		PathProcessor: &parser,
+		Translator:    &trans,
+	}))
+	return compiler
+}
+
+func rulesRequest(user string, rate int) map[string]interface{} {
+	return map[string]interface{}{"input": map[string]interface{}{"method": "GET", "path": "/apps", "user": user, "rate": rate}}
+}
+
+func Test_deadlineError(t *testing.T) {
+	deadline := &configs.Deadline{Timeout: 50 * time.Millisecond, OnTimeout: configs.OnTimeoutUnavailable}
+	ctx, cancel := withDeadline(context.Background(), deadline)
+	defer cancel()
+	cause := errors.New("query canceled")
+
+	// Errors are only converted after the deadline was exceeded
+	assert.Equal(t, cause, deadlineError(ctx, deadline, cause))
+	<-ctx.Done()
+	assert.Equal(t, internalErrors.DecisionTimeout{Cause: cause, Deny: false}, deadlineError(ctx, deadline, cause))
+	assert.NoError(t, deadlineError(ctx, deadline, nil))
+
+	// Mappings without deadline keep their errors
+	assert.Equal(t, cause, deadlineError(ctx, nil, cause))
+}
+
+func Test_policyCompiler_Filter_Rules(t *testing.T) {
+	compiler := newTestRulesCompiler(t, request.PathProcessorOutput{
+		Datastores: []string{"mem"},
+		Package:    "apps",
+		Rules: []*configs.PolicyRule{
+			{Name: configs.RuleVerify, Status: http.StatusUnauthorized},
+			{Name: configs.RuleAllow, Status: http.StatusForbidden},
+			{Name: "rate_ok", Status: http.StatusTooManyRequests},
+		},
+	})
+
+	// The filters are returned by the rule 'allow', even though it is not the last one
+	decision, err := compiler.Filter(context.Background(), rulesRequest("arnold", 1))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+	assert.Equal(t, map[string]data.DatastoreQuery{"mem": {Statement: "filter"}}, decision.Filters)
+
+	// All other rules are evaluated as gates
+	decision, err = compiler.Filter(context.Background(), rulesRequest("arnold", 20))
+	require.NoError(t, err)
+	assert.False(t, decision.Allow)
+	assert.Nil(t, decision.Filters)
+	assert.Equal(t, "rate_ok", decision.Rule)
+	assert.Equal(t, http.StatusTooManyRequests, decision.DenyStatus())
+
+	decision, err = compiler.Filter(context.Background(), rulesRequest("", 1))
+	require.NoError(t, err)
+	assert.False(t, decision.Verify)
+	assert.Equal(t, http.StatusUnauthorized, decision.DenyStatus())
+}
+
+func Test_policyCompiler_Filter_DeprecatedFlags(t *testing.T) {
+	// Outputs without rules are evaluated by the rules derived from the flags Authentication and Authorization
+	compiler := newTestRulesCompiler(t, request.PathProcessorOutput{
+		Datastores:     []string{"mem"},
+		Package:        "apps",
+		Authentication: false,
+		Authorization:  true,
+	})
+
+	decision, err := compiler.Filter(context.Background(), rulesRequest("", 20))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+	assert.Equal(t, map[string]data.DatastoreQuery{"mem": {Statement: "filter"}}, decision.Filters)
+}
+
+func Test_policyCompiler_Execute_Obligations(t *testing.T) {
+	output := request.PathProcessorOutput{
+		Datastores: []string{"mem"},
+		Package:    "apps",
+		Rules:      []*configs.PolicyRule{{Name: configs.RuleAllow, Status: http.StatusForbidden}},
+	}
+
+	// Rules named like an obligation whose values do not fit and functions are ignored
+	decision, err := newTestCompiler(t, obligationsPolicy, output).Execute(context.Background(), rulesRequest("arnold", 1))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+	assert.Nil(t, decision.Headers)
+	assert.Nil(t, decision.Response)
+
+	// Flagged rules provide the obligations instead
+	output.Rules = append(output.Rules, &configs.PolicyRule{Name: "user_headers", Status: http.StatusForbidden, Obligation: configs.ObligationHeaders})
+	decision, err = newTestCompiler(t, obligationsPolicy, output).Execute(context.Background(), rulesRequest("arnold", 1))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+	assert.Equal(t, map[string]string{"X-User": "arnold"}, decision.Headers)
+}
+
+func Test_policyCompiler_Execute_WithoutObligations(t *testing.T) {
+	compiler := newTestRulesCompiler(t, request.PathProcessorOutput{
+		Datastores: []string{"mem"},
+		Package:    "apps",
+		Rules:      []*configs.PolicyRule{{Name: configs.RuleAllow, Status: http.StatusForbidden}},
+	})
+
+	decision, err := compiler.Execute(context.Background(), rulesRequest("arnold", 1))
+	require.NoError(t, err)
+	assert.True(t, decision.Allow)
+
+	// Obligations which are not defined by the package are only looked up, but never evaluated
+	engine := compiler.(*policyCompiler).engine
+	assert.Contains(t, engine.prepared, "rules|data.apps.headers")
+	assert.Contains(t, engine.prepared, "rules|data.apps.response")
+	assert.NotContains(t, engine.prepared, "eval|data.apps.headers")
+	assert.NotContains(t, engine.prepared, "eval|data.apps.response")
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
@@ -30,6 +31,17 @@ import (
 type OPA struct {
 	configBytes []byte
 	manager     *plugins.Manager
+	preparedMux sync.RWMutex
+	prepared    map[string]preparedQuery
+	policyCheck func(compiler *ast.Compiler) error
+}
+
+// preparedQuery is a query which is prepared for (partial) evaluation or the rules of a reference together with the compiler it was prepared with.
+type preparedQuery struct {
+	compiler *ast.Compiler
+	partial  rego.PreparedPartialQuery
+	eval     rego.PreparedEvalQuery
+	rules    []*ast.Rule
 }
 
 type loadResult struct {
@@ -49,9 +61,17 @@ func ConfigOPA(conf interface{}) func(opa *OPA) error {
 	}
 }
 
+// CheckPolicies sets a check which is run each time policies are loaded from disk. If the check fails, the policies are not loaded.
+func CheckPolicies(check func(compiler *ast.Compiler) error) func(opa *OPA) error {
+	return func(opa *OPA) error {
+		opa.policyCheck = check
+		return nil
+	}
+}
+
 // Returns a new OPA instance.
 func NewOPA(ctx context.Context, regosPath string, opts ...func(*OPA) error) (*OPA, error) {
-	opa := &OPA{}
+	opa := &OPA{prepared: make(map[string]preparedQuery)}
 
 	// Configure OPA
 	for _, opt := range opts {
@@ -79,6 +99,13 @@ func NewOPA(ctx context.Context, regosPath string, opts ...func(*OPA) error) (*O
 	}
 	opa.manager.Register("discovery", disc)
 
+	// Prepared queries have to be prepared again as soon as the compiler changes
+	opa.manager.RegisterCompilerTrigger(func(txn storage.Transaction) {
+		opa.preparedMux.Lock()
+		defer opa.preparedMux.Unlock()
+		opa.prepared = make(map[string]preparedQuery)
+	})
+
 	// Load regos
 	if err := opa.LoadRegosFromPath(ctx, regosPath); err != nil {
 		return nil, errors.Wrap(err, "NewOPA: Unable to load regos")
@@ -118,10 +145,17 @@ func (opa *OPA) LoadRegosFromPath(ctx context.Context, regosPath string) error {
 			return errors.Wrap(err, "NewOPA: Error while writing document")
 		}
 	}
-	if err := compileAndStoreInputs(ctx, store, txn, loaded, 1); err != nil {
+	compiler, err := compileAndStoreInputs(ctx, store, txn, loaded, 1)
+	if err != nil {
 		store.Abort(ctx, txn)
 		return errors.Wrap(err, "NewOPA: Error while storing inputs")
 	}
+	if opa.policyCheck != nil {
+		if err := opa.policyCheck(compiler); err != nil {
+			store.Abort(ctx, txn)
+			return errors.Wrap(err, "NewOPA: Error while checking policies")
+		}
+	}
 	if err := store.Commit(ctx, txn); err != nil {
 		return errors.Wrap(err, "NewOPA: Error while commit")
 	}
@@ -135,23 +169,45 @@ func (opa *OPA) Start(ctx context.Context) error {
 	return opa.manager.Start(ctx)
 }
 
-// Bool returns a boolean policy decision.
-func (opa *OPA) PartialEvaluate(ctx context.Context, input interface{}, query string, opts ...func(*rego.Rego)) (*rego.PartialQueries, error) {
+// OnChange registers a callback which is invoked each time a transaction which changed policies or data is committed to the store.
+func (opa *OPA) OnChange(ctx context.Context, callback func()) error {
+	store := opa.manager.Store
+	return storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		_, err := store.Register(ctx, txn, storage.TriggerConfig{
+			OnCommit: func(ctx context.Context, txn storage.Transaction, event storage.TriggerEvent) {
+				if !event.IsZero() {
+					callback()
+				}
+			},
+		})
+		return err
+	})
+}
+
+// PartialEvaluate partially evaluates the query with the passed input, whereby all references to the unknowns are kept in the result.
+// The query is only prepared once per unknowns and compiler.
+func (opa *OPA) PartialEvaluate(ctx context.Context, input interface{}, query string, unknowns []string) (*rego.PartialQueries, error) {
 	m := metrics.New()
 	var partialResult *rego.PartialQueries
 
 	err := storage.Txn(ctx, opa.manager.Store, storage.TransactionParams{}, func(txn storage.Transaction) error {
-		var err error
-
-		r := rego.New(append(opts,
-			rego.Metrics(m),
-			rego.Query(query),
-			rego.Input(input),
-			rego.Compiler(opa.manager.GetCompiler()),
-			rego.Store(opa.manager.Store),
-			rego.Transaction(txn))...)
+		prepared, err := opa.prepare("partial|"+query+"|"+strings.Join(unknowns, ","), func(compiler *ast.Compiler) (q preparedQuery, err error) {
+			q.partial, err = rego.New(
+				rego.Query(query),
+				rego.Unknowns(unknowns),
+				rego.Compiler(compiler),
+				rego.Store(opa.manager.Store),
+				rego.Transaction(txn)).PrepareForPartial(ctx)
+			return q, err
+		})
+		if err != nil {
+			return err
+		}
 
-		rs, err := r.Partial(ctx)
+		rs, err := prepared.partial.Partial(ctx,
+			rego.EvalMetrics(m),
+			rego.EvalInput(input),
+			rego.EvalTransaction(txn))
 		if err != nil {
 			return err
 		}
@@ -162,6 +218,71 @@ func (opa *OPA) PartialEvaluate(ctx context.Context, input interface{}, query st
 	return partialResult, err
 }
 
+// Evaluate evaluates the query with the passed input and returns the value of its first result.
+// If the query is undefined, false is returned as second value. The query is only prepared once per compiler.
+func (opa *OPA) Evaluate(ctx context.Context, input interface{}, query string) (interface{}, bool, error) {
+	var result rego.ResultSet
+
+	err := storage.Txn(ctx, opa.manager.Store, storage.TransactionParams{}, func(txn storage.Transaction) error {
+		prepared, err := opa.prepare("eval|"+query, func(compiler *ast.Compiler) (q preparedQuery, err error) {
+			q.eval, err = rego.New(
+				rego.Query(query),
+				rego.Compiler(compiler),
+				rego.Store(opa.manager.Store),
+				rego.Transaction(txn)).PrepareForEval(ctx)
+			return q, err
+		})
+		if err != nil {
+			return err
+		}
+
+		result, err = prepared.eval.Eval(ctx,
+			rego.EvalInput(input),
+			rego.EvalTransaction(txn))
+		return err
+	})
+	if err != nil || len(result) == 0 || len(result[0].Expressions) == 0 {
+		return nil, false, err
+	}
+	return result[0].Expressions[0].Value, true, nil
+}
+
+// Rules returns the rules which may be referenced by the passed reference. The rules are only looked up once per compiler.
+func (opa *OPA) Rules(ref string) ([]*ast.Rule, error) {
+	prepared, err := opa.prepare("rules|"+ref, func(compiler *ast.Compiler) (q preparedQuery, err error) {
+		parsed, err := ast.ParseRef(ref)
+		if err != nil {
+			return q, err
+		}
+		q.rules = compiler.GetRules(parsed)
+		return q, nil
+	})
+	return prepared.rules, err
+}
+
+// prepare returns the prepared query which is cached under the passed key, which is prepared if it was not prepared with the current compiler yet.
+func (opa *OPA) prepare(key string, prepareWith func(compiler *ast.Compiler) (preparedQuery, error)) (preparedQuery, error) {
+	compiler := opa.manager.GetCompiler()
+
+	opa.preparedMux.RLock()
+	cached, ok := opa.prepared[key]
+	opa.preparedMux.RUnlock()
+	if ok && cached.compiler == compiler {
+		return cached, nil
+	}
+
+	prepared, err := prepareWith(compiler)
+	if err != nil {
+		return preparedQuery{}, err
+	}
+	prepared.compiler = compiler
+
+	opa.preparedMux.Lock()
+	opa.prepared[key] = prepared
+	opa.preparedMux.Unlock()
+	return prepared, nil
+}
+
 func uuid4() (string, error) {
 	bs := make([]byte, 16)
 	n, err := io.ReadFull(rand.Reader, bs)
@@ -173,7 +294,7 @@ func uuid4() (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:]), nil
 }
 
-func compileAndStoreInputs(ctx context.Context, store storage.Store, txn storage.Transaction, loaded *loadResult, errorLimit int) error {
+func compileAndStoreInputs(ctx context.Context, store storage.Store, txn storage.Transaction, loaded *loadResult, errorLimit int) (*ast.Compiler, error) {
 	policies := make(map[string]*ast.Module, len(loaded.Modules))
 
 	for id, parsed := range loaded.Modules {
@@ -194,18 +315,18 @@ func compileAndStoreInputs(ctx context.Context, store storage.Store, txn storage
 
 	err := bundle.Activate(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Policies in bundles will have already been added to the store, but
 	// modules loaded outside of bundles will need to be added manually.
 	for id, parsed := range loaded.Modules {
 		if err := store.UpsertPolicy(ctx, txn, id, parsed.Raw); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return c, nil
 }
 
 func loadPaths(paths []string, filter loader.Filter, asBundle bool) (*loadResult, error) {
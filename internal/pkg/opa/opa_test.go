@@ -0,0 +1,58 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_OPA_PartialEvaluate_PolicyChange(t *testing.T) {
+	ctx := context.Background()
+	engine, err := NewOPA(ctx, "")
+	require.NoError(t, err)
+	require.NoError(t, engine.Start(ctx))
+
+	upsertPolicy := func(policy string) {
+		require.NoError(t, storage.Txn(ctx, engine.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+			return engine.manager.Store.UpsertPolicy(ctx, txn, "apps.rego", []byte(policy))
+		}))
+	}
+	evaluate := func() int {
+		queries, evalErr := engine.PartialEvaluate(ctx, map[string]interface{}{"user": "arnold"}, "data.apps.allow == true", []string{"data.pg"})
+		require.NoError(t, evalErr)
+		return len(queries.Queries)
+	}
+
+	upsertPolicy("package apps\n\nallow { input.user == \"arnold\" }")
+	assert.Equal(t, 1, evaluate())
+	assert.Len(t, engine.prepared, 1)
+
+	// Prepared query has to use the changed policy
+	upsertPolicy("package apps\n\nallow { input.user == \"kevin\" }")
+	assert.Empty(t, engine.prepared)
+	assert.Equal(t, 0, evaluate())
+}
+
+func Test_OPA_Evaluate(t *testing.T) {
+	ctx := context.Background()
+	engine, err := NewOPA(ctx, "")
+	require.NoError(t, err)
+	require.NoError(t, engine.Start(ctx))
+	require.NoError(t, storage.Txn(ctx, engine.manager.Store, storage.WriteParams, func(txn storage.Transaction) error {
+		return engine.manager.Store.UpsertPolicy(ctx, txn, "apps.rego", []byte("package apps\n\nheaders := {\"X-User\": input.user, \"X-Roles\": [\"admin\", \"dev\"]}"))
+	}))
+
+	value, defined, err := engine.Evaluate(ctx, map[string]interface{}{"user": "arnold"}, "data.apps.headers")
+	require.NoError(t, err)
+	require.True(t, defined)
+	headers, err := obligationHeaders(value)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"X-User": "arnold", "X-Roles": "admin,dev"}, headers)
+
+	_, defined, err = engine.Evaluate(ctx, map[string]interface{}{"user": "arnold"}, "data.apps.response")
+	require.NoError(t, err)
+	assert.False(t, defined)
+}
@@ -0,0 +1,339 @@
+package opa
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/pkg/errors"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/constants/logging"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+// policyProblem is a problem inside a loaded policy which would cause requests to fail at runtime.
+type policyProblem struct {
+	Location *ast.Location
+	Message  string
+}
+
+func (p policyProblem) String() string {
+	if p.Location == nil {
+		return p.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", p.Location.File, p.Location.Row, p.Message)
+}
+
+// checkPolicies statically checks the compiled policies against the configuration and logs all found problems.
+// If strict is true, an error is returned as soon as any problem was found.
+func checkPolicies(compiler *ast.Compiler, appConf *configs.AppConfig, strict bool) error {
+	problems := findPolicyProblems(compiler, appConf)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+		logging.LogForComponent("policyCheck").Warnln(messages[i])
+	}
+	if strict {
+		return errors.Errorf("PolicyCheck: Found %d problem(s) in the loaded policies:\n%s", len(problems), strings.Join(messages, "\n"))
+	}
+	return nil
+}
+
+// findPolicyProblems walks all compiled modules and reports
+//
+// - references data.<datastore>.<entity> to entities which are not contained in the datastore's entity_schemas
+//
+// - calls of builtins on datastore entities for which the datastore's type has no call-operand mapping
+//
+// - references to datastores inside rules which provide obligations of any mapping, because obligations are not partially evaluated.
+func findPolicyProblems(compiler *ast.Compiler, appConf *configs.AppConfig) []policyProblem {
+	var problems []policyProblem
+	seen := make(map[string]bool)
+	report := func(location *ast.Location, format string, args ...interface{}) {
+		problem := policyProblem{Location: location, Message: fmt.Sprintf(format, args...)}
+		if !seen[problem.String()] {
+			seen[problem.String()] = true
+			problems = append(problems, problem)
+		}
+	}
+
+	moduleNames := make([]string, 0, len(compiler.Modules))
+	for name := range compiler.Modules {
+		moduleNames = append(moduleNames, name)
+	}
+	sort.Strings(moduleNames)
+
+	for _, name := range moduleNames {
+		for _, rule := range compiler.Modules[name].Rules {
+			checkRule(compiler, appConf, rule, report)
+		}
+	}
+	checkObligations(compiler, appConf, report)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Location, problems[j].Location
+		if a == nil || b == nil {
+			return a != nil
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Row < b.Row
+	})
+	return problems
+}
+
+func checkRule(compiler *ast.Compiler, appConf *configs.AppConfig, rule *ast.Rule, report func(location *ast.Location, format string, args ...interface{})) {
+	// Check all references to entities of datastores
+	ast.WalkTerms(rule, func(term *ast.Term) bool {
+		ref, ok := term.Value.(ast.Ref)
+		if !ok {
+			return false
+		}
+		datastore, ok := refDatastore(appConf, ref)
+		if !ok || len(ref) < 3 {
+			return false
+		}
+		if entity, isString := ref[2].Value.(ast.String); isString && !containsEntity(appConf, datastore, string(entity)) {
+			location := term.Location
+			if location == nil {
+				location = rule.Location
+			}
+			report(location, "Entity %q is not contained in any entity_schema of datastore %q", string(entity), datastore)
+		}
+		return false
+	})
+
+	// Collect all variables which are bound to datastore entities
+	bound := make(map[ast.Var]map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		ast.WalkExprs(rule, func(expr *ast.Expr) bool {
+			changed = bindVars(compiler, appConf, expr, bound) || changed
+			return false
+		})
+	}
+
+	// Collect all variables which are bound to comprehensions
+	comprehensions := make(map[ast.Var]bool)
+	ast.WalkExprs(rule, func(expr *ast.Expr) bool {
+		if !isBinding(expr) {
+			return false
+		}
+		operands := expr.Operands()
+		for i, operand := range operands {
+			if v, isVar := operand.Value.(ast.Var); isVar && ast.IsComprehension(operands[1-i].Value) {
+				comprehensions[v] = true
+			}
+		}
+		return false
+	})
+
+	// Check if all builtins which are called on datastore entities can be translated
+	ast.WalkExprs(rule, func(expr *ast.Expr) bool {
+		if !expr.IsCall() || isBinding(expr) {
+			return false
+		}
+		operator := expr.Operator()
+		arity := compiler.GetArity(operator)
+		if arity < 0 || operator.HasPrefix(ast.DefaultRootRef) {
+			return false
+		}
+		aggregate := isAggregate(expr, comprehensions)
+		// The output variable of a call does not influence whether the call can be translated
+		inputs := expr.Operands()
+		if len(inputs) > arity {
+			inputs = inputs[:arity]
+		}
+		for datastore := range termDatastores(appConf, ast.Args(inputs), bound) {
+			dsType := appConf.Datastores[datastore].Type
+			if aggregate {
+				if !translatesAggregates(dsType) {
+					report(expr.Location, "Builtin %q aggregates a comprehension, which is not supported by datastore %q of type %q", operator.String(), datastore, dsType)
+				}
+				continue
+			}
+			if _, ok := appConf.CallOperands[dsType][operator.String()]; !ok {
+				report(expr.Location, "Builtin %q has no call-operand mapping for datastore %q of type %q", operator.String(), datastore, dsType)
+			}
+		}
+		return false
+	})
+}
+
+// checkObligations reports all references to datastores inside the rules which provide obligations of any mapping,
+// including the rules and functions they call.
+func checkObligations(compiler *ast.Compiler, appConf *configs.AppConfig, report func(location *ast.Location, format string, args ...interface{})) {
+	checked := make(map[string]bool)
+	for _, dsMapping := range appConf.APIMappings {
+		for _, mapping := range dsMapping.Mappings {
+			rules := dsMapping.EffectiveRules(mapping)
+			for _, obligation := range []string{configs.ObligationHeaders, configs.ObligationResponse} {
+				name := configs.ObligationRule(rules, obligation)
+				ref, err := ast.ParseRef(fmt.Sprintf("data.%s.%s", mapping.Package, name))
+				if name == "" || err != nil || checked[ref.String()] {
+					continue
+				}
+				checked[ref.String()] = true
+
+				visited := make(map[*ast.Rule]bool)
+				for _, rule := range compiler.GetRules(ref) {
+					checkObligationRule(compiler, appConf, rule, ref, visited, report)
+				}
+			}
+		}
+	}
+}
+
+func checkObligationRule(compiler *ast.Compiler, appConf *configs.AppConfig, rule *ast.Rule, obligation ast.Ref, visited map[*ast.Rule]bool, report func(location *ast.Location, format string, args ...interface{})) {
+	if visited[rule] {
+		return
+	}
+	visited[rule] = true
+
+	ast.WalkTerms(rule, func(term *ast.Term) bool {
+		ref, ok := term.Value.(ast.Ref)
+		if !ok || !ref.HasPrefix(ast.DefaultRootRef) {
+			return false
+		}
+		if datastore, isDatastore := refDatastore(appConf, ref); isDatastore {
+			location := term.Location
+			if location == nil {
+				location = rule.Location
+			}
+			report(location, "Obligation %q references datastore %q, but obligations can only use the input and data of OPA", obligation.String(), datastore)
+			return false
+		}
+		for _, called := range compiler.GetRules(ref.ConstantPrefix()) {
+			checkObligationRule(compiler, appConf, called, obligation, visited, report)
+		}
+		return false
+	})
+}
+
+// bindVars adds all variables to bound which are bound to datastore entities by the expression, i.e. the indices of
+// references to datastore entities, variables which are unified with such terms and output variables of builtin calls on them.
+// Returns true if any variable was added.
+func bindVars(compiler *ast.Compiler, appConf *configs.AppConfig, expr *ast.Expr, bound map[ast.Var]map[string]bool) bool {
+	changed := false
+	bind := func(v ast.Var, datastores map[string]bool) {
+		if v.IsWildcard() {
+			return
+		}
+		for datastore := range datastores {
+			if bound[v] == nil {
+				bound[v] = make(map[string]bool)
+			}
+			if !bound[v][datastore] {
+				bound[v][datastore] = true
+				changed = true
+			}
+		}
+	}
+
+	ast.WalkRefs(expr, func(ref ast.Ref) bool {
+		if datastore, ok := refDatastore(appConf, ref); ok && len(ref) > 3 {
+			if v, isVar := ref[3].Value.(ast.Var); isVar {
+				bind(v, map[string]bool{datastore: true})
+			}
+		}
+		return false
+	})
+
+	if !expr.IsCall() {
+		return changed
+	}
+	operands := expr.Operands()
+	if isBinding(expr) {
+		datastores := termDatastores(appConf, expr, bound)
+		for _, operand := range operands {
+			if v, isVar := operand.Value.(ast.Var); isVar {
+				bind(v, datastores)
+			}
+		}
+		return changed
+	}
+	if arity := compiler.GetArity(expr.Operator()); arity >= 0 && len(operands) > arity {
+		if v, isVar := operands[arity].Value.(ast.Var); isVar {
+			bind(v, termDatastores(appConf, ast.Args(operands[:arity]), bound))
+		}
+	}
+	return changed
+}
+
+// termDatastores returns all datastores which are referenced by the passed term either directly or via a bound variable.
+func termDatastores(appConf *configs.AppConfig, x interface{}, bound map[ast.Var]map[string]bool) map[string]bool {
+	result := make(map[string]bool)
+	ast.WalkTerms(x, func(term *ast.Term) bool {
+		switch v := term.Value.(type) {
+		case ast.Ref:
+			if datastore, ok := refDatastore(appConf, v); ok {
+				result[datastore] = true
+			}
+		case ast.Var:
+			for datastore := range bound[v] {
+				result[datastore] = true
+			}
+		}
+		return false
+	})
+	return result
+}
+
+// refDatastore returns the alias of the datastore the reference points to (if any).
+func refDatastore(appConf *configs.AppConfig, ref ast.Ref) (string, bool) {
+	if len(ref) < 2 || !ref[0].Equal(ast.DefaultRootDocument) {
+		return "", false
+	}
+	alias, ok := ref[1].Value.(ast.String)
+	if !ok {
+		return "", false
+	}
+	if _, ok = appConf.Datastores[string(alias)]; !ok {
+		return "", false
+	}
+	return string(alias), true
+}
+
+// containsEntity checks if any schema of the datastore contains the entity (including nested entities).
+func containsEntity(appConf *configs.AppConfig, datastore, entity string) bool {
+	for _, schema := range appConf.DatastoreSchemas[datastore] {
+		for _, reachable := range schema.GenerateEntityPaths() {
+			if _, ok := reachable[entity]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAggregate checks if the expression aggregates a comprehension, which is translated into a subquery.
+func isAggregate(expr *ast.Expr, comprehensions map[ast.Var]bool) bool {
+	operands := expr.Operands()
+	if !data.IsAggregateFunction(expr.Operator().String()) || len(operands) == 0 {
+		return false
+	}
+	if v, isVar := operands[0].Value.(ast.Var); isVar {
+		return comprehensions[v]
+	}
+	return ast.IsComprehension(operands[0].Value)
+}
+
+// translatesAggregates checks if the datastores of the passed type translate aggregates of comprehensions.
+func translatesAggregates(dsType string) bool {
+	switch dsType {
+	case data.TypeMysql, data.TypePostgres, data.TypeSqlite, data.TypeMongo:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBinding(expr *ast.Expr) bool {
+	return expr.IsEquality() || expr.IsAssignment()
+}
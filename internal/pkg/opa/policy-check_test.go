@@ -0,0 +1,139 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+)
+
+const checkedPolicy = `package applications
+
+allow {
+	some u
+	data.pg.users[u].name == input.user
+	lower(u.role) == "admin"
+}
+
+allow {
+	some u
+	data.pg.userz[u].name == input.user
+}
+
+allow {
+	some app
+	data.pg.apps[app].id == input.app
+	data.pg.rights[_].right == "OWNER"
+	lower(input.user) == "arnold"
+}
+
+allow {
+	some u
+	data.pg.users[u].name == input.user
+	count([app | data.pg.apps[app].owner_id == u.id]) < 10
+}
+
+allow {
+	count([u | data.mem.users[u].name == input.user]) < 10
+}
+`
+
+func policyCheckAppConfig() *configs.AppConfig {
+	noop := func(args ...string) (string, error) { return "", nil }
+	return &configs.AppConfig{
+		ExternalConfig: configs.ExternalConfig{
+			Datastores: map[string]*configs.Datastore{"pg": {Type: "postgres"}, "mem": {Type: "memory"}},
+			DatastoreSchemas: configs.DatastoreSchemas{
+				"pg": {"appstore": {Entities: []*configs.Entity{
+					{Name: "users"},
+					{Name: "apps", Entities: []*configs.Entity{{Name: "rights"}}},
+				}}},
+				"mem": {"appstore": {Entities: []*configs.Entity{{Name: "users"}}}},
+			},
+		},
+		CallOperands: map[string]map[string]func(args ...string) (string, error){
+			"postgres": {"eq": noop, "equal": noop, "lt": noop},
+			"memory":   {"eq": noop, "equal": noop, "lt": noop, "count": noop},
+		},
+	}
+}
+
+func Test_findPolicyProblems(t *testing.T) {
+	compiler, err := ast.CompileModules(map[string]string{"apps.rego": checkedPolicy})
+	require.NoError(t, err)
+
+	problems := findPolicyProblems(compiler, policyCheckAppConfig())
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+	}
+	assert.Equal(t, []string{
+		"apps.rego:6: Builtin \"lower\" has no call-operand mapping for datastore \"pg\" of type \"postgres\"",
+		"apps.rego:11: Entity \"userz\" is not contained in any entity_schema of datastore \"pg\"",
+		"apps.rego:28: Builtin \"count\" aggregates a comprehension, which is not supported by datastore \"mem\" of type \"memory\"",
+	}, messages)
+}
+
+func Test_OPA_LoadRegosFromPath_StrictPolicyCheck(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apps.rego"), []byte(checkedPolicy), 0o600))
+
+	appConf := policyCheckAppConfig()
+	_, err := NewOPA(context.Background(), dir, CheckPolicies(func(compiler *ast.Compiler) error {
+		return checkPolicies(compiler, appConf, true)
+	}))
+	assert.ErrorContains(t, err, "Found 3 problem(s)")
+
+	_, err = NewOPA(context.Background(), dir, CheckPolicies(func(compiler *ast.Compiler) error {
+		return checkPolicies(compiler, appConf, false)
+	}))
+	assert.NoError(t, err)
+}
+
+const obligationsCheckedPolicy = `package applications
+
+allow {
+	data.pg.users[_].name == input.user
+}
+
+headers := {"X-User": input.user, "X-Role": role}
+
+role := r {
+	data.pg.users[u].name == input.user
+	r := u.role
+}
+
+user_response := {"user": input.user}
+`
+
+func Test_findPolicyProblems_Obligations(t *testing.T) {
+	compiler, err := ast.CompileModules(map[string]string{"apps.rego": obligationsCheckedPolicy})
+	require.NoError(t, err)
+
+	appConf := policyCheckAppConfig()
+	appConf.APIMappings = []*configs.DatastoreAPIMapping{{
+		Datastores: []string{"pg"},
+		Mappings: []*configs.APIMapping{{
+			Package: "applications",
+			Rules: []*configs.PolicyRule{
+				{Name: configs.RuleAllow, Status: 403},
+				{Name: "user_response", Status: 403, Obligation: configs.ObligationResponse},
+			},
+		}},
+	}}
+
+	// Datastores are only reported inside obligations, including the rules they use
+	problems := findPolicyProblems(compiler, appConf)
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+	}
+	assert.Equal(t, []string{
+		"apps.rego:10: Obligation \"data.applications.headers\" references datastore \"pg\", but obligations can only use the input and data of OPA",
+	}, messages)
+}
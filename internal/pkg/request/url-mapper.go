@@ -23,6 +23,7 @@ type pathMapper struct {
 type compiledMapping struct {
 	matcher        *regexp.Regexp
 	mapping        *configs.APIMapping
+	rules          []*configs.PolicyRule
 	authorization  bool
 	authentication bool
 	importance     int
@@ -111,6 +112,8 @@ func (mapper pathMapper) handleInput(input *pathMapperInput) (*request.MapperOut
 		return &request.MapperOutput{
 			Datastores:     matches[0].datastores,
 			Package:        matches[0].mapping.Package,
+			Rules:          matches[0].rules,
+			Deadline:       matches[0].mapping.Deadline,
 			Authentication: matches[0].authentication,
 			Authorization:  matches[0].authorization,
 		}, nil
@@ -152,6 +155,7 @@ func (mapper *pathMapper) generateMappings() error {
 			mapper.mappings = append(mapper.mappings, &compiledMapping{
 				matcher:        regex,
 				mapping:        mapping,
+				rules:          dsMapping.EffectiveRules(mapping),
 				authentication: *dsMapping.Authentication,
 				authorization:  *dsMapping.Authorization,
 				importance:     len(pathPrefix) + len(mapping.Path) + queriesCount + endpointsCount,
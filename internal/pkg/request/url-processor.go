@@ -96,10 +96,12 @@ func (processor urlProcessor) handleInput(input *URLProcessorInput) (*request.Pa
 	output := request.PathProcessorOutput{
 		Datastores:     out.Datastores,
 		Package:        out.Package,
-		Authentication: out.Authentication,
-		Authorization:  out.Authorization,
+		Rules:          out.EffectiveRules(),
+		Deadline:       out.Deadline,
 		Path:           path,
 		Queries:        queries,
+		Authentication: out.Authentication,
+		Authorization:  out.Authorization,
 	}
 	return &output, nil
 }
@@ -2,6 +2,8 @@ package translate
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"slices"
 	"strconv"
 
@@ -10,13 +12,34 @@ import (
 	"github.com/unbasical/kelon/pkg/constants/logging"
 )
 
+// Characters of iterators which are not allowed inside aliases
+//
+//nolint:gochecknoglobals,gocritic
+var invalidAliasCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Package of the support rules of the partial evaluation
+//
+//nolint:gochecknoglobals,gocritic
+var supportPackage = ast.MustParseRef("data.partial")
+
 type preprocessedQuery struct {
 	query     ast.Body
 	datastore string
+	// Aliases of entities which are iterated several times (alias -> entity)
+	aliases map[string]string
+}
+
+// supportRuleBody is a body of a support rule with the arguments of its rule.
+type supportRuleBody struct {
+	args []ast.Var
+	body ast.Body
 }
 
 type astPreprocessor struct {
-	tableNames        map[string]string
+	// Bodies of the support rules of the partial evaluation which can be negated (rule -> bodies)
+	supportRules      map[string][]supportRuleBody
+	iterators         map[string]string
+	aliases           map[string]string
 	tableVars         map[string][]*ast.Term
 	localVars         map[string]*ast.Term
 	datastorePool     []string
@@ -33,41 +56,261 @@ func newAstPreprocessor() *astPreprocessor {
 // Refs are rewritten to correspond directly to SQL tables and columns.
 // Specifically, refs of the form data.foo[var].bar are rewritten as data.foo.bar. Similarly, if var is
 // dereferenced later in the query, e.g., var.baz, that will be rewritten as data.foo.baz.
-func (processor *astPreprocessor) Process(ctx context.Context, queries []ast.Body, datastores []string) ([]preprocessedQuery, error) {
+//
+// Negated references to support rules of the partial evaluation (e.g. "not data.partial.__not1_1_2__"), which are generated
+// for negated rules, are rewritten as "not count([x | body]) > 0" for each body of the rule, so that they are translated into subqueries.
+func (processor *astPreprocessor) Process(ctx context.Context, queries []ast.Body, support []*ast.Module, datastores []string) ([]preprocessedQuery, error) {
 	transformedQueries := make([]preprocessedQuery, len(queries))
 	processor.datastorePool = datastores
+	processor.supportRules = negatableSupportRules(support)
 
 	for i, q := range queries {
 		logging.LogForComponent("astPreprocessor").Debugf("================= PREPROCESS QUERY: %+v", q)
-		processor.tableNames = make(map[string]string)
+		processor.iterators = make(map[string]string)
+		processor.aliases = make(map[string]string)
 		processor.tableVars = make(map[string][]*ast.Term)
 		processor.localVars = make(map[string]*ast.Term)
 		processor.expectedDatastore = ""
 
-		var transformedExprs []*ast.Expr
-		for _, expr := range q {
-			// Only transform operands
-			terms := []*ast.Term{ast.NewTerm(expr.Operator())}
-			for _, o := range expr.Operands() {
-				trans, err := processor.transformRefs(o)
-				if err != nil {
-					return nil, errors.Wrapf(err, "Preprocessor: Error while preprocessing Operator %T -> [%+v] of expression [%+v]", o, o, expr)
-				}
-				terms = append(terms, ast.NewTerm(trans.(ast.Value)))
+		transformed, err := processor.transformBody(q)
+		if err != nil {
+			return nil, err
+		}
+		transformedQueries[i] = preprocessedQuery{query: transformed, datastore: processor.expectedDatastore, aliases: processor.aliases}
+	}
+	return transformedQueries, nil
+}
+
+func (processor *astPreprocessor) transformBody(body ast.Body) (ast.Body, error) {
+	var transformedExprs []*ast.Expr
+	for _, expr := range body {
+		exprs := []*ast.Expr{expr}
+		if rule, operands, isSupportRule := supportRuleReference(expr); isSupportRule {
+			negations, err := processor.negateSupportRule(rule, operands, expr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Preprocessor: Error while preprocessing Expression [%+v]", expr)
 			}
+			exprs = negations
+		}
 
-			terms, err := processor.substituteVars(terms)
+		for _, e := range exprs {
+			transformed, err := processor.transformExpr(e)
 			if err != nil {
-				return []preprocessedQuery{}, errors.Wrapf(err, "Preprocessor: Error while preprocessing Expression [%+v]", expr)
+				return nil, err
 			}
+			if transformed != nil {
+				transformedExprs = append(transformedExprs, transformed)
+			}
+		}
+	}
+	return ast.NewBody(transformedExprs...), nil
+}
+
+// transformExpr rewrites the refs of the expression's operands and substitutes its local variables.
+// Nil is returned for declarations of local variables.
+func (processor *astPreprocessor) transformExpr(expr *ast.Expr) (*ast.Expr, error) {
+	// Expressions which only consist of a term iterate an entity, e.g. data.<datastore>.foo[x]
+	if term, ok := expr.Terms.(*ast.Term); ok {
+		trans, err := processor.transformTerm(term)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Preprocessor: Error while preprocessing Expression [%+v]", expr)
+		}
+		transformed := ast.NewExpr(trans)
+		transformed.Negated = expr.Negated
+		return transformed, nil
+	}
+
+	// Only transform operands
+	terms := []*ast.Term{ast.NewTerm(expr.Operator())}
+	for _, o := range expr.Operands() {
+		trans, err := processor.transformTerm(o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Preprocessor: Error while preprocessing Operator %T -> [%+v] of expression [%+v]", o, o, expr)
+		}
+		terms = append(terms, trans)
+	}
 
-			if terms != nil {
-				transformedExprs = append(transformedExprs, ast.NewExpr(terms))
+	terms, err := processor.substituteVars(terms)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Preprocessor: Error while preprocessing Expression [%+v]", expr)
+	}
+	if terms == nil {
+		return nil, nil
+	}
+
+	transformed := ast.NewExpr(terms)
+	transformed.Negated = expr.Negated
+	return transformed, nil
+}
+
+// negateSupportRule rewrites the negated reference to a support rule as "not count([x | body]) > 0" for each body of the rule,
+// whereby x is the first iterator of the body. Arguments of the rule are replaced by the operands of the call inside the body,
+// so that the subquery is correlated with the iterators of the query.
+func (processor *astPreprocessor) negateSupportRule(rule string, operands []*ast.Term, expr *ast.Expr) ([]*ast.Expr, error) {
+	if !expr.Negated {
+		return nil, errors.Errorf("Support rule %s of the partial evaluation is only supported inside negations", rule)
+	}
+	bodies, ok := processor.supportRules[rule]
+	if !ok {
+		return nil, errors.Errorf("Support rule %s of the partial evaluation can not be negated, because it has another value than true or its arguments are no variables", rule)
+	}
+
+	negations := make([]*ast.Expr, len(bodies))
+	for i, body := range bodies {
+		if len(body.args) != len(operands) {
+			return nil, errors.Errorf("Support rule %s of the partial evaluation expects %d arguments, but got %d", rule, len(body.args), len(operands))
+		}
+		substitutions := make(map[ast.Var]ast.Value, len(operands))
+		for j, arg := range body.args {
+			substitutions[arg] = operands[j].Value
+		}
+		substituted, err := ast.TransformVars(body.body.Copy(), func(v ast.Var) (ast.Value, error) {
+			if sub, isArg := substitutions[v]; isArg {
+				return sub, nil
 			}
+			return v, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		iterator, found := firstIterator(substituted.(ast.Body))
+		if !found {
+			return nil, errors.Errorf("Support rule %s of the partial evaluation does not iterate any entity", rule)
 		}
-		transformedQueries[i] = preprocessedQuery{query: ast.NewBody(transformedExprs...), datastore: processor.expectedDatastore}
+		count := ast.CallTerm(ast.NewTerm(ast.Count.Ref()), ast.ArrayComprehensionTerm(ast.NewTerm(iterator), substituted.(ast.Body)))
+		negations[i] = ast.NewExpr([]*ast.Term{ast.NewTerm(ast.GreaterThan.Ref()), count, ast.IntNumberTerm(0)})
+		negations[i].Negated = true
 	}
-	return transformedQueries, nil
+	return negations, nil
+}
+
+// negatableSupportRules returns the bodies of all support rules (ref -> bodies), which are true if any of their bodies is satisfied
+// and false otherwise. Rules with other values or arguments, which are no variables, are omitted.
+func negatableSupportRules(support []*ast.Module) map[string][]supportRuleBody {
+	rules := make(map[string][]supportRuleBody)
+	unsupported := make(map[string]bool)
+	for _, module := range support {
+		if !module.Package.Path.HasPrefix(supportPackage) {
+			continue
+		}
+		for _, rule := range module.Rules {
+			name := module.Package.Path.Append(ast.StringTerm(rule.Head.Name.String())).String()
+			if rule.Default && rule.Head.Value.Equal(ast.BooleanTerm(false)) {
+				continue
+			}
+			if rule.Default || rule.Else != nil || rule.Head.Key != nil || rule.Head.Value == nil || !rule.Head.Value.Equal(ast.BooleanTerm(true)) {
+				unsupported[name] = true
+				continue
+			}
+
+			args := make([]ast.Var, len(rule.Head.Args))
+			for i, arg := range rule.Head.Args {
+				v, isVar := arg.Value.(ast.Var)
+				if !isVar {
+					unsupported[name] = true
+				}
+				args[i] = v
+			}
+			rules[name] = append(rules[name], supportRuleBody{args: args, body: rule.Body})
+		}
+	}
+	for name := range unsupported {
+		delete(rules, name)
+	}
+	return rules
+}
+
+// supportRuleReference returns the ref of the support rule and the operands of the call, if the expression only references
+// a support rule (e.g. data.partial.__not1_1_2__ or data.partial.__not1_1_2__(x)).
+func supportRuleReference(expr *ast.Expr) (string, []*ast.Term, bool) {
+	var (
+		ref      ast.Ref
+		operands []*ast.Term
+		ok       bool
+	)
+	if term, isTerm := expr.Terms.(*ast.Term); isTerm {
+		ref, ok = term.Value.(ast.Ref)
+	} else if expr.IsCall() {
+		ref, operands, ok = expr.Operator(), expr.Operands(), true
+	}
+	if !ok || len(ref) <= len(supportPackage) || !ref.HasPrefix(supportPackage) {
+		return "", nil, false
+	}
+	return ref.String(), operands, true
+}
+
+// firstIterator returns the first variable of the body which iterates an entity, i.e. x in data.<datastore>.foo[x].
+func firstIterator(body ast.Body) (ast.Var, bool) {
+	var (
+		iterator ast.Var
+		found    bool
+	)
+	ast.WalkRefs(body, func(ref ast.Ref) bool {
+		if found || len(ref) < 4 || !ref[0].Equal(ast.DefaultRootDocument) {
+			return found
+		}
+		iterator, found = ref[3].Value.(ast.Var)
+		return found
+	})
+	return iterator, found
+}
+
+// transformTerm rewrites all refs of the term (see transformRefs). Comprehensions are preprocessed like queries,
+// so that their heads are rewritten after the iterators of their bodies are known.
+func (processor *astPreprocessor) transformTerm(term *ast.Term) (*ast.Term, error) {
+	switch v := term.Value.(type) {
+	case *ast.ArrayComprehension:
+		head, body, err := processor.transformComprehension(v.Term, v.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ast.ArrayComprehensionTerm(head, body), nil
+	case *ast.SetComprehension:
+		head, body, err := processor.transformComprehension(v.Term, v.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ast.SetComprehensionTerm(head, body), nil
+	case ast.Call:
+		call := ast.Call{v[0]}
+		for _, arg := range v[1:] {
+			trans, err := processor.transformTerm(arg)
+			if err != nil {
+				return nil, err
+			}
+			call = append(call, trans)
+		}
+		return ast.NewTerm(call), nil
+	default:
+		trans, err := processor.transformRefs(v)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewTerm(trans.(ast.Value)), nil
+	}
+}
+
+// transformComprehension preprocesses the body of the comprehension and substitutes its head, which is either
+// an iterator (replaced by the ref of the iterated entity, e.g. data.foo) or a local variable.
+func (processor *astPreprocessor) transformComprehension(head *ast.Term, body ast.Body) (*ast.Term, ast.Body, error) {
+	transformedBody, err := processor.transformBody(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, ok := head.Value.(ast.Var)
+	if !ok {
+		transformedHead, headErr := processor.transformTerm(head)
+		return transformedHead, transformedBody, headErr
+	}
+	if prefix, isIterator := processor.tableVars[string(v)]; isIterator {
+		return ast.NewTerm(ast.Ref{}.Concat(prefix)), transformedBody, nil
+	}
+	if sub, isLocal := processor.localVars[v.String()]; isLocal {
+		return sub, transformedBody, nil
+	}
+	return nil, nil, errors.Errorf("Undefined variable %s", v.String())
 }
 
 func (processor *astPreprocessor) transformRefs(value interface{}) (interface{}, error) {
@@ -89,6 +332,11 @@ func (processor *astPreprocessor) transformRefs(value interface{}) (interface{},
 			return nil, errors.Wrapf(err, "Unable to unquote")
 		}
 
+		// Support rules can only be translated if they are negated (see negateSupportRule)
+		if node.HasPrefix(supportPackage) && !slices.Contains(processor.datastorePool, dsNode) {
+			return nil, errors.Errorf("Invalid reference: support rule [%s] of the partial evaluation is only supported inside negations", node.String())
+		}
+
 		// if no datastore was configured yet, set one
 		if processor.expectedDatastore == "" {
 			if slices.Contains(processor.datastorePool, dsNode) {
@@ -103,27 +351,22 @@ func (processor *astPreprocessor) transformRefs(value interface{}) (interface{},
 			return nil, errors.Errorf("Invalid reference: expected [data.%s.<table>] but found reference [%s] ", processor.expectedDatastore, node.String())
 		}
 
-		rowID := node[3].Value
-
 		// Refs must be of the form data.<datastore>.<table>[<iterator>].<column>.
-		if _, ok := rowID.(ast.Var); !ok {
-			return nil, errors.Errorf("Invalid reference: row identifier type not supported: %s", rowID.String())
+		rowID, ok := node[3].Value.(ast.Var)
+		if !ok {
+			return nil, errors.Errorf("Invalid reference: row identifier type not supported: %s", node[3].Value.String())
 		}
 
-		// Remove datastore from prefix
-		prefix := []*ast.Term{node[0], node[2]}
+		// Remove datastore from prefix. Each further iterator of the same table references the table by an alias (self-link).
+		tableName, err := strconv.Unquote(node[2].String())
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to unquote")
+		}
+		// Iterators are identified by their names instead of their string representations, which are the same for all wildcards (_)
+		prefix := []*ast.Term{node[0], ast.StringTerm(processor.iteratorName(tableName, string(rowID)))}
 
 		// Add mapping so that we can expand refs above.
-		processor.tableVars[rowID.String()] = prefix
-		tableName := node[2].Value.String()
-
-		// Keep track of iterators used for each table. We do not support
-		// self-links currently. Self-links require namespacing in the SQL
-		// value.
-		if match, ok := processor.tableNames[tableName]; ok && match != rowID.String() {
-			return nil, errors.Errorf("invalid reference: self-links not supported")
-		}
-		processor.tableNames[tableName] = rowID.String()
+		processor.tableVars[string(rowID)] = prefix
 
 		// Rewrite ref to remove iterator var. E.g., "data.<datastore>.foo[x].bar" =>
 		// "data.foo.bar".
@@ -133,6 +376,38 @@ func (processor *astPreprocessor) transformRefs(value interface{}) (interface{},
 	return ast.TransformRefs(value, trans)
 }
 
+// iteratorName returns the name under which the table is referenced by the iterator. The first iterator of a table
+// references it by its name, each further one by the alias <table>_<iterator> (e.g. users_friend1 for data.pg.users[friend1]),
+// so that aliases do not depend on the order of the expressions. Characters of generated iterators, which are no valid
+// identifiers (e.g. $ of wildcards), are replaced by underscores. Aliases which are already used are suffixed with _<n>.
+func (processor *astPreprocessor) iteratorName(tableName, iterator string) string {
+	if name, ok := processor.iterators[iterator]; ok {
+		return name
+	}
+
+	name := tableName
+	if processor.isIteratorName(name) {
+		name = fmt.Sprintf("%s_%s", tableName, invalidAliasCharacters.ReplaceAllString(iterator, "_"))
+	}
+	for n, alias := 2, name; processor.isIteratorName(name); n++ {
+		name = fmt.Sprintf("%s_%d", alias, n)
+	}
+	if name != tableName {
+		processor.aliases[name] = tableName
+	}
+	processor.iterators[iterator] = name
+	return name
+}
+
+func (processor *astPreprocessor) isIteratorName(name string) bool {
+	for _, used := range processor.iterators {
+		if used == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (processor *astPreprocessor) substituteVars(terms []*ast.Term) ([]*ast.Term, error) {
 	// local variable declaration -> store and return
 	if isLocalVarDeclaration(terms) {
@@ -144,19 +419,36 @@ func (processor *astPreprocessor) substituteVars(terms []*ast.Term) ([]*ast.Term
 
 	var transformedTerms []*ast.Term
 	for _, term := range terms {
-		v, ok := term.Value.(ast.Var)
-		if !ok { // Not a variable -> no substitution
-			transformedTerms = append(transformedTerms, term)
-			continue
+		sub, err := processor.substituteVar(term)
+		if err != nil {
+			return nil, err
 		}
+		transformedTerms = append(transformedTerms, sub)
+	}
+	return transformedTerms, nil
+}
 
+// substituteVar substitutes the term if it is a local variable. Arguments of calls are substituted as well.
+func (processor *astPreprocessor) substituteVar(term *ast.Term) (*ast.Term, error) {
+	switch v := term.Value.(type) {
+	case ast.Var:
 		if sub, ok := processor.localVars[v.String()]; ok {
-			transformedTerms = append(transformedTerms, sub)
-		} else {
-			return nil, errors.Errorf("Undefined variable %s", v.String())
+			return sub, nil
+		}
+		return nil, errors.Errorf("Undefined variable %s", v.String())
+	case ast.Call:
+		call := ast.Call{v[0]}
+		for _, arg := range v[1:] {
+			sub, err := processor.substituteVar(arg)
+			if err != nil {
+				return nil, err
+			}
+			call = append(call, sub)
 		}
+		return ast.NewTerm(call), nil
+	default: // Not a variable -> no substitution
+		return term, nil
 	}
-	return transformedTerms, nil
 }
 
 func isLocalVarDeclaration(terms []*ast.Term) bool {
@@ -182,10 +474,11 @@ func isLocalVarDeclaration(terms []*ast.Term) bool {
 		return false
 	}
 
-	// Check right side of eq is ast.Ref
-	if _, ok := terms[2].Value.(ast.Ref); !ok {
+	// Check right side of eq is ast.Ref or a comprehension
+	switch terms[2].Value.(type) {
+	case ast.Ref, *ast.ArrayComprehension, *ast.SetComprehension:
+		return true
+	default:
 		return false
 	}
-
-	return true
 }
@@ -0,0 +1,43 @@
+package translate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_astPreprocessor_SelfLink(t *testing.T) {
+	queries := []ast.Body{
+		ast.MustParseBody(`"arnold" = data.pg.users[user1].name; data.pg.users[friend1].name = user1.friend; friend1.role = "ADMIN"`),
+		// Same query with reordered expressions
+		ast.MustParseBody(`data.pg.users[friend1].role = "ADMIN"; "arnold" = data.pg.users[user1].name; friend1.name = user1.friend`),
+	}
+
+	preprocessed, err := newAstPreprocessor().Process(context.Background(), queries, nil, []string{"pg"})
+	require.NoError(t, err)
+	require.Len(t, preprocessed, 2)
+
+	// Further iterators of a table are aliased after their iterator
+	assert.Equal(t, "pg", preprocessed[0].datastore)
+	assert.Equal(t, map[string]string{"users_friend1": "users"}, preprocessed[0].aliases)
+	assert.Equal(t, `"arnold" = data.users.name; data.users_friend1.name = data.users.friend; data.users_friend1.role = "ADMIN"`, preprocessed[0].query.String())
+
+	assert.Equal(t, map[string]string{"users_user1": "users"}, preprocessed[1].aliases)
+	assert.Equal(t, `data.users.role = "ADMIN"; "arnold" = data.users_user1.name; data.users.name = data.users_user1.friend`, preprocessed[1].query.String())
+}
+
+func Test_astPreprocessor_SelfLinkGeneratedIterators(t *testing.T) {
+	queries := []ast.Body{
+		ast.MustParseBody(`"arnold" = data.pg.users[_].name; data.pg.users[_].role = "ADMIN"; data.pg.users[__local0__2].role = "OWNER"`),
+	}
+
+	preprocessed, err := newAstPreprocessor().Process(context.Background(), queries, nil, []string{"pg"})
+	require.NoError(t, err)
+	require.Len(t, preprocessed, 1)
+
+	// Each wildcard is an iterator on its own. Characters of generated iterators which are no valid identifiers are replaced.
+	assert.Equal(t, map[string]string{"users__1": "users", "users___local0__2": "users"}, preprocessed[0].aliases)
+}
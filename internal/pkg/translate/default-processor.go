@@ -2,11 +2,14 @@ package translate
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
+	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/pkg/errors"
 	"github.com/unbasical/kelon/internal/pkg/util"
 	"github.com/unbasical/kelon/pkg/constants/logging"
 	"github.com/unbasical/kelon/pkg/data"
@@ -15,6 +18,7 @@ import (
 
 type astProcessor struct {
 	fromEntity   *data.Entity
+	aliases      map[string]string
 	link         map[string]interface{}
 	conjunctions []data.Node
 	entities     map[string]interface{}
@@ -23,14 +27,21 @@ type astProcessor struct {
 	errors       []string
 	skipUnknown  bool
 	validateMode bool
+	// Entities which are referenced by the query outside of comprehensions
+	scope map[string]bool
+	// Entities of enclosing queries, which are correlated with the query of a comprehension (see translateAggregate)
+	outer map[string]bool
 }
 
 func newAstProcessor(skipUnknown, validateMode bool) *astProcessor {
 	return &astProcessor{skipUnknown: skipUnknown, validateMode: validateMode}
 }
 
-// See translate.AstTranslator.
-func (p *astProcessor) Process(_ context.Context, query ast.Body) (data.Node, error) {
+// See translate.AstTranslator. Aliases map the names of further iterators of an entity to the entity (see astPreprocessor).
+func (p *astProcessor) Process(_ context.Context, query ast.Body, aliases map[string]string) (data.Node, error) {
+	p.aliases = aliases
+	p.scope = outerEntities(query)
+	p.outer = make(map[string]bool)
 	p.link = make(map[string]interface{})
 	p.conjunctions = []data.Node{}
 	p.entities = make(map[string]interface{})
@@ -44,10 +55,13 @@ func (p *astProcessor) Process(_ context.Context, query ast.Body) (data.Node, er
 	condition := data.Condition{Clause: data.Conjunction{Clauses: append(p.conjunctions[:0:0], p.conjunctions...)}}
 
 	// Add new Query
-	delete(p.link, p.fromEntity.String())
+	if p.fromEntity == nil {
+		return nil, internalErrors.InvalidRequestTranslation{Causes: append(p.errors, "Query does not reference any entity")}
+	}
+	delete(p.link, p.fromEntity.Name())
 	clause = data.Query{
 		From:      *p.fromEntity,
-		Link:      toDataLink(p.link),
+		Link:      p.toDataLink(p.link),
 		Condition: condition,
 	}
 
@@ -64,14 +78,22 @@ func (p *astProcessor) Process(_ context.Context, query ast.Body) (data.Node, er
 	return clause, nil
 }
 
-func toDataLink(linkedEntities map[string]interface{}) data.Link {
+func (p *astProcessor) toDataLink(linkedEntities map[string]interface{}) data.Link {
 	entities := make([]data.Entity, len(linkedEntities))
 	for i, e := range keys(linkedEntities) {
-		entities[i] = data.Entity{Value: e}
+		entities[i] = p.toEntity(e)
 	}
 	return data.Link{Entities: entities}
 }
 
+// toEntity returns the entity which is referenced by the name inside the query.
+func (p *astProcessor) toEntity(name string) data.Entity {
+	if entity, ok := p.aliases[name]; ok {
+		return data.Entity{Value: entity, Alias: name}
+	}
+	return data.Entity{Value: name}
+}
+
 // Implementation of the visitor pattern to crawl the AST.
 func (p *astProcessor) Visit(v interface{}) ast.Visitor {
 	switch node := v.(type) {
@@ -113,6 +135,14 @@ func (p *astProcessor) translateQuery(q ast.Body) ast.Visitor {
 }
 
 func (p *astProcessor) translateExpr(node *ast.Expr) ast.Visitor {
+	if term, ok := node.Terms.(*ast.Term); ok {
+		// Iteration of an entity without any condition, e.g. data.foo
+		if ref, isRef := term.Value.(ast.Ref); isRef && len(ref) == 2 {
+			p.useEntity(p.toEntity(normalizeString(ref[1].Value.String())))
+			return nil
+		}
+		return p
+	}
 	if !node.IsCall() {
 		return p
 	}
@@ -134,10 +164,14 @@ func (p *astProcessor) translateExpr(node *ast.Expr) ast.Visitor {
 		logging.LogForComponent("astProcessor").Debugf("%30sLink: %+v", "", p.link)
 	}
 	// Append new relation for conjunction
-	p.relations = append(p.relations, data.Call{
+	var relation data.Node = data.Call{
 		Operator: op,
 		Operands: functionOperands,
-	})
+	}
+	if node.Negated {
+		relation = data.Negation{Clause: relation}
+	}
+	p.relations = append(p.relations, relation)
 	logging.LogForComponent("astProcessor").Debugf("%30sRelations: %+v", "", p.relations)
 
 	// Cleanup
@@ -147,20 +181,14 @@ func (p *astProcessor) translateExpr(node *ast.Expr) ast.Visitor {
 
 func (p *astProcessor) translateTerm(node *ast.Term) ast.Visitor {
 	switch v := node.Value.(type) {
-	case ast.Boolean:
-		util.AppendToTopChecked("astProcessor", &p.operands, makeConstant(v.String()))
-		return nil
-	case ast.String:
-		util.AppendToTopChecked("astProcessor", &p.operands, makeConstant(v.String()))
-		return nil
-	case ast.Number:
-		util.AppendToTopChecked("astProcessor", &p.operands, makeConstant(v.String()))
+	case ast.Boolean, ast.String, ast.Number, ast.Null:
+		util.AppendToTopChecked("astProcessor", &p.operands, makeConstant(v))
 		return nil
 	case ast.Ref:
 		if len(v) == 3 {
-			entity := data.Entity{Value: normalizeString(v[1].Value.String())}
-			p.entities[entity.Value] = nil
-			if p.fromEntity == nil {
+			entity := p.toEntity(normalizeString(v[1].Value.String()))
+			p.entities[entity.Name()] = nil
+			if p.fromEntity == nil && !p.outer[entity.Name()] {
 				p.fromEntity = &entity
 			}
 			attribute := data.Attribute{Entity: entity, Name: normalizeString(v[2].Value.String())}
@@ -169,6 +197,15 @@ func (p *astProcessor) translateTerm(node *ast.Term) ast.Visitor {
 		return nil
 	case ast.Call:
 		op := data.Operator{Value: v[0].String()}
+		if data.IsAggregateFunction(op.Value) && len(v) == 2 && ast.IsComprehension(v[1].Value) {
+			aggregate, err := p.translateAggregate(op, v[1])
+			if err != nil {
+				p.errors = append(p.errors, err.Error())
+				return nil
+			}
+			util.AppendToTopChecked("astProcessor", &p.operands, data.Node(aggregate))
+			return nil
+		}
 		p.operands.Push([]data.Node{})
 		for _, term := range v[1:] {
 			ast.Walk(p, term)
@@ -183,6 +220,14 @@ func (p *astProcessor) translateTerm(node *ast.Term) ast.Visitor {
 			Operands: functionOperands,
 		}))
 		return nil
+	case ast.Set, *ast.Array, ast.Object:
+		collection, err := makeCollection(v)
+		if err != nil {
+			p.errors = append(p.errors, err.Error())
+			return nil
+		}
+		util.AppendToTopChecked("astProcessor", &p.operands, data.Node(collection))
+		return nil
 	default:
 		if p.skipUnknown || p.validateMode {
 			logging.LogForComponent("astProcessor").Warnf("Unexpected term Node: %T -> %+v", v, v)
@@ -195,37 +240,162 @@ func (p *astProcessor) translateTerm(node *ast.Term) ast.Visitor {
 	return p
 }
 
-func makeConstant(value string) data.Node {
-	// Convert "<Const>" to <Const>
-	value = trimLeadingAndTrailing(value, '"')
+// useEntity registers an entity which is iterated without referencing any of its attributes.
+func (p *astProcessor) useEntity(entity data.Entity) {
+	if p.outer[entity.Name()] {
+		return
+	}
+	if p.fromEntity == nil {
+		p.fromEntity = &entity
+		return
+	}
+	p.link[entity.Name()] = true
+}
+
+// translateAggregate translates the aggregation of a comprehension into an aggregate over the query of the comprehension's body.
+// The body is translated by a separate processor, for which all entities of the enclosing query are outer entities.
+func (p *astProcessor) translateAggregate(op data.Operator, comprehension *ast.Term) (data.Aggregate, error) {
+	var (
+		head  *ast.Term
+		body  ast.Body
+		isSet bool
+	)
+	switch c := comprehension.Value.(type) {
+	case *ast.ArrayComprehension:
+		head, body = c.Term, c.Body
+	case *ast.SetComprehension:
+		head, body, isSet = c.Term, c.Body, true
+	}
+
+	nested := newAstProcessor(p.skipUnknown, p.validateMode)
+	nested.aliases = p.aliases
+	nested.outer = make(map[string]bool)
+	nested.link = make(map[string]interface{})
+	nested.conjunctions = []data.Node{}
+	nested.entities = make(map[string]interface{})
+	nested.relations = []data.Node{}
+	nested.operands = util.Stack[[]data.Node]{}
+	nested.scope = outerEntities(body)
+	for entity := range p.outer {
+		nested.outer[entity] = true
+	}
+	for entity := range p.scope {
+		nested.outer[entity] = true
+	}
+	nested.translateQuery(body)
+	if len(nested.errors) > 0 {
+		return data.Aggregate{}, errors.Errorf("Unable to translate comprehension %s: %s", comprehension, strings.Join(nested.errors, ", "))
+	}
+
+	// The head is either an attribute or the row of an iterated entity
+	var value data.Node
+	ref, ok := head.Value.(ast.Ref)
+	switch {
+	case ok && len(ref) == 3:
+		nested.operands.Push([]data.Node{})
+		ast.Walk(nested, head)
+		values, _ := nested.operands.Pop()
+		value = values[0]
+	case ok && len(ref) == 2:
+		nested.useEntity(nested.toEntity(normalizeString(ref[1].Value.String())))
+		if op.Value != "count" {
+			return data.Aggregate{}, errors.Errorf("Unable to translate comprehension %s: %s requires values of an attribute", comprehension, op.Value)
+		}
+	default:
+		return data.Aggregate{}, errors.Errorf("Unable to translate comprehension %s: unsupported head %s", comprehension, head)
+	}
+	if nested.fromEntity == nil {
+		return data.Aggregate{}, errors.Errorf("Unable to translate comprehension %s: no entity is iterated", comprehension)
+	}
+
+	// Rows are counted, unless distinct values have to be counted
+	if op.Value == "count" && !isSet {
+		value = nil
+	}
+
+	delete(nested.link, nested.fromEntity.Name())
+	for entity := range nested.outer {
+		delete(nested.link, entity)
+	}
+	return data.Aggregate{
+		Function: op,
+		Value:    value,
+		Distinct: isSet && value != nil,
+		Query: data.Query{
+			From:      *nested.fromEntity,
+			Link:      nested.toDataLink(nested.link),
+			Condition: data.Condition{Clause: data.Conjunction{Clauses: nested.conjunctions}},
+		},
+	}, nil
+}
+
+// outerEntities returns the names of all entities which are referenced by the query outside of comprehensions.
+func outerEntities(query ast.Body) map[string]bool {
+	result := make(map[string]bool)
+	ast.NewGenericVisitor(func(x interface{}) bool {
+		switch v := x.(type) {
+		case *ast.ArrayComprehension, *ast.SetComprehension, *ast.ObjectComprehension:
+			return true
+		case ast.Ref:
+			if len(v) > 1 && v[0].Equal(ast.DefaultRootDocument) {
+				result[normalizeString(v[1].Value.String())] = true
+			}
+		}
+		return false
+	}).Walk(query)
+	return result
+}
 
-	// Const is int
-	if num, err := strconv.Atoi(value); err == nil {
-		return &data.Constant{
-			Value:     fmt.Sprintf("%d", num),
-			IsNumeric: true,
-			IsInt:     true,
-			IsFloat32: false,
+// makeConstant converts a scalar value into a constant which keeps the value's type.
+func makeConstant(value ast.Value) data.Node {
+	switch v := value.(type) {
+	case ast.String:
+		return &data.Constant{Value: string(v)}
+	case ast.Boolean:
+		return &data.Constant{Value: bool(v)}
+	case ast.Number:
+		if num, ok := v.Int64(); ok {
+			return &data.Constant{Value: num}
+		}
+		// Integers exceeding int64 (e.g. large numeric IDs) would lose their precision as float64 -> keep their exact representation
+		if _, isInt := new(big.Int).SetString(string(v), 10); isInt {
+			return &data.Constant{Value: json.Number(v)}
 		}
+		if num, ok := v.Float64(); ok {
+			return &data.Constant{Value: num}
+		}
+		// Number exceeds the range of float64 -> keep its exact representation
+		return &data.Constant{Value: json.Number(v)}
+	default:
+		return &data.Constant{Value: nil}
 	}
+}
 
-	// Const is float
-	if num, err := strconv.ParseFloat(value, 32); err == nil {
-		return &data.Constant{
-			Value:     fmt.Sprintf("%f", num),
-			IsNumeric: true,
-			IsInt:     false,
-			IsFloat32: true,
+// makeCollection converts the elements of a set or an array (or the values of an object) into a collection of constants.
+func makeCollection(value ast.Value) (data.Collection, error) {
+	var (
+		collection data.Collection
+		err        error
+	)
+	appendConstant := func(term *ast.Term) {
+		switch term.Value.(type) {
+		case ast.Boolean, ast.String, ast.Number:
+			constant, _ := makeConstant(term.Value).(*data.Constant)
+			collection.Values = append(collection.Values, *constant)
+		default:
+			err = errors.Errorf("Unsupported element in collection %s: %T -> %+v", value, term.Value, term.Value)
 		}
 	}
 
-	// Const is string
-	return &data.Constant{
-		Value:     value,
-		IsNumeric: false,
-		IsInt:     false,
-		IsFloat32: false,
+	switch v := value.(type) {
+	case ast.Set:
+		v.Foreach(appendConstant)
+	case *ast.Array:
+		v.Foreach(appendConstant)
+	case ast.Object:
+		v.Foreach(func(_, term *ast.Term) { appendConstant(term) })
 	}
+	return collection, err
 }
 
 func normalizeString(value string) string {
@@ -244,6 +414,7 @@ func trimLeadingAndTrailing(s string, r rune) string {
 	return s
 }
 
+// keys returns the sorted keys of the map, so that the order of linked entities is stable.
 func keys(input map[string]interface{}) []string {
 	i := 0
 	result := make([]string, len(input))
@@ -251,5 +422,6 @@ func keys(input map[string]interface{}) []string {
 		result[i] = k
 		i++
 	}
+	sort.Strings(result)
 	return result
 }
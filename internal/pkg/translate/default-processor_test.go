@@ -0,0 +1,153 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/pkg/data"
+)
+
+// processPolicy partially evaluates the allow rule of the policy like kelon does and returns the processed queries.
+func processPolicy(t *testing.T, policy string, input map[string]interface{}) ([]data.Node, error) {
+	t.Helper()
+	partial, err := rego.New(
+		rego.Query("data.apps.allow == true"),
+		rego.Module("policy.rego", policy),
+		rego.Unknowns([]string{"data.pg"}),
+		rego.Input(input),
+	).Partial(context.Background())
+	require.NoError(t, err)
+
+	preprocessed, err := newAstPreprocessor().Process(context.Background(), partial.Queries, partial.Support, []string{"pg"})
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]data.Node, len(preprocessed))
+	for i, q := range preprocessed {
+		if queries[i], err = newAstProcessor(false, false).Process(context.Background(), q.query, q.aliases); err != nil {
+			return nil, err
+		}
+	}
+	return queries, nil
+}
+
+func Test_astProcessor_NegatedExpression(t *testing.T) {
+	queries, err := processPolicy(t, `package apps
+		allow {
+			data.pg.users[u].name == input.user
+			not data.pg.users[u].role == "BANNED"
+		}`, map[string]interface{}{"user": "arnold"})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "query(users, link([]), cond(conj([eq([arnold att(users.name)]) not(eq([att(users.role) BANNED]))])))", queries[0].String())
+}
+
+func Test_astProcessor_NegatedSupportRule(t *testing.T) {
+	queries, err := processPolicy(t, `package apps
+		allow {
+			data.pg.users[u].name == input.user
+			not banned
+		}
+
+		banned {
+			data.pg.users[b].role == "BANNED"
+			data.pg.users[b].name == input.user
+		}
+
+		banned {
+			data.pg.users[b].role == "DELETED"
+		}`, map[string]interface{}{"user": "arnold"})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+
+	// Each body of the negated rule is translated into a subquery, whose iterator is aliased like any further iterator
+	assert.Equal(t, "query(users, link([]), cond(conj(["+
+		"eq([arnold att(users.name)]) "+
+		"not(gt([agg(count(*), query(users AS users_b3, link([]), cond(conj([eq([att(users AS users_b3.role) BANNED]) eq([arnold att(users AS users_b3.name)])])))) 0])) "+
+		"not(gt([agg(count(*), query(users AS users_b4, link([]), cond(conj([eq([att(users AS users_b4.role) DELETED])])))) 0]))"+
+		"])))", queries[0].String())
+}
+
+func Test_astProcessor_NegatedSupportRuleWithArguments(t *testing.T) {
+	queries, err := processPolicy(t, `package apps
+		allow {
+			data.pg.users[u].name == input.user
+			not banned(u)
+		}
+
+		banned(user) {
+			data.pg.bans[b].user_id == user.id
+		}`, map[string]interface{}{"user": "arnold"})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+
+	// Arguments are replaced by the iterators of the query, so that the subquery is correlated with it
+	assert.Equal(t, "query(users, link([]), cond(conj(["+
+		"eq([arnold att(users.name)]) "+
+		"not(gt([agg(count(*), query(bans, link([]), cond(conj([eq([att(bans.user_id) att(users.id)])])))) 0]))"+
+		"])))", queries[0].String())
+}
+
+func Test_astProcessor_NegatedDefaultSupportRule(t *testing.T) {
+	queries, err := processPolicy(t, `package apps
+		allow {
+			data.pg.users[u].name == input.user
+			not banned
+		}
+
+		default banned = false
+
+		banned {
+			data.pg.bans[b].user_name == input.user
+		}`, map[string]interface{}{"user": "arnold"})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "query(users, link([]), cond(conj(["+
+		"eq([arnold att(users.name)]) "+
+		"not(gt([agg(count(*), query(bans, link([]), cond(conj([eq([arnold att(bans.user_name)])])))) 0]))"+
+		"])))", queries[0].String())
+}
+
+func Test_astProcessor_SupportRuleWithValue(t *testing.T) {
+	// Support rules are only translated inside negations
+	_, err := processPolicy(t, `package apps
+		allow {
+			data.pg.users[u].name == input.user
+			data.pg.users[u].age > min_age
+		}
+
+		default min_age = 0
+
+		min_age = 18 {
+			data.pg.settings[s].name == "adults-only"
+		}`, map[string]interface{}{"user": "arnold"})
+	assert.ErrorContains(t, err, "support rule [data.partial.apps.min_age] of the partial evaluation is only supported inside negations")
+}
+
+func Test_astProcessor_ConstantTypes(t *testing.T) {
+	queries, err := processPolicy(t, `package apps
+		allow {
+			input.path = ["users", code]
+			data.pg.users[u].code == code
+			data.pg.users[u].active == true
+			data.pg.users[u].id == 123456789012345678901234567890
+			data.pg.users[u].age == 42
+			data.pg.users[u].score == 1.5
+		}`, map[string]interface{}{"path": []interface{}{"users", "007"}})
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+
+	// Each constant keeps the type of its OPA value
+	var values []interface{}
+	require.NoError(t, queries[0].Walk(func(node data.Node) error {
+		if constant, ok := node.(data.Constant); ok {
+			values = append(values, constant.Value)
+		}
+		return nil
+	}))
+	assert.Equal(t, []interface{}{"007", true, json.Number("123456789012345678901234567890"), int64(42), 1.5}, values)
+}
@@ -15,6 +15,12 @@ import (
 
 const spanNameDatastoreQuery string = "datastore.query"
 
+// datastoreResult is the result of the query of a single datastore.
+type datastoreResult struct {
+	allowed bool
+	err     error
+}
+
 type astTranslator struct {
 	appConf    *configs.AppConfig
 	config     *translate.AstTranslatorConfig
@@ -64,16 +70,119 @@ func (trans *astTranslator) Process(ctx context.Context, response *rego.PartialQ
 		return false, errors.Errorf("AstTranslator was not configured! Please call Configure(). ")
 	}
 
-	preprocessedQueries, preprocessErr := newAstPreprocessor().Process(ctx, response.Queries, datastores)
+	datastoreSpecificQueries, err := trans.processQueries(ctx, response, datastores)
+	if err != nil {
+		return false, err
+	}
+
+	// Resolve all datastores before any query is executed
+	targets := make(map[string]*data.Datastore, len(datastoreSpecificQueries))
+	for datastore := range datastoreSpecificQueries {
+		targetDB, ok := trans.config.Datastores[datastore]
+		if !ok {
+			return false, errors.Errorf("AstTranslator: Unable to find datastore: %s", datastore)
+		}
+		targets[datastore] = targetDB
+	}
+
+	// Execute the queries of all datastores concurrently. The first datastore which allows the request cancels all others.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan datastoreResult, len(datastoreSpecificQueries))
+	for datastore, specificQuery := range datastoreSpecificQueries {
+		go func(datastore string, query data.Node) {
+			allowed, err := trans.execute(ctx, datastore, targets[datastore], query)
+			results <- datastoreResult{allowed: allowed, err: err}
+		}(datastore, specificQuery)
+	}
+
+	// Wait for all datastores, so that no query outlives the request. Errors of canceled datastores are irrelevant once the request is allowed.
+	var (
+		allowed  bool
+		firstErr error
+	)
+	for range datastoreSpecificQueries {
+		result := <-results
+		switch {
+		case result.allowed && !allowed:
+			allowed = true
+			cancel()
+		case result.err != nil && firstErr == nil:
+			firstErr = result.err
+		}
+	}
+	if allowed {
+		return true, nil
+	}
+	return false, firstErr
+}
+
+// execute executes the query on the datastore inside its own span.
+func (trans *astTranslator) execute(ctx context.Context, datastore string, targetDB *data.Datastore, query data.Node) (bool, error) {
+	pkg := ctx.Value(constants.ContextKeyRegoPackage).(string)
+
+	labels := map[string]string{
+		constants.LabelRegoPackage: pkg,
+		constants.LabelDBPoolName:  datastore,
+	}
+
+	function := func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		startTime := time.Now()
+		decision, err := (*targetDB).Execute(ctx, query)
+		duration := time.Since(startTime)
+
+		// Update Metrics
+		trans.appConf.MetricsProvider.UpdateHistogramMetric(ctx, constants.InstrumentDecisionDuration, duration.Milliseconds(), labels)
+		return decision, err
+	}
+
+	res, err := trans.appConf.TraceProvider.ExecuteWithChildSpan(ctx, function, spanNameDatastoreQuery, labels)
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+// See translate.AstTranslator.
+func (trans *astTranslator) Filter(ctx context.Context, response *rego.PartialQueries, datastores []string) (map[string]data.DatastoreQuery, error) {
+	if !trans.configured {
+		return nil, errors.Errorf("AstTranslator was not configured! Please call Configure(). ")
+	}
+
+	datastoreSpecificQueries, err := trans.processQueries(ctx, response, datastores)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make(map[string]data.DatastoreQuery, len(datastoreSpecificQueries))
+	for datastore, specificQuery := range datastoreSpecificQueries {
+		targetDB, ok := trans.config.Datastores[datastore]
+		if !ok {
+			return nil, errors.Errorf("AstTranslator: Unable to find datastore: %s", datastore)
+		}
+
+		filter, filterErr := (*targetDB).Filter(ctx, specificQuery)
+		if filterErr != nil {
+			return nil, filterErr
+		}
+		filters[datastore] = filter
+	}
+	return filters, nil
+}
+
+// processQueries translates the partial evaluated queries into one data.Union per datastore.
+func (trans *astTranslator) processQueries(ctx context.Context, response *rego.PartialQueries, datastores []string) (map[string]data.Node, error) {
+	preprocessedQueries, preprocessErr := newAstPreprocessor().Process(ctx, response.Queries, response.Support, datastores)
 	if preprocessErr != nil {
-		return false, errors.Wrap(preprocessErr, "AstTranslator: Error during preprocessing.")
+		return nil, errors.Wrap(preprocessErr, "AstTranslator: Error during preprocessing.")
 	}
 
 	datastoreSpecificQueries := make(map[string]data.Node)
 	for _, preprocessed := range preprocessedQueries {
-		processedQuery, processErr := newAstProcessor(trans.config.SkipUnknown, trans.config.ValidateMode).Process(ctx, preprocessed.query)
+		processedQuery, processErr := newAstProcessor(trans.config.SkipUnknown, trans.config.ValidateMode).Process(ctx, preprocessed.query, preprocessed.aliases)
 		if processErr != nil {
-			return false, processErr
+			return nil, processErr
 		}
 
 		node, ok := datastoreSpecificQueries[preprocessed.datastore]
@@ -84,38 +193,5 @@ func (trans *astTranslator) Process(ctx context.Context, response *rego.PartialQ
 
 		datastoreSpecificQueries[preprocessed.datastore] = data.Union{Clauses: append(union.Clauses, processedQuery)}
 	}
-
-	for datastore, specificQuery := range datastoreSpecificQueries {
-		queryToExecute := specificQuery
-		if targetDB, ok := trans.config.Datastores[datastore]; ok {
-			pkg := ctx.Value(constants.ContextKeyRegoPackage).(string)
-
-			labels := map[string]string{
-				constants.LabelRegoPackage: pkg,
-				constants.LabelDBPoolName:  datastore,
-			}
-
-			function := func(ctx context.Context, args ...interface{}) (interface{}, error) {
-				startTime := time.Now()
-				decision, err := (*targetDB).Execute(ctx, queryToExecute)
-				duration := time.Since(startTime)
-
-				// Update Metrics
-				trans.appConf.MetricsProvider.UpdateHistogramMetric(ctx, constants.InstrumentDecisionDuration, duration.Milliseconds(), labels)
-				return decision, err
-			}
-
-			res, err := trans.appConf.TraceProvider.ExecuteWithChildSpan(ctx, function, spanNameDatastoreQuery, labels)
-			if err != nil {
-				return false, err
-			}
-
-			if res.(bool) {
-				return true, nil
-			}
-		} else {
-			return false, errors.Errorf("AstTranslator: Unable to find datastore: %s", datastore)
-		}
-	}
-	return false, nil
+	return datastoreSpecificQueries, nil
 }
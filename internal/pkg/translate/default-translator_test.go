@@ -0,0 +1,95 @@
+package translate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/constants"
+	"github.com/unbasical/kelon/pkg/data"
+	"github.com/unbasical/kelon/pkg/telemetry"
+	"github.com/unbasical/kelon/pkg/translate"
+)
+
+// fakeDatastore returns its result immediately or, if it is slow, blocks until the query is canceled.
+type fakeDatastore struct {
+	allowed  bool
+	err      error
+	slow     bool
+	canceled chan struct{}
+}
+
+func (ds *fakeDatastore) Configure(_ *configs.AppConfig, _ string) error {
+	return nil
+}
+
+func (ds *fakeDatastore) Execute(ctx context.Context, _ data.Node) (bool, error) {
+	if ds.slow {
+		<-ctx.Done()
+		close(ds.canceled)
+		return false, ds.err
+	}
+	return ds.allowed, ds.err
+}
+
+func (ds *fakeDatastore) Filter(_ context.Context, _ data.Node) (data.DatastoreQuery, error) {
+	return data.DatastoreQuery{}, nil
+}
+
+func newTestTranslator(t *testing.T, fast, slow data.Datastore) translate.AstTranslator {
+	appConf := &configs.AppConfig{
+		MetricsProvider: telemetry.NewNoopMetricProvider(),
+		TraceProvider:   telemetry.NewNoopTraceProvider(),
+	}
+	translator := NewAstTranslator()
+	require.NoError(t, translator.Configure(appConf, &translate.AstTranslatorConfig{
+		Datastores: map[string]*data.Datastore{"fast": &fast, "slow": &slow},
+	}))
+	return translator
+}
+
+func processTestQueries(translator translate.AstTranslator) (bool, error) {
+	queries := &rego.PartialQueries{Queries: []ast.Body{
+		ast.MustParseBody(`data.fast.users[u].name = "Arnold"`),
+		ast.MustParseBody(`data.slow.users[u].name = "Kevin"`),
+	}}
+	ctx := context.WithValue(context.Background(), constants.ContextKeyRegoPackage, "applications")
+	return translator.Process(ctx, queries, []string{"fast", "slow"})
+}
+
+func Test_astTranslator_Process_CancelsSlowDatastore(t *testing.T) {
+	slow := &fakeDatastore{slow: true, err: errors.New("canceled"), canceled: make(chan struct{})}
+	translator := newTestTranslator(t, &fakeDatastore{allowed: true}, slow)
+
+	// The error of the canceled datastore is irrelevant, because the request was already allowed
+	allowed, err := processTestQueries(translator)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	select {
+	case <-slow.canceled:
+	default:
+		assert.Fail(t, "Slow datastore was not canceled")
+	}
+}
+
+func Test_astTranslator_Process_ReturnsErrorIfNotAllowed(t *testing.T) {
+	errFailed := errors.New("failed")
+	translator := newTestTranslator(t, &fakeDatastore{err: errFailed}, &fakeDatastore{allowed: false})
+
+	allowed, err := processTestQueries(translator)
+	assert.ErrorIs(t, err, errFailed)
+	assert.False(t, allowed)
+}
+
+func Test_astTranslator_Process_Denied(t *testing.T) {
+	translator := newTestTranslator(t, &fakeDatastore{allowed: false}, &fakeDatastore{allowed: false})
+
+	allowed, err := processTestQueries(translator)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
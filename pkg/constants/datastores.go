@@ -14,3 +14,6 @@ const MetaTelemetryName string = "telemetryName"
 
 // MetaKey for telemetryType
 const MetaTelemetryType string = "telemetryType"
+
+// MetaKey for queryShape
+const MetaQueryShape string = "queryShape"
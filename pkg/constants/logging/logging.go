@@ -23,6 +23,9 @@ const LabelDecision string = "decision"
 // Label for decision reason
 const LabelReason string = "reason"
 
+// Label for the rule which denied the decision
+const LabelRule string = "rule"
+
 // Label for translation error
 const LabelError string = "error"
 
@@ -10,10 +10,15 @@ const Input = "input"
 
 const HeaderXForwardedMethod = "X-Forwarded-Method"
 const HeaderXForwardedURI = "X-Forwarded-URI"
+const HeaderXForwardedHost = "X-Forwarded-Host"
+const HeaderXOriginalMethod = "X-Original-Method"
+const HeaderXOriginalURI = "X-Original-URI"
 const HeaderAuthorization = "Authorization"
 
 const EndpointSuffixData = "/data"
 const EndpointSuffixPolicies = "/policies"
+const EndpointSuffixFilter = "/filter"
+const EndpointSuffixForwardAuth = "/forward-auth"
 
 const EndpointHealth = "/health"
 const EndpointMetrics = "/metrics"
@@ -11,6 +11,7 @@ const (
 	InstrumentRPCRequestSize
 	InstrumentDecisionDuration
 	InstrumentDBQueryDuration
+	InstrumentDecisionCache
 )
 
 func (i MetricInstrument) String() string {
@@ -31,6 +32,8 @@ func (i MetricInstrument) String() string {
 		return "decision.duration"
 	case InstrumentDBQueryDuration:
 		return "db.query.duration"
+	case InstrumentDecisionCache:
+		return "decision.cache"
 	default:
 		return "unknown"
 	}
@@ -51,3 +54,5 @@ const LabelPolicyDecision string = "decision"
 const LabelPolicyDecisionReason string = "reason"
 
 const LabelRegoPackage string = "rego.package"
+
+const LabelDecisionCacheResult string = "cache.result"
@@ -1,6 +1,9 @@
 package data
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // Node is the abstract interface that every Node of the Query-AST implements.
 type Node interface {
@@ -25,8 +28,16 @@ type Query struct {
 }
 
 // Link between a parent entity and a list of entities with corresponding conditions.
+// Joins are applied in order before all other entities are linked.
 type Link struct {
 	Entities []Entity
+	Joins    []Join
+}
+
+// Join of an entity on the conjunction of conditions, which relate the entity to previously linked entities.
+type Join struct {
+	Entity Entity
+	On     []Node
 }
 
 // A single root condition.
@@ -44,21 +55,48 @@ type Disjunction struct {
 	Clauses []Node
 }
 
+// Negation of a single clause.
+type Negation struct {
+	Clause Node
+}
+
 // Call represented by an operand and a list of arguments.
 type Call struct {
 	Operator Operator
 	Operands []Node
 }
 
+// Aggregate of all rows of a query, which is evaluated for each row of the enclosing query (correlated subquery).
+// Attributes of entities, which are not iterated by the query, reference the rows of the enclosing query.
+// The Function (see IsAggregateFunction) is applied to the Value of each row, or to the rows themselves if the Value is nil.
+// If Distinct is set, each value is only aggregated once.
+type Aggregate struct {
+	Function Operator
+	Value    Node
+	Distinct bool
+	Query    Query
+}
+
+// IsAggregateFunction checks if the builtin is translated into an aggregate if it is applied to a comprehension.
+func IsAggregateFunction(name string) bool {
+	switch name {
+	case "count", "sum", "max", "min":
+		return true
+	default:
+		return false
+	}
+}
+
 // Attribute of an entity.
 type Attribute struct {
 	Entity Entity
 	Name   string
 }
 
-// An Entity
+// An Entity. If the same entity is iterated several times inside a query, each further iteration carries an Alias.
 type Entity struct {
 	Value string
+	Alias string
 }
 
 // An Operator of the AST.
@@ -66,12 +104,15 @@ type Operator struct {
 	Value string
 }
 
-// A simple Constant.
+// A simple Constant. Its Value keeps the type of the original value and is therefore one of string, int64, float64, bool or nil (null).
+// Numbers which can not be represented exactly by int64 or float64 (e.g. integers exceeding int64) are kept as json.Number.
 type Constant struct {
-	Value     string
-	IsNumeric bool
-	IsInt     bool
-	IsFloat32 bool
+	Value interface{}
+}
+
+// A Collection of constants, i.e. the elements of a set or an array or the values of an object.
+type Collection struct {
+	Values []Constant
 }
 
 // Interface implementations
@@ -86,9 +127,27 @@ func (o Operator) Walk(vis func(v Node) error) error {
 	return vis(o)
 }
 
+// IsNumeric returns true if the constant is an integer or a floating point number.
+func (c Constant) IsNumeric() bool {
+	switch c.Value.(type) {
+	case int64, float64, json.Number:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsNull returns true if the constant is null.
+func (c Constant) IsNull() bool {
+	return c.Value == nil
+}
+
 // Implements data.Node
 func (c Constant) String() string {
-	return c.Value
+	if c.IsNull() {
+		return "null"
+	}
+	return fmt.Sprint(c.Value)
 }
 
 // Implements data.Node
@@ -96,8 +155,54 @@ func (c Constant) Walk(vis func(v Node) error) error {
 	return vis(c)
 }
 
+// Implements data.Node
+func (c Collection) String() string {
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		values[i] = v.String()
+	}
+	return fmt.Sprintf("coll(%+v)", values)
+}
+
+// Implements data.Node
+//
+// The contained constants are not visited separately, because a collection is always translated as a whole.
+func (c Collection) Walk(vis func(v Node) error) error {
+	return vis(c)
+}
+
+// Implements data.Node
+func (a Aggregate) String() string {
+	value := "*"
+	if a.Value != nil {
+		value = a.Value.String()
+	}
+	if a.Distinct {
+		value = "distinct " + value
+	}
+	return fmt.Sprintf("agg(%s(%s), %s)", a.Function.String(), value, a.Query.String())
+}
+
+// Implements data.Node
+//
+// The query is not visited, because it is evaluated independently of the enclosing query and therefore translated as a whole.
+func (a Aggregate) Walk(vis func(v Node) error) error {
+	return vis(a)
+}
+
+// Name returns the name under which the entity is referenced inside a query, which is its Alias (if set) or its Value.
+func (e Entity) Name() string {
+	if e.Alias != "" {
+		return e.Alias
+	}
+	return e.Value
+}
+
 // Implements data.Node
 func (e Entity) String() string {
+	if e.Alias != "" {
+		return fmt.Sprintf("%s AS %s", e.Value, e.Alias)
+	}
 	return e.Value
 }
 
@@ -180,6 +285,19 @@ func (d Disjunction) Walk(vis func(v Node) error) error {
 	return vis(d)
 }
 
+// Implements data.Node
+func (n Negation) String() string {
+	return fmt.Sprintf("not(%s)", n.Clause)
+}
+
+// Implements data.Node
+func (n Negation) Walk(vis func(v Node) error) error {
+	if err := n.Clause.Walk(vis); err != nil {
+		return err
+	}
+	return vis(n)
+}
+
 // Implements data.Node
 func (c Condition) String() string {
 	return fmt.Sprintf("cond(%s)", c.Clause)
@@ -195,15 +313,23 @@ func (c Condition) Walk(vis func(v Node) error) error {
 
 // Implements data.Node
 func (l Link) String() string {
-	links := make([]string, len(l.Entities))
-	for i, e := range l.Entities {
-		links[i] = fmt.Sprintf("%s, ", e)
+	links := make([]string, 0, len(l.Joins)+len(l.Entities))
+	for _, j := range l.Joins {
+		links = append(links, fmt.Sprintf("%s, ", j))
+	}
+	for _, e := range l.Entities {
+		links = append(links, fmt.Sprintf("%s, ", e))
 	}
 	return fmt.Sprintf("link(%+v)", links)
 }
 
 // Implements data.Node
 func (l Link) Walk(vis func(v Node) error) error {
+	for _, j := range l.Joins {
+		if err := j.Walk(vis); err != nil {
+			return err
+		}
+	}
 	for _, e := range l.Entities {
 		if err := e.Walk(vis); err != nil {
 			return err
@@ -212,6 +338,24 @@ func (l Link) Walk(vis func(v Node) error) error {
 	return vis(l)
 }
 
+// Implements data.Node
+func (j Join) String() string {
+	return fmt.Sprintf("join(%s, %+v)", j.Entity.String(), j.On)
+}
+
+// Implements data.Node
+func (j Join) Walk(vis func(v Node) error) error {
+	if err := j.Entity.Walk(vis); err != nil {
+		return err
+	}
+	for _, c := range j.On {
+		if err := c.Walk(vis); err != nil {
+			return err
+		}
+	}
+	return vis(j)
+}
+
 // Implements data.Node
 func (q Query) String() string {
 	return fmt.Sprintf("query(%s, %+v, %s)", q.From.String(), q.Link, q.Condition.String())
@@ -15,6 +15,8 @@ const (
 	TypePostgres = "postgres"
 	TypeMysql    = "mysql"
 	TypeMongo    = "mongo"
+	TypeSqlite   = "sqlite"
+	TypeMemory   = "memory"
 )
 
 type DatastoreQuery struct {
@@ -30,6 +32,9 @@ type Datastore interface {
 
 	// Execute() translates the given Query-AST into a datastore's native query and executes the query afterwards via the passed data.DatastoreExecutor.
 	Execute(ctx context.Context, query Node) (bool, error)
+
+	// Filter() translates the given Query-AST into a datastore's native filter condition without executing it.
+	Filter(ctx context.Context, query Node) (DatastoreQuery, error)
 }
 
 // DatastoreTranslator is the interface that maps a generic designed AST returned by translate.AstTranslator to a native query-statement which is understood by a matching data.DatastoreExecutor.
@@ -41,6 +46,12 @@ type DatastoreTranslator interface {
 
 	// Execute() translates the given Query-AST into a datastore's native query
 	Execute(ctx context.Context, query Node) (DatastoreQuery, error)
+
+	// Filter() translates the given Query-AST into a datastore's native filter condition (i.e. a WHERE-clause or a filter document)
+	// which can be appended by a caller to its own queries to only fetch entities which fulfill the policy.
+	// Numbered placeholders of the condition (i.e. $1 for PostgreSQL) always start at 1, therefore callers which append the condition
+	// to a query with own parameters have to renumber them.
+	Filter(ctx context.Context, query Node) (DatastoreQuery, error)
 }
 
 // DatastoreExecutor is the interface that executes a native datastore query and returns the final decision (Allow/Deny) based on the query response.
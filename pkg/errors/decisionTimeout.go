@@ -0,0 +1,14 @@
+package errors
+
+import "fmt"
+
+// Error thrown if a decision exceeded its configured deadline
+type DecisionTimeout struct {
+	Cause error
+	// Deny is true if the request should be denied (fail-closed) instead of being answered as unavailable
+	Deny bool
+}
+
+func (err DecisionTimeout) Error() string {
+	return fmt.Sprintf("PolicyCompiler: Decision exceeded its deadline: %s", err.Cause.Error())
+}
@@ -6,9 +6,12 @@ package opa
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/open-policy-agent/opa/plugins"
 	"github.com/unbasical/kelon/configs"
+	"github.com/unbasical/kelon/pkg/data"
 	"github.com/unbasical/kelon/pkg/request"
 	"github.com/unbasical/kelon/pkg/translate"
 	"github.com/unbasical/kelon/pkg/watcher"
@@ -29,14 +32,54 @@ type PolicyCompilerConfig struct {
 	translate.AstTranslatorConfig
 	request.PathProcessorConfig
 	AccessDecisionLogLevel string
+	// Maximum number of decisions which are cached per package (caching is disabled if not positive)
+	DecisionCacheSize int
+	// Duration after which cached decisions expire (never if not positive)
+	DecisionCacheTTL time.Duration
+	// Refuse to load policies which reference unknown entities or use builtins without call-operand mapping on datastores
+	StrictPolicyCheck bool
 }
 
+// Decision is the result of a request.
+//
+// If the request is denied, Rule contains the name of the rule which was not fulfilled and StatusCode the status which was configured for it.
+// If the request is allowed, Headers and Response contain the values of the package's rules 'headers' and 'response' (if defined).
 type Decision struct {
-	Verify  bool
-	Allow   bool
-	Package string
-	Path    string
-	Method  string
+	Verify     bool
+	Allow      bool
+	Rule       string
+	StatusCode int
+	Headers    map[string]string
+	Response   interface{}
+	Package    string
+	Path       string
+	Method     string
+}
+
+// DenyStatus returns the HTTP status code a denied request should be answered with.
+// If no status code was set, 401 is returned for unverified requests and 403 otherwise.
+func (d *Decision) DenyStatus() int {
+	return denyStatus(d.StatusCode, d.Verify)
+}
+
+// FilterDecision is the result of a filter request. Instead of a final decision it contains the residual conditions
+// (per datastore) an entity has to fulfill to be accessible.
+//
+// If Allow is true and Filters is empty, the access is granted unconditionally.
+type FilterDecision struct {
+	Verify     bool
+	Allow      bool
+	Rule       string
+	StatusCode int
+	Filters    map[string]data.DatastoreQuery
+	Package    string
+	Path       string
+	Method     string
+}
+
+// DenyStatus returns the HTTP status code a denied request should be answered with (see Decision.DenyStatus()).
+func (d *FilterDecision) DenyStatus() int {
+	return denyStatus(d.StatusCode, d.Verify)
 }
 
 // PolicyCompiler is the interface that makes final decisions on incoming requests.
@@ -55,8 +98,42 @@ type PolicyCompiler interface {
 	// If any sub-component or the PolicyCompiler itself fails during this process, the encountered error will be returned (otherwise nil).
 	Configure(appConfig *configs.AppConfig, compConfig *PolicyCompilerConfig) error
 
+	// Reconfigure() configures the sub-components of the passed PolicyCompilerConfig (i.e. after a configuration reload) and replaces the currently used ones afterwards.
+	// Requests which are processed during the replacement are finished with the previous sub-components. Reconfigure() returns as soon as all of these requests are done.
+	// Please note that the PolicyCompiler itself (i.e. OPA) is not reconfigured, but all cached decisions are flushed!
+	//
+	// If any sub-component fails during this process, the previous sub-components stay in use and the encountered error will be returned (otherwise nil).
+	Reconfigure(appConfig *configs.AppConfig, compConfig *PolicyCompilerConfig) error
+
 	// Get the underlying open policy agent which is running inside the PolicyCompiler.
 	GetEngine() *plugins.Manager
 
 	Execute(ctx context.Context, request map[string]interface{}) (*Decision, error)
+
+	// Filter() processes the request like Execute(), but instead of executing the translated datastore queries of the
+	// authorization, their datastore-native conditions are returned. These can be used by the caller to only fetch accessible entities.
+	Filter(ctx context.Context, request map[string]interface{}) (*FilterDecision, error)
+}
+
+func denyStatus(statusCode int, verify bool) int {
+	switch {
+	case statusCode != 0:
+		return statusCode
+	case !verify:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusForbidden
+	}
+}
+
+// DenyReason returns the reason which is logged for a request that was denied with the passed HTTP status code.
+func DenyReason(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return "Unauthenticated"
+	case http.StatusForbidden:
+		return "Unauthorized"
+	default:
+		return http.StatusText(statusCode)
+	}
 }
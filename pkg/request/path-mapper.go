@@ -39,12 +39,32 @@ type PathNotFoundError struct {
 
 // Output returned by the RequestMapper.
 type MapperOutput struct {
-	Datastores     []string
-	Package        string
-	Authorization  bool
+	Datastores []string
+	Package    string
+	// Rules of the package which have to be evaluated in the given order
+	Rules []*configs.PolicyRule
+	// Deadline of the decision (optional)
+	Deadline *configs.Deadline
+
+	// Deprecated: Use Rules instead. Only evaluated if Rules is empty.
+	Authorization bool
+	// Deprecated: Use Rules instead. Only evaluated if Rules is empty.
 	Authentication bool
 }
 
+// EffectiveRules returns the Rules of the output or, if there are none, the rules derived from the flags Authentication and Authorization.
+func (o *MapperOutput) EffectiveRules() []*configs.PolicyRule {
+	return effectiveRules(o.Rules, o.Authentication, o.Authorization)
+}
+
+func effectiveRules(rules []*configs.PolicyRule, authentication, authorization bool) []*configs.PolicyRule {
+	if len(rules) > 0 {
+		return rules
+	}
+	mapping := configs.DatastoreAPIMapping{Authentication: &authentication, Authorization: &authorization}
+	return mapping.EffectiveRules(&configs.APIMapping{})
+}
+
 // Textual representation of a PathAmbiguousError.
 func (e PathAmbiguousError) Error() string {
 	return fmt.Sprintf("Path-mapping [%s] is ambiguous! Mapping [%s] also matches incoming path [%s]!", e.RequestURL, e.FirstMatch, e.OtherMatch)
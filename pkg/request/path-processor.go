@@ -19,12 +19,24 @@ type PathProcessorConfig struct {
 // Extracted Query-Parameters mapped to their values can i.e. be attached to the input-field of the OPA-query.
 // A slice containing all separated path parts is also returned.
 type PathProcessorOutput struct {
-	Datastores     []string
-	Package        string
-	Authorization  bool
+	Datastores []string
+	Package    string
+	// Rules of the package which have to be evaluated in the given order
+	Rules []*configs.PolicyRule
+	// Deadline of the decision (optional)
+	Deadline *configs.Deadline
+	Path     []string
+	Queries  map[string]interface{}
+
+	// Deprecated: Use Rules instead. Only evaluated if Rules is empty.
+	Authorization bool
+	// Deprecated: Use Rules instead. Only evaluated if Rules is empty.
 	Authentication bool
-	Path           []string
-	Queries        map[string]interface{}
+}
+
+// EffectiveRules returns the Rules of the output or, if there are none, the rules derived from the flags Authentication and Authorization.
+func (o *PathProcessorOutput) EffectiveRules() []*configs.PolicyRule {
+	return effectiveRules(o.Rules, o.Authentication, o.Authorization)
 }
 
 // PathProcessor is the interface that processes an incoming path by parsing and afterwards mapping it to a Datastore and a Package.
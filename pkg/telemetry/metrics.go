@@ -317,6 +317,15 @@ func (m *metrics) initCustomMetrics() error {
 	}
 	m.instruments[constants.InstrumentDBQueryDuration] = dbQueryDuration
 
+	decisionCache, err := meter.Int64Counter(
+		constants.InstrumentDecisionCache.String(),
+		metric.WithDescription("A counter of decision cache lookups by result (hit or miss)."),
+	)
+	if err != nil {
+		return err
+	}
+	m.instruments[constants.InstrumentDecisionCache] = decisionCache
+
 	return nil
 }
 
@@ -41,4 +41,10 @@ type AstTranslator interface {
 	//
 	// If any error occurred during the translation or the datastore access, the error will be returned.
 	Process(ctx context.Context, response *rego.PartialQueries, datastores []string) (bool, error)
+
+	// Filter() translates a list of partial evaluated OPA-queries the same way Process() does, but instead of executing the datastore-native
+	// queries, the datastore-native filter conditions are returned per datastore (datastore-alias -> filter).
+	//
+	// If any error occurred during the translation, the error will be returned.
+	Filter(ctx context.Context, response *rego.PartialQueries, datastores []string) (map[string]data.DatastoreQuery, error)
 }
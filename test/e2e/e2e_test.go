@@ -10,6 +10,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -136,6 +137,9 @@ func (env *E2ETestEnvironment) startKelon() {
 
 	var defaultAccessLogLevel = "ALL"
 	var astSkipUnknown = false
+	var decisionCacheSize = 0
+	var decisionCacheTTL = time.Duration(0)
+	var strictPolicyCheck = false
 
 	config := core.KelonConfiguration{
 		ConfigPath:             &env.configPath,
@@ -145,6 +149,9 @@ func (env *E2ETestEnvironment) startKelon() {
 		PathPrefix:             &env.pathPrefix,
 		AccessDecisionLogLevel: &defaultAccessLogLevel,
 		AstSkipUnknown:         &astSkipUnknown,
+		DecisionCacheSize:      &decisionCacheSize,
+		DecisionCacheTTL:       &decisionCacheTTL,
+		StrictPolicyCheck:      &strictPolicyCheck,
 	}
 
 	kelon := core.Kelon{}
@@ -2,12 +2,14 @@ package integration
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/mock"
@@ -18,6 +20,8 @@ import (
 
 type MockedDatastoreExecuter struct {
 	mock.Mock
+	mutex     sync.Mutex
+	pending   map[string]bool
 	counter   int
 	responses DBTranslatorResponses
 	t         *testing.T
@@ -51,49 +55,74 @@ func NewMockedDatastoreExecuter(t *testing.T, dbQueriesPath, testName string) *M
 	return mocked
 }
 
+// Execute compares the query with the expected queries of the current request. Datastores of a request are queried
+// concurrently, therefore the mock advances to the next request as soon as all expected queries of the current one were executed.
 func (m *MockedDatastoreExecuter) Execute(ctx context.Context, query data.DatastoreQuery) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	currentResponse := m.responses.Queries[strconv.Itoa(m.counter)]
+	if len(m.pending) == 0 {
+		m.pending = make(map[string]bool, len(currentResponse.Query))
+		for key := range currentResponse.Query {
+			m.pending[key] = true
+		}
+	}
 
+	var err error
 	// statement map check for mongo datastores, sql datastores have simple string statement
 	if reflect.ValueOf(query.Statement).Kind() == reflect.Map {
-		convertedStatement := query.Statement.(map[string]string)
+		convertedStatement, convertErr := m.convertFilters(query.Statement)
+		if convertErr != nil {
+			err = fmt.Errorf("Testname: %s / Count %d : Unable to convert filters: %s", m.testName, m.counter, convertErr.Error())
+		}
 		for key, value := range convertedStatement {
 			expected, ok := currentResponse.Query[key]
 			if !ok {
-				m.t.Errorf("Testname: %s / Count %d : Did not expect a query with key [%s]", m.testName, m.counter, key)
-				m.t.FailNow()
+				err = fmt.Errorf("Testname: %s / Count %d : Did not expect a query with key [%s]", m.testName, m.counter, key)
+				break
 			}
-			if !m.assertStrings(expected, value) {
-				m.t.Errorf("Testname: %s / Count %d / Key %s : Query [%s] does not match expected result [%s]", m.testName, m.counter, key, value, expected)
-				m.t.FailNow()
+			if !m.assertFilters(expected, value) {
+				err = fmt.Errorf("Testname: %s / Count %d / Key %s : Query [%s] does not match expected result [%s]", m.testName, m.counter, key, value, expected)
+				break
 			}
+			delete(m.pending, key)
 		}
 	} else if reflect.ValueOf(query.Statement).Kind() == reflect.String {
 		// convert params slice to single string
 		paramsString := ""
 		for _, value := range query.Parameters {
 			if paramsString == "" {
-				paramsString = value.(string)
+				paramsString = fmt.Sprint(value)
 			} else {
-				paramsString = fmt.Sprintf("%s, %s", paramsString, value.(string))
+				paramsString = fmt.Sprintf("%s, %s", paramsString, fmt.Sprint(value))
 			}
 		}
 
 		// assert statement and params
 		expected, ok := currentResponse.Query["sql"]
-		if !ok {
-			m.t.Errorf("Testname: %s / Count %d : Did expect a query with key [sql]", m.testName, m.counter)
-			m.t.FailNow()
-		}
-		if !m.assertStrings(expected, query.Statement.(string)) && !m.assertStrings(paramsString, currentResponse.Params) {
-			m.t.Errorf("Testname: %s / Count %d : Query [%s / %s] does not match expected result [%s / %s]", m.testName, m.counter, query.Statement, paramsString, currentResponse.Query, currentResponse.Params)
-			m.t.FailNow()
+		switch {
+		case !ok:
+			err = fmt.Errorf("Testname: %s / Count %d : Did expect a query with key [sql]", m.testName, m.counter)
+		case !m.assertStrings(expected, query.Statement.(string)) && !m.assertStrings(paramsString, currentResponse.Params):
+			err = fmt.Errorf("Testname: %s / Count %d : Query [%s / %s] does not match expected result [%s / %s]", m.testName, m.counter, query.Statement, paramsString, currentResponse.Query, currentResponse.Params)
+		default:
+			delete(m.pending, "sql")
 		}
 	} else {
-		m.t.Errorf("Testname: %s / Count %d : Unsupported Query type %T", m.testName, m.counter, query.Statement)
-		m.t.FailNow()
+		err = fmt.Errorf("Testname: %s / Count %d : Unsupported Query type %T", m.testName, m.counter, query.Statement)
+	}
+
+	// Executors are called concurrently, therefore the test is only marked as failed
+	if err != nil {
+		m.t.Error(err)
+		m.pending = nil
+		m.counter++
+		return false, err
+	}
+	if len(m.pending) == 0 {
+		m.counter++
 	}
-	m.counter++
 	return true, nil
 }
 
@@ -120,6 +149,67 @@ func (m *MockedDatastoreExecuter) assertStrings(expected, got string) bool {
 	return true
 }
 
+// convertFilters renders the filters of a mongo statement as JSON (collection -> filter).
+func (m *MockedDatastoreExecuter) convertFilters(statement interface{}) (map[string]string, error) {
+	raw, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+	var filters map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &filters); err != nil {
+		return nil, err
+	}
+
+	converted := make(map[string]string, len(filters))
+	for collection, filter := range filters {
+		converted[collection] = string(filter)
+	}
+	return converted, nil
+}
+
+// assertFilters compares two JSON filters independent of the order of their fields and of the operands of logical operators.
+// The order of all other arrays (i.e. the stages of a pipeline) is significant.
+func (m *MockedDatastoreExecuter) assertFilters(expected, got string) bool {
+	var expectedFilter, gotFilter interface{}
+	if json.Unmarshal([]byte(expected), &expectedFilter) != nil || json.Unmarshal([]byte(got), &gotFilter) != nil {
+		return false
+	}
+	return reflect.DeepEqual(m.normalizeFilter(expectedFilter), m.normalizeFilter(gotFilter))
+}
+
+func (m *MockedDatastoreExecuter) normalizeFilter(filter interface{}) interface{} {
+	switch v := filter.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			operands, isArray := value.([]interface{})
+			if isArray && (key == "$or" || key == "$and" || key == "$nor") {
+				v[key] = m.sortOperands(operands)
+				continue
+			}
+			v[key] = m.normalizeFilter(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = m.normalizeFilter(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// sortOperands normalizes the operands of a logical operator and sorts them by their JSON representation.
+func (m *MockedDatastoreExecuter) sortOperands(operands []interface{}) []string {
+	rendered := make([]string, len(operands))
+	for i, value := range operands {
+		raw, _ := json.Marshal(m.normalizeFilter(value))
+		rendered[i] = string(raw)
+	}
+	sort.Strings(rendered)
+	return rendered
+}
+
 func (m *MockedDatastoreExecuter) Configure(appConf *configs.AppConfig, alias string) error {
 	args := m.Called(appConf, alias)
 	return args.Error(0)
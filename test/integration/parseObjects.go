@@ -18,4 +18,5 @@ type DBRequest struct {
 	Body    string `yaml:"body"`
 	Text    string `yaml:"text"`
 	Success bool   `yaml:"success"`
+	Allow   *bool  `yaml:"allow"`
 }
@@ -52,6 +52,17 @@ func Test_integration_policyCompiler(t *testing.T) {
 				pathPrefix:           "/v1",
 			},
 		},
+		{
+			name: "Memory",
+			fields: testConfiguration{
+				configPath:           "./test/integration/config/memory/kelon.yml",
+				policiesPath:         "./examples/local/policies",
+				callOpsPath:          "./test/integration/config/memory/call-operands",
+				evaluatedQueriesPath: "./test/integration/config/dbQueries.yml",
+				requestPath:          "./test/integration/config/memory/requests.yml",
+				pathPrefix:           "/v1",
+			},
+		},
 	}
 	for _, tt := range tests {
 		// redefining scope variable for to bypass parallel execution error
@@ -138,7 +149,7 @@ func runPolicyCompilerTest(t *testing.T, name string, config *testConfiguration)
 			t.FailNow()
 		}
 
-		_, respErr := testEnvironment.policyCompiler.Execute(context.Background(), requestBody)
+		decision, respErr := testEnvironment.policyCompiler.Execute(context.Background(), requestBody)
 
 		// If error does not match expected success parameter -> fail
 		successExpected := requests.Requests[strconv.Itoa(counter)].Success
@@ -151,6 +162,12 @@ func runPolicyCompilerTest(t *testing.T, name string, config *testConfiguration)
 
 			t.FailNow()
 		}
+
+		// If decision does not match expected decision -> fail
+		if allowExpected := requests.Requests[strconv.Itoa(counter)].Allow; allowExpected != nil && (decision == nil || decision.Allow != *allowExpected) {
+			t.Errorf("Decision allow=%t expected, but got %+v in %s: %s", *allowExpected, decision, name, testName)
+			t.FailNow()
+		}
 		counter++
 		logging.LogForComponent("mockedDatastoreExecuter").Infof("PASS: %s", testName)
 	}
@@ -233,6 +250,12 @@ func (p *PolicyCompilerTestEnvironment) mockMakeDatastores(config *configs.Exter
 			result[dsName] = &newDs
 			continue
 		}
+		if ds.Type == data.TypeMemory {
+			// Memory datastores evaluate the queries against their fixtures, so no mock is needed
+			newDs := dataInt.NewDatastore(dataInt.NewMemoryDatastoreTranslator(), dataInt.NewMemoryDatastoreExecutor())
+			logging.LogForComponent("factory").Infof("Init MemoryDatastore of type [%s] with alias [%s]", ds.Type, dsName)
+			result[dsName] = &newDs
+		}
 	}
 	return result
 }